@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/cobra"
@@ -39,10 +43,216 @@ func main() {
 		},
 	}
 
-	rootCmd.AddCommand(apiCmd)
+	rootCmd.AddCommand(apiCmd, newExportCmd(), newImportCmd(), newRebalancePositionsCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
+
+// newService connects to the database directly for CLI commands. Logs go to
+// stderr so they do not mix with exported data.
+func newService() (*internal.Service, error) {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelWarn,
+	})))
+
+	db, err := internal.NewDB()
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := internal.NewBlobStore()
+	if err != nil {
+		return nil, err
+	}
+	return internal.NewService(internal.NewRepository(db), blobs), nil
+}
+
+// cliContext attributes changes made by CLI commands to the cli actor.
+func cliContext() context.Context {
+	return internal.WithActor(context.Background(), "cli")
+}
+
+func newExportCmd() *cobra.Command {
+	var (
+		format    string
+		output    string
+		completed string
+		dueAfter  string
+		dueBefore string
+		query     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export todos from the database",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter := internal.TodoFilter{Query: query}
+			if completed != "" {
+				c, err := strconv.ParseBool(completed)
+				if err != nil {
+					return fmt.Errorf("invalid --completed: %w", err)
+				}
+				filter.Completed = &c
+			}
+			var err error
+			if filter.DueAfter, err = parseTimeFlag("due-after", dueAfter); err != nil {
+				return err
+			}
+			if filter.DueBefore, err = parseTimeFlag("due-before", dueBefore); err != nil {
+				return err
+			}
+
+			var w io.Writer = os.Stdout
+			if output != "" && output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+
+			enc, err := internal.NewTodoEncoder(w, format)
+			if err != nil {
+				return err
+			}
+
+			service, err := newService()
+			if err != nil {
+				return err
+			}
+			return service.Export(cliContext(), filter, enc)
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", internal.FormatJSON, "output format: json, ndjson, csv, ics, todotxt or markdown")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "output file (default stdout)")
+	cmd.Flags().StringVar(&completed, "completed", "", "only export completed (true) or open (false) todos")
+	cmd.Flags().StringVar(&dueAfter, "due-after", "", "only export todos due at or after this RFC3339 time")
+	cmd.Flags().StringVar(&dueBefore, "due-before", "", "only export todos due before this RFC3339 time")
+	cmd.Flags().StringVarP(&query, "query", "q", "", "only export todos whose title contains this text")
+
+	return cmd
+}
+
+func newImportCmd() *cobra.Command {
+	var (
+		format  string
+		input   string
+		mapping string
+		from    string
+		dryRun  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import todos into the database",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			columns, err := internal.ParseColumnMapping(mapping)
+			if err != nil {
+				return err
+			}
+
+			var r io.Reader = os.Stdin
+			if input != "" && input != "-" {
+				f, err := os.Open(input)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+
+			service, err := newService()
+			if err != nil {
+				return err
+			}
+
+			if from != "" {
+				report, op, err := service.ImportFrom(cliContext(), from, r, dryRun)
+				printRowErrors(err)
+				if err != nil {
+					return err
+				}
+				printImportReport(report, op)
+				return nil
+			}
+
+			todos, op, err := service.Import(cliContext(), r, format, columns)
+			printRowErrors(err)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stderr, "Imported %d todos (operation %s)\n", len(todos), op.ID)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", internal.FormatJSON, "input format: json, ndjson, csv, ics, todotxt or markdown")
+	cmd.Flags().StringVarP(&input, "input", "i", "", "input file (default stdin)")
+	cmd.Flags().StringVar(&mapping, "map", "", `CSV column mapping, e.g. "title:Name,due_date:Due"`)
+	cmd.Flags().StringVar(&from, "from", "", "import another tool's export: todoist, trello or jira")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "with --from, only report what would be imported")
+
+	return cmd
+}
+
+func newRebalancePositionsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rebalance-positions",
+		Short: "Rewrite the manual order keys of every list to short, evenly spaced ones",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service, err := newService()
+			if err != nil {
+				return err
+			}
+			n, err := service.RebalancePositions(cliContext(), false)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Rebalanced %d todos\n", n)
+			return nil
+		},
+	}
+}
+
+func printRowErrors(err error) {
+	if importErr, ok := err.(*internal.ImportError); ok {
+		for _, row := range importErr.Rows {
+			fmt.Fprintf(os.Stderr, "row %d: %s\n", row.Row, row.Error)
+		}
+	}
+}
+
+func printImportReport(report *internal.ImportReport, op *internal.Operation) {
+	for _, item := range report.Items {
+		title := item.Todo.Title
+		if item.Parent != "" {
+			title = item.Parent + " > " + title
+		}
+		fmt.Fprintf(os.Stderr, "%-8s %s\n", item.Result, title)
+	}
+
+	switch {
+	case report.DryRun:
+		fmt.Fprintf(os.Stderr, "Dry run: would create %d todos, skip %d\n", report.Created, report.Skipped)
+	case op != nil:
+		fmt.Fprintf(os.Stderr, "Created %d todos, skipped %d (operation %s)\n", report.Created, report.Skipped, op.ID)
+	default:
+		fmt.Fprintf(os.Stderr, "Nothing to import, skipped %d todos\n", report.Skipped)
+	}
+}
+
+func parseTimeFlag(name, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", name, err)
+	}
+	return &t, nil
+}
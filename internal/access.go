@@ -0,0 +1,403 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// The roles a user can have on a list, each including the ones before it.
+// Viewers read the list and its todos, editors also change them, and owners
+// also manage the list, its members and its share links.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+// roleRanks orders the roles on a list.
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// rolesAtLeast returns the roles that include role.
+func rolesAtLeast(role string) []string {
+	var roles []string
+	for _, r := range []string{RoleViewer, RoleEditor, RoleOwner} {
+		if roleRanks[r] >= roleRanks[role] {
+			roles = append(roles, r)
+		}
+	}
+	return roles
+}
+
+// Member is a user's role on a list.
+type Member struct {
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	Name      string    `json:"name" db:"name"`
+	Role      string    `json:"role" db:"role"`
+	ListID    int64     `json:"list_id" db:"list_id"`
+	UserID    int64     `json:"user_id" db:"user_id"`
+}
+
+// MemberInput sets a user's role on a list.
+type MemberInput struct {
+	Role string `json:"role"`
+}
+
+func (in *MemberInput) Validate() error {
+	if roleRanks[in.Role] == 0 {
+		return ErrInvalidRole
+	}
+	return nil
+}
+
+// ListRole returns a user's role on a list, or "" if they are no member.
+func (r *Repository) ListRole(ctx context.Context, listID, userID int64) (string, error) {
+	var role string
+	err := r.db.GetContext(ctx, &role,
+		"SELECT role FROM list_members WHERE list_id = ? AND user_id = ?", listID, userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+// TodoRoles returns a user's role on the list of each of the todos that
+// exist, "" for those in lists they are no member of and outside lists.
+func (r *Repository) TodoRoles(ctx context.Context, ids []int64, userID int64) (map[int64]string, error) {
+	query, args, err := sqlx.In(`SELECT t.id, COALESCE(m.role, '') AS role FROM todos t
+		LEFT JOIN list_members m ON m.list_id = t.list_id AND m.user_id = ?
+		WHERE t.id IN (?)`, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Role string `db:"role"`
+		ID   int64  `db:"id"`
+	}
+	if err := r.db.SelectContext(ctx, &rows, r.db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	roles := make(map[int64]string, len(rows))
+	for _, row := range rows {
+		roles[row.ID] = row.Role
+	}
+	return roles, nil
+}
+
+// ListMembers returns the members of a list, owners first.
+func (r *Repository) ListMembers(ctx context.Context, listID int64) ([]Member, error) {
+	members := []Member{}
+	err := r.db.SelectContext(ctx, &members,
+		`SELECT m.list_id, m.user_id, u.name, m.role, m.created_at FROM list_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.list_id = ? ORDER BY FIELD(m.role, 'owner', 'editor', 'viewer'), u.name`, listID)
+	return members, err
+}
+
+// insertMember gives a user a role on a list, or changes the role they have.
+func insertMember(ctx context.Context, tx *sqlx.Tx, listID, userID int64, role string, now time.Time) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO list_members (list_id, user_id, role, created_at) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE role = VALUES(role)`, listID, userID, role, now)
+	return err
+}
+
+// checkLastOwner fails with ErrLastOwner if userID is the only owner of a
+// list. The list must be locked by tx.
+func checkLastOwner(ctx context.Context, tx *sqlx.Tx, listID, userID int64) error {
+	var owners []int64
+	err := tx.SelectContext(ctx, &owners,
+		"SELECT user_id FROM list_members WHERE list_id = ? AND role = ?", listID, RoleOwner)
+	if err != nil {
+		return err
+	}
+	if len(owners) == 1 && owners[0] == userID {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// SetMember gives a user of the list's tenant a role on it. It fails with
+// ErrLastOwner if that would leave the list without an owner.
+func (r *Repository) SetMember(ctx context.Context, listID, userID int64, role string, now time.Time) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := lockList(ctx, tx, listID); err != nil {
+			return err
+		}
+		var tenant, userTenant string
+		if err := tx.GetContext(ctx, &tenant, "SELECT tenant FROM lists WHERE id = ?", listID); err != nil {
+			return err
+		}
+		err := tx.GetContext(ctx, &userTenant, "SELECT tenant FROM users WHERE id = ? FOR SHARE", userID)
+		if err == sql.ErrNoRows {
+			return ErrInvalidUser
+		}
+		if err != nil {
+			return err
+		}
+		if userTenant != tenant {
+			return ErrTenantMismatch
+		}
+		if role != RoleOwner {
+			if err := checkLastOwner(ctx, tx, listID, userID); err != nil {
+				return err
+			}
+		}
+		return insertMember(ctx, tx, listID, userID, role, now)
+	})
+}
+
+// RemoveMember takes a user's role on a list away. It fails with
+// ErrLastOwner if they are its only owner.
+func (r *Repository) RemoveMember(ctx context.Context, listID, userID int64) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := lockList(ctx, tx, listID); err != nil {
+			return err
+		}
+		if err := checkLastOwner(ctx, tx, listID, userID); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx,
+			"DELETE FROM list_members WHERE list_id = ? AND user_id = ?", listID, userID)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// The authorization layer. Users only reach the lists they are members of,
+// and the todos in them, as far as their role allows. Callers that are not
+// users, such as holders of the instance API key, the CLI and share links,
+// which are checked separately, may do anything.
+
+// authorizeList fails unless the caller has at least role on a list. Lists
+// the caller is no member of are not found.
+func (s *Service) authorizeList(ctx context.Context, listID int64, role string) error {
+	user := UserFromContext(ctx)
+	if user == nil {
+		return nil
+	}
+	have, err := s.repo.ListRole(ctx, listID, user.ID)
+	if err != nil {
+		return err
+	}
+	if have == "" {
+		return ErrNotFound
+	}
+	if roleRanks[have] < roleRanks[role] {
+		return ErrInsufficientRole
+	}
+	return nil
+}
+
+// authorizeTodos fails unless the caller has at least role on the lists of
+// the todos. Todos the caller cannot see, which includes all todos outside
+// lists and deleted ones, are not found.
+func (s *Service) authorizeTodos(ctx context.Context, ids []int64, role string) error {
+	user := UserFromContext(ctx)
+	if user == nil || len(ids) == 0 {
+		return nil
+	}
+	roles, err := s.repo.TodoRoles(ctx, ids, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		have := roles[id]
+		if have == "" {
+			return ErrNotFound
+		}
+		if roleRanks[have] < roleRanks[role] {
+			return ErrInsufficientRole
+		}
+	}
+	return nil
+}
+
+func (s *Service) authorizeTodo(ctx context.Context, id int64, role string) error {
+	return s.authorizeTodos(ctx, []int64{id}, role)
+}
+
+// authorizeNewTodos fails unless the caller may create todos in the given
+// lists, which takes the editor role. Users cannot create todos outside
+// lists.
+func (s *Service) authorizeNewTodos(ctx context.Context, listIDs []*int64) error {
+	if UserFromContext(ctx) == nil {
+		return nil
+	}
+	seen := make(map[int64]bool)
+	for _, id := range listIDs {
+		if id == nil {
+			return ErrListRequired
+		}
+		if seen[*id] {
+			continue
+		}
+		seen[*id] = true
+		if err := s.authorizeList(ctx, *id, RoleEditor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// todoListIDs returns the lists of todos, for authorizeNewTodos.
+func todoListIDs(todos []*Todo) []*int64 {
+	ids := make([]*int64, len(todos))
+	for i, todo := range todos {
+		ids[i] = todo.ListID
+	}
+	return ids
+}
+
+// authorizeAdmin fails unless the caller is not a user. It guards the
+// endpoints that work on todos regardless of their list.
+func authorizeAdmin(ctx context.Context) error {
+	if UserFromContext(ctx) != nil {
+		return ErrAdminOnly
+	}
+	return nil
+}
+
+// visible narrows filter to the todos the caller has at least role on, in
+// SQL, so that no page or count ever includes others.
+func visible(ctx context.Context, filter TodoFilter, role string) TodoFilter {
+	if user := UserFromContext(ctx); user != nil {
+		filter.MemberID = &user.ID
+		filter.MemberRoles = rolesAtLeast(role)
+	}
+	return filter
+}
+
+// Members returns the members of a list the caller can see.
+func (s *Service) Members(ctx context.Context, listID int64) ([]Member, error) {
+	if listID <= 0 {
+		return nil, ErrInvalidID
+	}
+	if err := s.authorizeList(ctx, listID, RoleViewer); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetList(ctx, listID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListMembers(ctx, listID)
+}
+
+// SetMember gives a user a role on a list the caller owns, and returns the
+// list's members.
+func (s *Service) SetMember(ctx context.Context, listID, userID int64, input MemberInput) ([]Member, error) {
+	if listID <= 0 || userID <= 0 {
+		return nil, ErrInvalidID
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.authorizeList(ctx, listID, RoleOwner); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetMember(ctx, listID, userID, input.Role, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.repo.ListMembers(ctx, listID)
+}
+
+// RemoveMember takes a user's role on a list away. Owners may remove anyone
+// and members themselves, as long as the list keeps an owner.
+func (s *Service) RemoveMember(ctx context.Context, listID, userID int64) error {
+	if listID <= 0 || userID <= 0 {
+		return ErrInvalidID
+	}
+	role := RoleOwner
+	if user := UserFromContext(ctx); user != nil && user.ID == userID {
+		role = RoleViewer
+	}
+	if err := s.authorizeList(ctx, listID, role); err != nil {
+		return err
+	}
+	return s.repo.RemoveMember(ctx, listID, userID)
+}
+
+// memberIDs reads the list and user IDs of a membership's path. It writes a
+// 400 response and returns false if either is malformed.
+func memberIDs(c *gin.Context) (int64, int64, bool) {
+	listID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return 0, 0, false
+	}
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return 0, 0, false
+	}
+	return listID, userID, true
+}
+
+func (h *Handler) ListMembers(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+
+	members, err := h.service.Members(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": members})
+}
+
+// SetMember serves PUT /v1/lists/:id/members/:user_id, which adds a member
+// or changes their role.
+func (h *Handler) SetMember(c *gin.Context) {
+	listID, userID, ok := memberIDs(c)
+	if !ok {
+		return
+	}
+	var input MemberInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	members, err := h.service.SetMember(c.Request.Context(), listID, userID, input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": members})
+}
+
+func (h *Handler) RemoveMember(c *gin.Context) {
+	listID, userID, ok := memberIDs(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RemoveMember(c.Request.Context(), listID, userID); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRolesAtLeast(t *testing.T) {
+	assert.Equal(t, []string{RoleViewer, RoleEditor, RoleOwner}, rolesAtLeast(RoleViewer))
+	assert.Equal(t, []string{RoleEditor, RoleOwner}, rolesAtLeast(RoleEditor))
+	assert.Equal(t, []string{RoleOwner}, rolesAtLeast(RoleOwner))
+}
+
+func TestMemberInput_Validate(t *testing.T) {
+	for _, role := range []string{RoleViewer, RoleEditor, RoleOwner} {
+		input := MemberInput{Role: role}
+		assert.NoError(t, input.Validate(), role)
+	}
+	for _, role := range []string{"", "admin", "Owner"} {
+		input := MemberInput{Role: role}
+		assert.ErrorIs(t, input.Validate(), ErrInvalidRole, role)
+	}
+}
+
+func TestVisible(t *testing.T) {
+	listID := int64(2)
+	filter := TodoFilter{ListID: &listID}
+
+	assert.Equal(t, filter, visible(context.Background(), filter, RoleViewer), "callers that are not users see everything")
+
+	ctx := WithUser(context.Background(), &User{ID: 5, Name: "alice", Tenant: DefaultTenant})
+	conds, args := visible(ctx, filter, RoleEditor).conds()
+	assert.Equal(t, []string{
+		"list_id = ?",
+		"todos.list_id IN (SELECT m.list_id FROM list_members m WHERE m.user_id = ? AND m.role IN (?, ?))",
+	}, conds)
+	assert.Equal(t, []any{listID, int64(5), RoleEditor, RoleOwner}, args)
+}
+
+func TestService_Authorize_NotUser(t *testing.T) {
+	service := &Service{repo: nil}
+	ctx := context.Background()
+
+	assert.NoError(t, service.authorizeList(ctx, 1, RoleOwner))
+	assert.NoError(t, service.authorizeTodos(ctx, []int64{1, 2}, RoleOwner))
+	assert.NoError(t, service.authorizeNewTodos(ctx, []*int64{nil}))
+	assert.NoError(t, authorizeAdmin(ctx))
+}
+
+func TestService_Authorize_User(t *testing.T) {
+	service := &Service{repo: nil}
+	ctx := WithUser(context.Background(), &User{ID: 5, Name: "alice", Tenant: DefaultTenant})
+
+	assert.ErrorIs(t, service.authorizeNewTodos(ctx, []*int64{nil}), ErrListRequired)
+	assert.ErrorIs(t, authorizeAdmin(ctx), ErrAdminOnly)
+
+	_, _, _, err := service.BulkUpsert(ctx, []CreateTodoInput{{Title: "a"}}, OnConflictSkip)
+	assert.ErrorIs(t, err, ErrAdminOnly)
+
+	_, _, err = service.BulkCreate(ctx, []CreateTodoInput{{Title: "a"}})
+	assert.ErrorIs(t, err, ErrListRequired)
+}
+
+func TestHandler_Anonymous_OtherUsersList(t *testing.T) {
+	t.Setenv("API_KEY", "")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	service := &Service{repo: nil}
+	service.usersExist.Store(true)
+	r.Use(AuthMiddleware(service))
+	handler := &Handler{service: service}
+	handler.RegisterRoutes(r)
+
+	for _, path := range []string{"/v1/lists/1", "/v1/todos?list_id=1"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+
+		r.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, path)
+	}
+}
+
+func TestService_SetMember_Validation(t *testing.T) {
+	service := &Service{repo: nil}
+	ctx := context.Background()
+
+	_, err := service.SetMember(ctx, 0, 1, MemberInput{Role: RoleViewer})
+	assert.ErrorIs(t, err, ErrInvalidID)
+
+	_, err = service.SetMember(ctx, 1, 1, MemberInput{Role: "admin"})
+	assert.ErrorIs(t, err, ErrInvalidRole)
+
+	err = service.RemoveMember(ctx, 1, 0)
+	assert.ErrorIs(t, err, ErrInvalidID)
+}
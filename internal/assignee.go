@@ -0,0 +1,327 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// The ways a user can be related to a todo. Assignees own it; watchers
+// follow it.
+const (
+	RelationAssignee = "assignee"
+	RelationWatcher  = "watcher"
+)
+
+// relationTables are the tables holding each relation.
+var relationTables = map[string]string{
+	RelationAssignee: "todo_assignees",
+	RelationWatcher:  "todo_watchers",
+}
+
+// TodoUserInput names the user to relate to a todo. Without a user_id it is
+// the caller.
+type TodoUserInput struct {
+	UserID int64 `json:"user_id"`
+}
+
+// lockTodoTenant returns the tenant of a todo, that of its list, and locks
+// the todo against deletion until tx ends.
+func lockTodoTenant(ctx context.Context, tx *sqlx.Tx, todoID int64) (string, error) {
+	var tenant string
+	err := tx.GetContext(ctx, &tenant,
+		`SELECT COALESCE(l.tenant, ?) FROM todos t LEFT JOIN lists l ON l.id = t.list_id
+		WHERE t.id = ? FOR SHARE`, DefaultTenant, todoID)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return tenant, err
+}
+
+// AddTodoUser relates a user to a todo. It fails with ErrInvalidUser if the
+// user does not exist and with ErrTenantMismatch if they belong to another
+// tenant than the todo. New assignments are recorded as events. It reports
+// whether the user was not related yet.
+func (r *Repository) AddTodoUser(ctx context.Context, relation string, todoID, userID int64, now time.Time) (bool, error) {
+	var added bool
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		tenant, err := lockTodoTenant(ctx, tx, todoID)
+		if err != nil {
+			return err
+		}
+		var userTenant string
+		err = tx.GetContext(ctx, &userTenant, "SELECT tenant FROM users WHERE id = ? FOR SHARE", userID)
+		if err == sql.ErrNoRows {
+			return ErrInvalidUser
+		}
+		if err != nil {
+			return err
+		}
+		if userTenant != tenant {
+			return ErrTenantMismatch
+		}
+
+		result, err := tx.ExecContext(ctx,
+			"INSERT INTO "+relationTables[relation]+" (todo_id, user_id, created_at) VALUES (?, ?, ?)"+
+				" ON DUPLICATE KEY UPDATE todo_id = todo_id",
+			todoID, userID, now)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		added = rows > 0
+		if !added || relation != RelationAssignee {
+			return nil
+		}
+		return insertEvents(ctx, tx, []TodoEvent{newAssignmentEvent(ctx, todoID, nil, &userID, now)})
+	})
+	return added, err
+}
+
+// RemoveTodoUser ends a relation between a user and a todo, recording the
+// end of an assignment as an event.
+func (r *Repository) RemoveTodoUser(ctx context.Context, relation string, todoID, userID int64, now time.Time) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := lockTodoTenant(ctx, tx, todoID); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx,
+			"DELETE FROM "+relationTables[relation]+" WHERE todo_id = ? AND user_id = ?", todoID, userID)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+		if relation != RelationAssignee {
+			return nil
+		}
+		return insertEvents(ctx, tx, []TodoEvent{newAssignmentEvent(ctx, todoID, &userID, nil, now)})
+	})
+}
+
+// TodoUsers returns the users related to a todo, in the order they were
+// added.
+func (r *Repository) TodoUsers(ctx context.Context, relation string, todoID int64) ([]User, error) {
+	users := []User{}
+	err := r.db.SelectContext(ctx, &users,
+		"SELECT u.* FROM users u JOIN "+relationTables[relation]+" rel ON rel.user_id = u.id WHERE rel.todo_id = ? ORDER BY rel.created_at, u.id",
+		todoID)
+	return users, err
+}
+
+// newAssignmentEvent records a user being assigned to a todo, or unassigned
+// from it, so that they can be notified. It belongs to no operation and
+// cannot be undone.
+func newAssignmentEvent(ctx context.Context, todoID int64, before, after *int64, now time.Time) TodoEvent {
+	action := EventAssigned
+	if after == nil {
+		action = EventUnassigned
+	}
+	change := FieldChange{}
+	if before != nil {
+		change.Before = *before
+	}
+	if after != nil {
+		change.After = *after
+	}
+	return TodoEvent{
+		TodoID:    todoID,
+		Action:    action,
+		Actor:     ActorFromContext(ctx),
+		RequestID: RequestIDFromContext(ctx),
+		Changes:   FieldChanges{"assignee": change},
+		CreatedAt: now,
+	}
+}
+
+// resolveTodoUser returns the ID of the user input names, defaulting to the
+// caller.
+func resolveTodoUser(ctx context.Context, input TodoUserInput) (int64, error) {
+	if input.UserID < 0 {
+		return 0, ErrInvalidID
+	}
+	if input.UserID > 0 {
+		return input.UserID, nil
+	}
+	user, err := currentUser(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// relationRole is the role it takes on a todo's list to relate a user to
+// it. Assigning takes an editor; anyone who can see a todo may watch it
+// themselves.
+func relationRole(ctx context.Context, relation string, userID int64) string {
+	if user := UserFromContext(ctx); relation == RelationWatcher && user != nil && user.ID == userID {
+		return RoleViewer
+	}
+	return RoleEditor
+}
+
+// AddTodoUser relates a user of the todo's tenant to a todo and returns all
+// users so related.
+func (s *Service) AddTodoUser(ctx context.Context, relation string, todoID int64, input TodoUserInput) ([]User, error) {
+	if todoID <= 0 {
+		return nil, ErrInvalidID
+	}
+	userID, err := resolveTodoUser(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeTodo(ctx, todoID, relationRole(ctx, relation, userID)); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.AddTodoUser(ctx, relation, todoID, userID, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.repo.TodoUsers(ctx, relation, todoID)
+}
+
+// RemoveTodoUser ends a user's relation to a todo.
+func (s *Service) RemoveTodoUser(ctx context.Context, relation string, todoID, userID int64) error {
+	if todoID <= 0 || userID <= 0 {
+		return ErrInvalidID
+	}
+	if err := s.authorizeTodo(ctx, todoID, relationRole(ctx, relation, userID)); err != nil {
+		return err
+	}
+	return s.repo.RemoveTodoUser(ctx, relation, todoID, userID, time.Now())
+}
+
+// TodoUsers returns the users related to a todo.
+func (s *Service) TodoUsers(ctx context.Context, relation string, todoID int64) ([]User, error) {
+	if todoID <= 0 {
+		return nil, ErrInvalidID
+	}
+	if err := s.authorizeTodo(ctx, todoID, RoleViewer); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetByID(ctx, todoID); err != nil {
+		return nil, err
+	}
+	return s.repo.TodoUsers(ctx, relation, todoID)
+}
+
+func (h *Handler) ListAssignees(c *gin.Context) { h.listTodoUsers(c, RelationAssignee) }
+func (h *Handler) AssignTodo(c *gin.Context)    { h.addTodoUser(c, RelationAssignee) }
+func (h *Handler) UnassignTodo(c *gin.Context)  { h.removeTodoUser(c, RelationAssignee) }
+func (h *Handler) ListWatchers(c *gin.Context)  { h.listTodoUsers(c, RelationWatcher) }
+func (h *Handler) WatchTodo(c *gin.Context)     { h.addTodoUser(c, RelationWatcher) }
+func (h *Handler) UnwatchTodo(c *gin.Context)   { h.removeTodoUser(c, RelationWatcher) }
+
+func (h *Handler) listTodoUsers(c *gin.Context, relation string) {
+	todoID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+
+	users, err := h.service.TodoUsers(c.Request.Context(), relation, todoID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": users})
+}
+
+func (h *Handler) addTodoUser(c *gin.Context, relation string) {
+	todoID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	var input TodoUserInput
+	// An empty body relates the caller.
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+			return
+		}
+	}
+
+	users, err := h.service.AddTodoUser(c.Request.Context(), relation, todoID, input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": users})
+}
+
+func (h *Handler) removeTodoUser(c *gin.Context, relation string) {
+	todoID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+
+	if err := h.service.RemoveTodoUser(c.Request.Context(), relation, todoID, userID); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// MyTodos serves GET /v1/me/todos: the todos assigned to the caller, or with
+// relation=watching the ones they watch, narrowed by the list filters.
+func (h *Handler) MyTodos(c *gin.Context) {
+	user, err := currentUser(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	filter, ok := parseListFilter(c)
+	if !ok {
+		return
+	}
+	switch c.DefaultQuery("relation", "assigned") {
+	case "assigned":
+		filter.AssigneeID = &user.ID
+	case "watching":
+		filter.WatcherID = &user.ID
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'relation' parameter"})
+		return
+	}
+
+	todos, total, err := h.service.List(c.Request.Context(), filter, c.Query("sort"), page, limit)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": todos,
+		"meta": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveTodoUser(t *testing.T) {
+	alice := &User{ID: 3, Name: "alice", Tenant: DefaultTenant}
+
+	id, err := resolveTodoUser(WithUser(context.Background(), alice), TodoUserInput{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), id)
+
+	id, err = resolveTodoUser(context.Background(), TodoUserInput{UserID: 5})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), id)
+
+	_, err = resolveTodoUser(context.Background(), TodoUserInput{})
+	assert.ErrorIs(t, err, ErrNoCurrentUser)
+
+	_, err = resolveTodoUser(context.Background(), TodoUserInput{UserID: -1})
+	assert.ErrorIs(t, err, ErrInvalidID)
+}
+
+func TestNewAssignmentEvent(t *testing.T) {
+	ctx := WithActor(context.Background(), "alice")
+	now := time.Now()
+	userID := int64(5)
+
+	assigned := newAssignmentEvent(ctx, 1, nil, &userID, now)
+	assert.Equal(t, EventAssigned, assigned.Action)
+	assert.Equal(t, "alice", assigned.Actor)
+	assert.Equal(t, FieldChanges{"assignee": {After: int64(5)}}, assigned.Changes)
+	assert.Empty(t, assigned.OperationID)
+
+	unassigned := newAssignmentEvent(ctx, 1, &userID, nil, now)
+	assert.Equal(t, EventUnassigned, unassigned.Action)
+	assert.Equal(t, FieldChanges{"assignee": {Before: int64(5)}}, unassigned.Changes)
+}
+
+func TestTodoFilter_Assignee(t *testing.T) {
+	userID := int64(5)
+
+	conds, args := TodoFilter{AssigneeID: &userID}.conds()
+	assert.Equal(t, []string{"EXISTS (SELECT 1 FROM todo_assignees a WHERE a.todo_id = todos.id AND a.user_id = ?)"}, conds)
+	assert.Equal(t, []any{userID}, args)
+
+	conds, args = TodoFilter{Unassigned: true}.conds()
+	assert.Equal(t, []string{"NOT EXISTS (SELECT 1 FROM todo_assignees a WHERE a.todo_id = todos.id)"}, conds)
+	assert.Empty(t, args)
+}
+
+func TestHandler_AssigneeFilter(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "invalid assignee", path: "/v1/todos?assignee=abc", expectedStatus: http.StatusBadRequest},
+		{name: "zero assignee", path: "/v1/todos?assignee=0", expectedStatus: http.StatusBadRequest},
+		{name: "me without user", path: "/v1/todos?assignee=me", expectedStatus: http.StatusForbidden},
+		{name: "my todos without user", path: "/v1/me/todos", expectedStatus: http.StatusForbidden},
+		{name: "profile without user", path: "/v1/me", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			handler := &Handler{service: &Service{repo: nil}}
+			handler.RegisterRoutes(r)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,446 @@
+package internal
+
+import (
+	"context"
+	"crypto/hmac"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/fx"
+)
+
+// attachmentTypes are the media types an attachment may have, as detected
+// from its first bytes rather than taken from the client.
+var attachmentTypes = map[string]bool{
+	"image/png":          true,
+	"image/jpeg":         true,
+	"image/gif":          true,
+	"image/webp":         true,
+	"application/pdf":    true,
+	"text/plain":         true,
+	"application/zip":    true,
+	"application/x-gzip": true,
+}
+
+// collectBatchSize is the number of orphaned attachments collected per query.
+const collectBatchSize = 100
+
+// Attachment is a file attached to a todo. Its contents live in the blob
+// store under BlobKey. DownloadURL is a signed link that stops working at
+// DownloadExpiresAt.
+type Attachment struct {
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty" db:"-"`
+	BlobKey           string     `json:"-" db:"blob_key"`
+	ContentType       string     `json:"content_type" db:"content_type"`
+	DownloadURL       string     `json:"download_url,omitempty" db:"-"`
+	Filename          string     `json:"filename" db:"filename"`
+	UploadedBy        string     `json:"uploaded_by" db:"uploaded_by"`
+	ID                int64      `json:"id" db:"id"`
+	Size              int64      `json:"size" db:"size"`
+	TodoID            int64      `json:"todo_id" db:"todo_id"`
+}
+
+// attachmentFilename returns the base name of an uploaded file without
+// control characters, cut to 255 bytes.
+func attachmentFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name))
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+// sniffAttachment detects the content type of body from its first bytes and
+// rewinds it. It fails with ErrAttachmentType unless the type is one of
+// attachmentTypes.
+func sniffAttachment(body io.ReadSeeker) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	contentType := http.DetectContentType(head[:n])
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !attachmentTypes[mediaType] {
+		return "", fmt.Errorf("%w: %s", ErrAttachmentType, mediaType)
+	}
+	return contentType, nil
+}
+
+// newSigningKey returns the key links are signed with, taken from the
+// environment variable env. Without it a random key is used, so the links
+// stop working when the process restarts and only work on the instance that
+// issued them.
+func newSigningKey(env, links string) []byte {
+	if secret := GetEnv(env, ""); secret != "" {
+		return []byte(secret)
+	}
+	slog.Warn(env + " is not set, " + links + " only work on this instance until it restarts")
+	return []byte(RandomID() + RandomID())
+}
+
+// CreateAttachment records attachment on its todo, failing with ErrNotFound
+// if the todo does not exist.
+func (r *Repository) CreateAttachment(ctx context.Context, attachment *Attachment) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		var found int64
+		err := tx.GetContext(ctx, &found, "SELECT id FROM todos WHERE id = ? FOR SHARE", attachment.TodoID)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.NamedExecContext(ctx,
+			`INSERT INTO attachments (todo_id, blob_key, filename, content_type, size, uploaded_by, created_at)
+			VALUES (:todo_id, :blob_key, :filename, :content_type, :size, :uploaded_by, :created_at)`, attachment)
+		if err != nil {
+			return err
+		}
+		attachment.ID, err = result.LastInsertId()
+		return err
+	})
+}
+
+func (r *Repository) ListAttachments(ctx context.Context, todoID int64) ([]Attachment, error) {
+	attachments := []Attachment{}
+	err := r.db.SelectContext(ctx, &attachments, "SELECT * FROM attachments WHERE todo_id = ? ORDER BY id", todoID)
+	return attachments, err
+}
+
+// GetAttachment returns an attachment of a todo that still exists.
+func (r *Repository) GetAttachment(ctx context.Context, id int64) (*Attachment, error) {
+	var attachment Attachment
+	err := r.db.GetContext(ctx, &attachment,
+		"SELECT a.* FROM attachments a JOIN todos t ON t.id = a.todo_id WHERE a.id = ?", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &attachment, err
+}
+
+func (r *Repository) GetTodoAttachment(ctx context.Context, todoID, id int64) (*Attachment, error) {
+	var attachment Attachment
+	err := r.db.GetContext(ctx, &attachment, "SELECT * FROM attachments WHERE id = ? AND todo_id = ?", id, todoID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &attachment, err
+}
+
+func (r *Repository) DeleteAttachment(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM attachments WHERE id = ?", id)
+	return err
+}
+
+// OrphanedAttachments returns up to limit attachments whose todo no longer
+// exists and was not deleted at or after deletedBefore.
+func (r *Repository) OrphanedAttachments(ctx context.Context, deletedBefore time.Time, limit int) ([]Attachment, error) {
+	attachments := []Attachment{}
+	err := r.db.SelectContext(ctx, &attachments, `SELECT a.* FROM attachments a
+		WHERE NOT EXISTS (SELECT 1 FROM todos t WHERE t.id = a.todo_id)
+		AND NOT EXISTS (
+			SELECT 1 FROM todo_events e WHERE e.todo_id = a.todo_id AND e.action = ? AND e.created_at >= ?
+		)
+		ORDER BY a.id LIMIT ?`, EventDeleted, deletedBefore, limit)
+	return attachments, err
+}
+
+// downloadSignature signs the download link of an attachment that expires
+// at the given Unix time.
+func (s *Service) downloadSignature(id, expires int64) string {
+	return hex.EncodeToString(hmacSHA256(s.downloadKey, fmt.Sprintf("%d:%d", id, expires)))
+}
+
+// signDownload sets the download link of attachment, valid for the
+// configured TTL from now.
+func (s *Service) signDownload(attachment *Attachment, now time.Time) {
+	expires := now.Add(s.downloadTTL).Truncate(time.Second)
+	attachment.DownloadURL = fmt.Sprintf("/v1/attachments/%d/download?expires=%d&signature=%s",
+		attachment.ID, expires.Unix(), s.downloadSignature(attachment.ID, expires.Unix()))
+	attachment.DownloadExpiresAt = &expires
+}
+
+// Attach stores size bytes of body as an attachment of a todo, uploaded by
+// the caller. The content type is sniffed from the contents.
+func (s *Service) Attach(ctx context.Context, todoID int64, filename string, body io.ReadSeeker, size int64) (*Attachment, error) {
+	if todoID <= 0 {
+		return nil, ErrInvalidID
+	}
+	if size > s.attachmentMaxBytes {
+		return nil, ErrAttachmentTooLarge
+	}
+	if size == 0 {
+		return nil, ErrEmptyAttachment
+	}
+	contentType, err := sniffAttachment(body)
+	if err != nil {
+		return nil, err
+	}
+	// Check before uploading, so that most requests for a missing todo
+	// never store a blob.
+	if err := s.authorizeTodo(ctx, todoID, RoleEditor); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetByID(ctx, todoID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	attachment := &Attachment{
+		TodoID:      todoID,
+		BlobKey:     fmt.Sprintf("todos/%d/%s", todoID, RandomID()),
+		Filename:    attachmentFilename(filename),
+		ContentType: contentType,
+		Size:        size,
+		UploadedBy:  ActorFromContext(ctx),
+		CreatedAt:   now,
+	}
+	if err := s.blobs.Put(ctx, attachment.BlobKey, body, size, contentType); err != nil {
+		return nil, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	if err := s.repo.CreateAttachment(ctx, attachment); err != nil {
+		if derr := s.blobs.Delete(context.WithoutCancel(ctx), attachment.BlobKey); derr != nil {
+			slog.Error("Failed to delete unrecorded attachment blob", "key", attachment.BlobKey, "error", derr)
+		}
+		return nil, err
+	}
+	s.signDownload(attachment, now)
+	return attachment, nil
+}
+
+// Attachments returns the attachments of a todo, oldest first, with fresh
+// download links.
+func (s *Service) Attachments(ctx context.Context, todoID int64) ([]Attachment, error) {
+	if todoID <= 0 {
+		return nil, ErrInvalidID
+	}
+	if err := s.authorizeTodo(ctx, todoID, RoleViewer); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetByID(ctx, todoID); err != nil {
+		return nil, err
+	}
+	attachments, err := s.repo.ListAttachments(ctx, todoID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range attachments {
+		s.signDownload(&attachments[i], now)
+	}
+	return attachments, nil
+}
+
+// DeleteAttachment removes an attachment of a todo and its blob.
+func (s *Service) DeleteAttachment(ctx context.Context, todoID, id int64) error {
+	if todoID <= 0 || id <= 0 {
+		return ErrInvalidID
+	}
+	if err := s.authorizeTodo(ctx, todoID, RoleEditor); err != nil {
+		return err
+	}
+	attachment, err := s.repo.GetTodoAttachment(ctx, todoID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteAttachment(ctx, id); err != nil {
+		return err
+	}
+	if err := s.blobs.Delete(ctx, attachment.BlobKey); err != nil {
+		// The attachment is gone either way; only its storage leaks.
+		slog.Error("Failed to delete attachment blob", "key", attachment.BlobKey, "error", err)
+	}
+	return nil
+}
+
+// Download checks a signed download link and opens the attachment it names.
+// The caller must close the returned contents.
+func (s *Service) Download(ctx context.Context, id, expires int64, signature string) (*Attachment, io.ReadCloser, error) {
+	if id <= 0 {
+		return nil, nil, ErrInvalidID
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.downloadSignature(id, expires))) || time.Now().Unix() > expires {
+		return nil, nil, ErrInvalidDownloadURL
+	}
+	attachment, err := s.repo.GetAttachment(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := s.blobs.Get(ctx, attachment.BlobKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return attachment, body, nil
+}
+
+// CollectAttachments deletes the attachments, and their blobs, of todos
+// deleted longer ago than the undo window, and returns how many it deleted.
+func (s *Service) CollectAttachments(ctx context.Context) (int, error) {
+	deletedBefore := time.Now().Add(-s.undoWindow)
+	collected := 0
+	for {
+		orphans, err := s.repo.OrphanedAttachments(ctx, deletedBefore, collectBatchSize)
+		if err != nil {
+			return collected, err
+		}
+		for _, attachment := range orphans {
+			// The row goes last, so a blob that fails to delete is retried
+			// on the next run.
+			if err := s.blobs.Delete(ctx, attachment.BlobKey); err != nil {
+				return collected, err
+			}
+			if err := s.repo.DeleteAttachment(ctx, attachment.ID); err != nil {
+				return collected, err
+			}
+			collected++
+		}
+		if len(orphans) < collectBatchSize {
+			return collected, nil
+		}
+	}
+}
+
+// StartAttachmentCollector runs CollectAttachments every
+// ATTACHMENT_GC_INTERVAL for the lifetime of the application.
+func StartAttachmentCollector(lc fx.Lifecycle, service *Service) {
+	runEvery(lc, GetEnvDuration("ATTACHMENT_GC_INTERVAL", time.Hour), func(ctx context.Context) {
+		collected, err := service.CollectAttachments(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Failed to collect attachments", "error", err)
+		}
+		if collected > 0 {
+			slog.Info("Collected attachments of deleted todos", "attachments", collected)
+		}
+	})
+}
+
+// UploadAttachment serves POST /v1/todos/:id/attachments with the file in
+// the multipart field "file".
+func (h *Handler) UploadAttachment(c *gin.Context) {
+	todoID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	// Leave room for the multipart framing around the file.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.service.attachmentMaxBytes+1<<20)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			handleError(c, ErrAttachmentTooLarge)
+			return
+		}
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "file is required"})
+		return
+	}
+	f, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid file"})
+		return
+	}
+	defer f.Close()
+
+	attachment, err := h.service.Attach(c.Request.Context(), todoID, header.Filename, f, header.Size)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": attachment})
+}
+
+func (h *Handler) ListAttachments(c *gin.Context) {
+	todoID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+
+	attachments, err := h.service.Attachments(c.Request.Context(), todoID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": attachments})
+}
+
+func (h *Handler) DeleteAttachment(c *gin.Context) {
+	todoID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("attachment_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+
+	if err := h.service.DeleteAttachment(c.Request.Context(), todoID, id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// DownloadAttachment serves GET /v1/attachments/:id/download. The signed
+// link authenticates the request, so it needs no API key and can be opened
+// by a browser directly.
+func (h *Handler) DownloadAttachment(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		handleError(c, ErrInvalidDownloadURL)
+		return
+	}
+
+	attachment, body, err := h.service.Download(c.Request.Context(), id, expires, c.Query("signature"))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	defer body.Close()
+
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, body, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}),
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, no-store",
+	})
+}
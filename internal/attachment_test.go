@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniffAttachment(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	tests := []struct {
+		wantErr error
+		name    string
+		want    string
+		content []byte
+	}{
+		{name: "png", content: png, want: "image/png"},
+		{name: "pdf", content: []byte("%PDF-1.7\n"), want: "application/pdf"},
+		{name: "log", content: []byte("2026-10-19 ERROR failed\n"), want: "text/plain; charset=utf-8"},
+		{name: "gzip", content: []byte("\x1f\x8b\x08\x00"), want: "application/x-gzip"},
+		{name: "html", content: []byte("<html><script>alert(1)</script>"), wantErr: ErrAttachmentType},
+		{name: "executable", content: []byte("MZ\x90\x00\x03\x00\x00\x00"), wantErr: ErrAttachmentType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := bytes.NewReader(tt.content)
+			got, err := sniffAttachment(body)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, len(tt.content), body.Len(), "rewound")
+		})
+	}
+}
+
+func TestAttachmentFilename(t *testing.T) {
+	assert.Equal(t, "screenshot.png", attachmentFilename("screenshot.png"))
+	assert.Equal(t, "passwd", attachmentFilename("../../etc/passwd"))
+	assert.Equal(t, "build.log", attachmentFilename(`C:\Users\me\build.log`))
+	assert.Equal(t, "evil.txt", attachmentFilename("evil\r\n.txt"))
+	assert.Equal(t, "attachment", attachmentFilename(""))
+	assert.Equal(t, "attachment", attachmentFilename("/"))
+
+	long := attachmentFilename(strings.Repeat("ü", 200))
+	assert.LessOrEqual(t, len(long), 255)
+	assert.True(t, strings.HasPrefix(strings.Repeat("ü", 200), long))
+}
+
+func TestService_Attach_Validation(t *testing.T) {
+	service := &Service{repo: nil, attachmentMaxBytes: 1024}
+	ctx := context.Background()
+
+	tests := []struct {
+		wantErr error
+		name    string
+		content string
+		size    int64
+		todoID  int64
+	}{
+		{name: "invalid todo id", todoID: 0, content: "log", size: 3, wantErr: ErrInvalidID},
+		{name: "too large", todoID: 1, content: "log", size: 1025, wantErr: ErrAttachmentTooLarge},
+		{name: "empty", todoID: 1, content: "", size: 0, wantErr: ErrEmptyAttachment},
+		{name: "disallowed type", todoID: 1, content: "<!DOCTYPE html>", size: 15, wantErr: ErrAttachmentType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.Attach(ctx, tt.todoID, "f", strings.NewReader(tt.content), tt.size)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestService_Download_Signature(t *testing.T) {
+	service := &Service{repo: nil, downloadKey: []byte("secret"), downloadTTL: time.Minute}
+	ctx := context.Background()
+
+	attachment := &Attachment{ID: 7}
+	service.signDownload(attachment, time.Now())
+	link, err := url.Parse(attachment.DownloadURL)
+	require.NoError(t, err)
+	assert.Equal(t, "/v1/attachments/7/download", link.Path)
+	expires, err := strconv.ParseInt(link.Query().Get("expires"), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, attachment.DownloadExpiresAt.Unix(), expires)
+	signature := link.Query().Get("signature")
+	assert.Equal(t, service.downloadSignature(7, expires), signature)
+	expired := time.Now().Add(-time.Second).Unix()
+
+	tests := []struct {
+		name      string
+		signature string
+		id        int64
+		expires   int64
+	}{
+		{name: "other attachment", id: 8, expires: expires, signature: signature},
+		{name: "extended expiry", id: 7, expires: expires + 3600, signature: signature},
+		{name: "missing signature", id: 7, expires: expires, signature: ""},
+		{name: "expired", id: 7, expires: expired, signature: service.downloadSignature(7, expired)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := service.Download(ctx, tt.id, tt.expires, tt.signature)
+
+			assert.ErrorIs(t, err, ErrInvalidDownloadURL)
+		})
+	}
+}
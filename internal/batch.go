@@ -0,0 +1,299 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// BatchPatch is the change a batch update applies to every matching todo.
+// Titles are unique, so they cannot be batch updated. Setting status or
+// completed moves each todo within its own list's workflow.
+type BatchPatch struct {
+	Description *string    `json:"description"`
+	DueDate     *time.Time `json:"due_date"`
+	Completed   *bool      `json:"completed"`
+	Status      *string    `json:"status"`
+	Priority    *int       `json:"priority"`
+	Tags        *Tags      `json:"tags"`
+}
+
+func (p *BatchPatch) Validate() error {
+	if p.Description == nil && p.DueDate == nil && p.Completed == nil && p.Status == nil && p.Priority == nil && p.Tags == nil {
+		return ErrEmptyPatch
+	}
+	if err := validateStatus(p.Status); err != nil {
+		return err
+	}
+	if err := validatePriority(p.Priority); err != nil {
+		return err
+	}
+	if p.Tags != nil {
+		tags, err := normalizeTags(*p.Tags)
+		if err != nil {
+			return err
+		}
+		*p.Tags = tags
+	}
+	return nil
+}
+
+// apply returns a copy of todo with the patch applied.
+func (p BatchPatch) apply(todo *Todo, now time.Time) *Todo {
+	patched := *todo
+	if p.Description != nil {
+		patched.Description = *p.Description
+	}
+	if p.DueDate != nil {
+		patched.DueDate = p.DueDate
+	}
+	if p.Completed != nil {
+		patched.Completed = *p.Completed
+	}
+	if p.Status != nil {
+		patched.Status = *p.Status
+	}
+	if p.Priority != nil {
+		patched.Priority = p.Priority
+	}
+	if p.Tags != nil {
+		patched.Tags = *p.Tags
+	}
+	patched.UpdatedAt = now
+	return &patched
+}
+
+func (r *Repository) Count(ctx context.Context, filter TodoFilter) (int64, error) {
+	where, args := filter.where()
+	var count int64
+	err := r.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM todos"+where, args...)
+	return count, err
+}
+
+// lockMatching reads and locks every todo matching filter. It returns
+// ErrPreconditionFailed if their number is not expected.
+func lockMatching(ctx context.Context, tx *sqlx.Tx, filter TodoFilter, expected int) ([]*Todo, error) {
+	where, args := filter.where()
+	var todos []*Todo
+	if err := tx.SelectContext(ctx, &todos, "SELECT * FROM todos"+where+" ORDER BY id FOR UPDATE", args...); err != nil {
+		return nil, err
+	}
+	if len(todos) != expected {
+		return nil, ErrPreconditionFailed
+	}
+	return todos, nil
+}
+
+// BatchUpdate applies patch to every todo matching filter and returns the
+// updated todos. The matching rows are locked first, and nothing changes
+// unless there are exactly expected of them. A status change resolves to a
+// different state per list, so the rows are written like BulkUpdate's.
+func (r *Repository) BatchUpdate(ctx context.Context, op *Operation, filter TodoFilter, patch BatchPatch, expected int) ([]*Todo, error) {
+	updated := []*Todo{}
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := insertOperation(ctx, tx, op); err != nil {
+			return err
+		}
+		before, err := lockMatching(ctx, tx, filter, expected)
+		if err != nil {
+			return err
+		}
+		if len(before) == 0 {
+			return nil
+		}
+
+		for _, todo := range before {
+			updated = append(updated, patch.apply(todo, op.CreatedAt))
+		}
+		checks, err := enforceWorkflows(ctx, tx, before, updated)
+		if err != nil {
+			return err
+		}
+
+		events := make([]TodoEvent, 0, len(before))
+		for i, after := range updated {
+			stampCompletion(before[i], after, op.Actor, op.CreatedAt)
+			events = append(events, newTodoEvent(ctx, op, EventUpdated, before[i], after))
+		}
+		if err := updateTodos(ctx, tx, updated, op.CreatedAt); err != nil {
+			return err
+		}
+		if err := checkWIP(ctx, tx, checks); err != nil {
+			return err
+		}
+		return insertEvents(ctx, tx, events)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// BatchDelete removes every todo matching filter in one DELETE statement and
+// returns them as they were before. As with BatchUpdate, nothing is deleted
+// unless exactly expected todos match.
+func (r *Repository) BatchDelete(ctx context.Context, op *Operation, filter TodoFilter, expected int) ([]*Todo, error) {
+	deleted := []*Todo{}
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := insertOperation(ctx, tx, op); err != nil {
+			return err
+		}
+		before, err := lockMatching(ctx, tx, filter, expected)
+		if err != nil {
+			return err
+		}
+		if len(before) == 0 {
+			return nil
+		}
+
+		where, args := filter.where()
+		if _, err := tx.ExecContext(ctx, "DELETE FROM todos"+where, args...); err != nil {
+			return err
+		}
+
+		events := make([]TodoEvent, 0, len(before))
+		for _, todo := range before {
+			events = append(events, newTodoEvent(ctx, op, EventDeleted, todo, nil))
+		}
+		deleted = before
+		return insertEvents(ctx, tx, events)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// PreviewBatch returns how many todos a batch update or delete with filter
+// would affect. Its result is the expected count the batch itself requires.
+// Users only affect the todos of the lists they may edit.
+func (s *Service) PreviewBatch(ctx context.Context, filter TodoFilter) (int64, error) {
+	return s.repo.Count(ctx, visible(ctx, filter, RoleEditor))
+}
+
+// checkBatch enforces the dry-run preview and the safety cap on a batch.
+func (s *Service) checkBatch(expected *int) error {
+	if expected == nil || *expected < 0 {
+		return ErrPreviewRequired
+	}
+	if *expected > s.maxAffected {
+		return ErrTooManyMatches
+	}
+	return nil
+}
+
+func (s *Service) BatchUpdate(ctx context.Context, filter TodoFilter, patch BatchPatch, expected *int) ([]*Todo, *Operation, error) {
+	if err := patch.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if err := s.checkBatch(expected); err != nil {
+		return nil, nil, err
+	}
+
+	op := s.newOperation(ctx, OperationUpdate)
+	todos, err := s.repo.BatchUpdate(ctx, op, visible(ctx, filter, RoleEditor), patch, *expected)
+	if err != nil {
+		return nil, nil, err
+	}
+	return todos, op, nil
+}
+
+func (s *Service) BatchDelete(ctx context.Context, filter TodoFilter, expected *int) ([]*Todo, *Operation, error) {
+	if err := s.checkBatch(expected); err != nil {
+		return nil, nil, err
+	}
+
+	op := s.newOperation(ctx, OperationDelete)
+	todos, err := s.repo.BatchDelete(ctx, op, visible(ctx, filter, RoleEditor), *expected)
+	if err != nil {
+		return nil, nil, err
+	}
+	return todos, op, nil
+}
+
+// TodosAction serves the custom methods on the todo collection,
+// POST /v1/todos:batchUpdate and POST /v1/todos:batchDelete.
+func (h *Handler) TodosAction(c *gin.Context) {
+	switch c.Param("action") {
+	case ":batchUpdate":
+		h.BatchUpdate(c)
+	case ":batchDelete":
+		h.BatchDelete(c)
+	default:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: ErrNotFound.Error()})
+	}
+}
+
+// batchRequest is the body of a batch update or delete. Without dry_run it
+// must carry the expected_count returned by a dry run with the same filter.
+type batchRequest struct {
+	ExpectedCount *int       `json:"expected_count"`
+	Patch         BatchPatch `json:"patch"`
+	Filter        TodoFilter `json:"filter"`
+	DryRun        bool       `json:"dry_run"`
+}
+
+func (h *Handler) BatchUpdate(c *gin.Context) {
+	var body batchRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	if body.DryRun {
+		if err := body.Patch.Validate(); err != nil {
+			handleError(c, err)
+			return
+		}
+		h.previewBatch(c, body.Filter)
+		return
+	}
+
+	todos, op, err := h.service.BatchUpdate(c.Request.Context(), body.Filter, body.Patch, body.ExpectedCount)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": todos, "meta": operationMeta(op)})
+}
+
+func (h *Handler) BatchDelete(c *gin.Context) {
+	var body batchRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	if body.DryRun {
+		h.previewBatch(c, body.Filter)
+		return
+	}
+
+	todos, op, err := h.service.BatchDelete(c.Request.Context(), body.Filter, body.ExpectedCount)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": todos, "meta": operationMeta(op)})
+}
+
+func (h *Handler) previewBatch(c *gin.Context, filter TodoFilter) {
+	matched, err := h.service.PreviewBatch(c.Request.Context(), filter)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"dry_run":        true,
+			"expected_count": matched,
+			"max_affected":   h.service.maxAffected,
+		},
+	})
+}
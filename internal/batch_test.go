@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchPatch_Apply(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	completed := true
+	todo := &Todo{ID: 1, Title: "Pay rent", Description: "monthly"}
+
+	after := BatchPatch{Completed: &completed}.apply(todo, now)
+
+	assert.True(t, after.Completed)
+	assert.Equal(t, "monthly", after.Description)
+	assert.Equal(t, now, after.UpdatedAt)
+	assert.False(t, todo.Completed, "apply must not modify the original")
+}
+
+func TestService_BatchUpdate_Validation(t *testing.T) {
+	completed := true
+	tooMany, negative := 5, -1
+	service := &Service{repo: nil, maxAffected: 2}
+
+	tests := []struct {
+		expected *int
+		wantErr  error
+		patch    BatchPatch
+		name     string
+	}{
+		{name: "empty patch", patch: BatchPatch{}, expected: &tooMany, wantErr: ErrEmptyPatch},
+		{name: "no dry run", patch: BatchPatch{Completed: &completed}, wantErr: ErrPreviewRequired},
+		{name: "negative count", patch: BatchPatch{Completed: &completed}, expected: &negative, wantErr: ErrPreviewRequired},
+		{name: "over the cap", patch: BatchPatch{Completed: &completed}, expected: &tooMany, wantErr: ErrTooManyMatches},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := service.BatchUpdate(context.Background(), TodoFilter{}, tt.patch, tt.expected)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestHandler_TodosAction(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "unknown action",
+			path:           "/v1/todos:batchMerge",
+			body:           `{}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "invalid json",
+			path:           "/v1/todos:batchUpdate",
+			body:           "{invalid}",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "update without expected count",
+			path:           "/v1/todos:batchUpdate",
+			body:           `{"filter": {"completed": false}, "patch": {"completed": true}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "dry run with empty patch",
+			path:           "/v1/todos:batchUpdate",
+			body:           `{"filter": {"completed": false}, "dry_run": true}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "delete without expected count",
+			path:           "/v1/todos:batchDelete",
+			body:           `{"filter": {"q": "old"}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			handler := &Handler{service: &Service{repo: nil, maxAffected: 1000}}
+			handler.RegisterRoutes(r)
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package internal
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Blob backends, chosen with BLOB_BACKEND. The local backend keeps blobs in
+// a directory, which must be shared by every API instance; the S3 backend
+// works with AWS S3 and S3-compatible stores such as MinIO.
+const (
+	BlobLocal = "local"
+	BlobS3    = "s3"
+)
+
+// blobKeyPattern is what a blob key must look like. Keys are generated, so
+// they never need escaping in paths or URLs.
+var blobKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+(/[A-Za-z0-9_-]+)*$`)
+
+// BlobStore keeps the contents of attachments, addressed by key.
+type BlobStore interface {
+	// Put stores size bytes read from body under key, replacing any blob
+	// already there.
+	Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error
+	// Get opens the blob under key. It fails with ErrNotFound if there is
+	// none.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob under key, if there is one.
+	Delete(ctx context.Context, key string) error
+}
+
+// NewBlobStore returns the blob store configured by BLOB_BACKEND.
+func NewBlobStore() (BlobStore, error) {
+	switch backend := GetEnv("BLOB_BACKEND", BlobLocal); backend {
+	case BlobLocal:
+		return &localBlobStore{dir: GetEnv("BLOB_DIR", "data/attachments")}, nil
+	case BlobS3:
+		return newS3BlobStore(
+			GetEnv("S3_ENDPOINT", "https://s3.amazonaws.com"),
+			GetEnv("S3_BUCKET", ""),
+			GetEnv("S3_REGION", "us-east-1"),
+			GetEnv("S3_ACCESS_KEY", ""),
+			GetEnv("S3_SECRET_KEY", ""),
+		)
+	default:
+		return nil, fmt.Errorf("unknown BLOB_BACKEND %q", backend)
+	}
+}
+
+func checkBlobKey(key string) error {
+	if !blobKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
+
+// localBlobStore keeps each blob in a file under dir named by its key.
+type localBlobStore struct {
+	dir string
+}
+
+func (s *localBlobStore) path(key string) (string, error) {
+	if err := checkBlobKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file first, so that readers never see a
+// partial blob.
+func (s *localBlobStore) Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, io.LimitReader(body, size)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (s *localBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *localBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// s3BlobStore keeps blobs as objects of a bucket, addressed path-style as
+// endpoint/bucket/key so that it also works with S3-compatible stores that
+// have no per-bucket hostnames. Requests are signed with AWS Signature
+// Version 4.
+type s3BlobStore struct {
+	client    *http.Client
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+}
+
+func newS3BlobStore(endpoint, bucket, region, accessKey, secretKey string) (*s3BlobStore, error) {
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT %q", endpoint)
+	}
+	if bucket == "" || accessKey == "" || secretKey == "" {
+		return nil, errors.New("S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY are required")
+	}
+	return &s3BlobStore{
+		client:    &http.Client{Timeout: 5 * time.Minute},
+		endpoint:  u,
+		bucket:    bucket,
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+	}, nil
+}
+
+// emptyPayloadHash is the SHA-256 of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// do sends a signed request for the object under key. body may be nil.
+func (s *s3BlobStore) do(ctx context.Context, method, key string, body io.ReadSeeker, size int64, contentType string) (*http.Response, error) {
+	if err := checkBlobKey(key); err != nil {
+		return nil, err
+	}
+	u := *s.endpoint
+	u.Path += "/" + s.bucket + "/" + key
+
+	payloadHash := emptyPayloadHash
+	var reqBody io.Reader
+	if body != nil {
+		h := sha256.New()
+		if _, err := io.Copy(h, io.LimitReader(body, size)); err != nil {
+			return nil, err
+		}
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		payloadHash = hex.EncodeToString(h.Sum(nil))
+		// The caller owns body, so the transport must not close it.
+		reqBody = io.NopCloser(io.LimitReader(body, size))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signV4(req, payloadHash, s.accessKey, s.secretKey, s.region, time.Now())
+	return s.client.Do(req)
+}
+
+// s3Error returns an error describing a failed response and closes its body.
+func s3Error(resp *http.Response, method, key string) error {
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3 %s %s: %s: %s", method, key, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+func (s *s3BlobStore) Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, body, size, contentType)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp, http.MethodPut, key)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *s3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	default:
+		return nil, s3Error(resp, http.MethodGet, key)
+	}
+}
+
+func (s *s3BlobStore) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp, http.MethodDelete, key)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// signV4 signs req for S3 with AWS Signature Version 4, covering its host
+// and every header already set. payloadHash is the hex SHA-256 of the body.
+// The path must not need escaping and the query must be empty.
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		",SignedHeaders="+signedHeaders+",Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
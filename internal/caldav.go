@@ -0,0 +1,872 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// The CalDAV endpoint serves a single task collection. /dav/ is both the
+// principal and its calendar home, /dav/todos/ is the VTODO collection and
+// each todo is the resource /dav/todos/<uid>.ics.
+const (
+	davRoot       = "/dav/"
+	davCollection = "/dav/todos/"
+
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+
+	syncTokenPrefix = "urn:todox:sync:"
+)
+
+// syncTokenLag is how long before a sync token's event ChangesSince looks
+// back. Event IDs are allocated when events are inserted, but transactions
+// may commit in another order, so an event with a lower ID than the token
+// can become visible after the token was handed out. Such events are
+// recorded at about the same time as the token's, and reading them again
+// only sends their todos twice.
+const syncTokenLag = time.Minute
+
+// ETag returns the entity tag of a todo's calendar resource, derived from
+// its last update time.
+func ETag(t *Todo) string {
+	return `"` + strconv.FormatInt(t.UpdatedAt.UnixMicro(), 10) + `"`
+}
+
+func (r *Repository) GetByUID(ctx context.Context, uid string) (*Todo, error) {
+	var todo Todo
+	err := r.db.GetContext(ctx, &todo, "SELECT * FROM todos WHERE uid = ?", uid)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &todo, err
+}
+
+// DeleteByUID deletes the todo with the given UID as part of op. check is
+// called with its locked row before it is deleted, and its error aborts the
+// delete.
+func (r *Repository) DeleteByUID(ctx context.Context, op *Operation, uid string, check func(current *Todo) error) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		var current Todo
+		err := tx.GetContext(ctx, &current, "SELECT * FROM todos WHERE uid = ? FOR UPDATE", uid)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := check(&current); err != nil {
+			return err
+		}
+
+		if err := insertOperation(ctx, tx, op); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM todos WHERE id = ?", current.ID); err != nil {
+			return err
+		}
+		return insertEvents(ctx, tx, []TodoEvent{newTodoEvent(ctx, op, EventDeleted, &current, nil)})
+	})
+}
+
+// LatestEventID returns the ID of the most recent committed todo event,
+// which serves as the collection's sync token.
+func (r *Repository) LatestEventID(ctx context.Context) (int64, error) {
+	var id int64
+	err := r.db.GetContext(ctx, &id, "SELECT COALESCE(MAX(id), 0) FROM todo_events")
+	return id, err
+}
+
+// ChangesSince returns the todos matching filter that were changed by
+// events after since and up to until, and the UIDs of those that left the
+// collection: todos that were deleted or moved out of the lists filter is
+// narrowed to. Todos that left are only reported if filter matched them
+// before, so that hidden UIDs never show up. Events recorded up to
+// syncTokenLag before the event since are included again.
+func (r *Repository) ChangesSince(ctx context.Context, filter TodoFilter, since, until int64) ([]*Todo, []string, error) {
+	after, afterArgs, err := r.eventsAfter(ctx, since)
+	if err != nil {
+		return nil, nil, err
+	}
+	var todoIDs []int64
+	err = r.db.SelectContext(ctx, &todoIDs,
+		"SELECT DISTINCT todo_id FROM todo_events WHERE "+after+" AND id <= ?", append(afterArgs, until)...)
+	if err != nil || len(todoIDs) == 0 {
+		return nil, nil, err
+	}
+
+	conds, condArgs := filter.conds()
+	query, args, err := sqlx.In("SELECT * FROM todos WHERE "+strings.Join(append([]string{"id IN (?)"}, conds...), " AND "),
+		append([]any{todoIDs}, condArgs...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	var changed []*Todo
+	if err := r.db.SelectContext(ctx, &changed, r.db.Rebind(query), args...); err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[int64]bool, len(changed))
+	for _, t := range changed {
+		seen[t.ID] = true
+	}
+	var gone []int64
+	for _, id := range todoIDs {
+		if !seen[id] {
+			gone = append(gone, id)
+		}
+	}
+	if len(gone) == 0 {
+		return changed, nil, nil
+	}
+
+	var lists map[int64]bool
+	if filter.MemberID != nil {
+		if lists, err = r.memberLists(ctx, *filter.MemberID, filter.MemberRoles); err != nil {
+			return nil, nil, err
+		}
+	}
+	query, args, err = sqlx.In(`SELECT * FROM todo_events
+		WHERE todo_id IN (?) AND `+after+` AND id <= ? AND snapshot IS NOT NULL ORDER BY id`,
+		append(append([]any{gone}, afterArgs...), until)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	var events []TodoEvent
+	if err := r.db.SelectContext(ctx, &events, r.db.Rebind(query), args...); err != nil {
+		return nil, nil, err
+	}
+
+	deleted := []string{}
+	reported := make(map[int64]bool)
+	for _, e := range events {
+		before := e.Snapshot.Todo
+		if reported[e.TodoID] || before == nil || before.UID == "" {
+			continue
+		}
+		if lists != nil && (before.ListID == nil || !lists[*before.ListID]) {
+			continue
+		}
+		reported[e.TodoID] = true
+		deleted = append(deleted, before.UID)
+	}
+	return changed, deleted, nil
+}
+
+// eventsAfter returns the condition, and its arguments, that selects the
+// events after the sync token since, looking back syncTokenLag from its
+// event for those that committed late.
+func (r *Repository) eventsAfter(ctx context.Context, since int64) (string, []any, error) {
+	var at time.Time
+	err := r.db.GetContext(ctx, &at, "SELECT created_at FROM todo_events WHERE id = ?", since)
+	if err == sql.ErrNoRows {
+		return "id > ?", []any{since}, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return "(id > ? OR created_at >= ?)", []any{since, at.Add(-syncTokenLag)}, nil
+}
+
+// memberLists returns the lists a user has one of roles on.
+func (r *Repository) memberLists(ctx context.Context, userID int64, roles []string) (map[int64]bool, error) {
+	query, args, err := sqlx.In("SELECT list_id FROM list_members WHERE user_id = ? AND role IN (?)", userID, roles)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	if err := r.db.SelectContext(ctx, &ids, r.db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	lists := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		lists[id] = true
+	}
+	return lists, nil
+}
+
+// GetByUID returns the todo with the given UID if the caller can see it.
+func (s *Service) GetByUID(ctx context.Context, uid string) (*Todo, error) {
+	todo, err := s.repo.GetByUID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeTodo(ctx, todo.ID, RoleViewer); err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
+
+// checkPreconditions applies the If-Match and If-None-Match headers of a
+// write to the current state of a resource, which is nil if it does not
+// exist.
+func checkPreconditions(current *Todo, ifMatch, ifNoneMatch string) error {
+	if ifNoneMatch == "*" && current != nil {
+		return ErrPreconditionFailed
+	}
+	if ifMatch != "" && (current == nil || (ifMatch != "*" && ifMatch != ETag(current))) {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// PutCalendarTodo creates or replaces the todo with the given UID from a
+// VTODO. It reports whether the todo was created. The preconditions are
+// checked against the locked row, so concurrent writers cannot both pass.
+// Replacing a todo takes the editor role on its list. VTODOs carry no list,
+// so users cannot create todos this way.
+func (s *Service) PutCalendarTodo(ctx context.Context, item CalendarTodo, ifMatch, ifNoneMatch string) (*Todo, bool, error) {
+	todo := newTodo(item.CreateTodoInput, time.Now())
+	todo.UID = item.UID
+	todo.Completed = item.Completed
+
+	op := s.newOperation(ctx, OperationCreate)
+	created := true
+	err := s.repo.UpsertByUID(ctx, op, []*Todo{todo}, func(existing *Todo) error {
+		if existing == nil {
+			if err := s.authorizeNewTodos(ctx, []*int64{todo.ListID}); err != nil {
+				return err
+			}
+		} else {
+			if err := s.authorizeTodo(ctx, existing.ID, RoleEditor); err != nil {
+				return err
+			}
+			op.Kind, created = OperationUpdate, false
+		}
+		return checkPreconditions(existing, ifMatch, ifNoneMatch)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Re-read the todo so that its ETag matches the stored timestamp.
+	saved, err := s.repo.GetByID(ctx, todo.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	return saved, created, nil
+}
+
+// DeleteCalendarTodo deletes the todo with the given UID, which takes the
+// editor role on its list.
+func (s *Service) DeleteCalendarTodo(ctx context.Context, uid, ifMatch string) error {
+	return s.repo.DeleteByUID(ctx, s.newOperation(ctx, OperationDelete), uid, func(current *Todo) error {
+		if err := s.authorizeTodo(ctx, current.ID, RoleEditor); err != nil {
+			return err
+		}
+		return checkPreconditions(current, ifMatch, "")
+	})
+}
+
+// CollectionToken returns the collection's current sync token.
+func (s *Service) CollectionToken(ctx context.Context) (int64, error) {
+	return s.repo.LatestEventID(ctx)
+}
+
+// CollectionTodos calls fn for every todo in the collection, which holds the
+// todos the caller can see.
+func (s *Service) CollectionTodos(ctx context.Context, fn func(*Todo) error) error {
+	return s.repo.Stream(ctx, visible(ctx, TodoFilter{}, RoleViewer), fn)
+}
+
+// SyncChanges returns what changed in the collection since the sync token
+// since, and the new sync token. A zero token returns every todo the caller
+// can see.
+func (s *Service) SyncChanges(ctx context.Context, since int64) ([]*Todo, []string, int64, error) {
+	filter := visible(ctx, TodoFilter{}, RoleViewer)
+	token, err := s.repo.LatestEventID(ctx)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if since > token {
+		return nil, nil, 0, ErrInvalidSyncToken
+	}
+
+	if since == 0 {
+		var todos []*Todo
+		err := s.repo.Stream(ctx, filter, func(t *Todo) error {
+			todos = append(todos, t)
+			return nil
+		})
+		return todos, nil, token, err
+	}
+
+	changed, deleted, err := s.repo.ChangesSince(ctx, filter, since, token)
+	return changed, deleted, token, err
+}
+
+// xmlNode is a generic XML element used to read WebDAV request bodies.
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []xmlNode  `xml:",any"`
+	Text     string     `xml:",chardata"`
+}
+
+func (n *xmlNode) child(space, local string) *xmlNode {
+	for i := range n.Children {
+		if n.Children[i].XMLName.Space == space && n.Children[i].XMLName.Local == local {
+			return &n.Children[i]
+		}
+	}
+	return nil
+}
+
+func (n *xmlNode) attr(local string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// requestedProps returns the property names listed in a prop element, or
+// nil to request all properties.
+func requestedProps(n *xmlNode) []xml.Name {
+	if n == nil {
+		return nil
+	}
+	prop := n.child(nsDAV, "prop")
+	if prop == nil {
+		return nil
+	}
+	names := make([]xml.Name, 0, len(prop.Children))
+	for _, c := range prop.Children {
+		names = append(names, c.XMLName)
+	}
+	return names
+}
+
+// davProp is a property value rendered as inner XML.
+type davProp struct {
+	Name  xml.Name
+	Inner string
+}
+
+// davResponse is one response element of a multistatus body. A response
+// with a non-zero Status describes a resource without properties, such as a
+// deleted one.
+type davResponse struct {
+	Href    string
+	Found   []davProp
+	Missing []xml.Name
+	Status  int
+}
+
+// selectProps picks the requested properties out of all the properties of a
+// resource. A nil request selects all of them.
+func selectProps(href string, all []davProp, requested []xml.Name) davResponse {
+	resp := davResponse{Href: href}
+	if requested == nil {
+		resp.Found = all
+		return resp
+	}
+	for _, name := range requested {
+		found := false
+		for _, p := range all {
+			if p.Name == name {
+				resp.Found = append(resp.Found, p)
+				found = true
+				break
+			}
+		}
+		if !found {
+			resp.Missing = append(resp.Missing, name)
+		}
+	}
+	return resp
+}
+
+func writeMultistatus(c *gin.Context, responses []davResponse, syncToken string) {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(`<multistatus xmlns="DAV:">`)
+	for _, r := range responses {
+		b.WriteString("<response>" + hrefXML(r.Href))
+		if r.Status != 0 {
+			fmt.Fprintf(&b, "<status>HTTP/1.1 %d %s</status>", r.Status, http.StatusText(r.Status))
+		}
+		if len(r.Found) > 0 {
+			b.WriteString("<propstat><prop>")
+			for _, p := range r.Found {
+				writeElement(&b, p.Name, p.Inner)
+			}
+			b.WriteString("</prop><status>HTTP/1.1 200 OK</status></propstat>")
+		}
+		if len(r.Missing) > 0 {
+			b.WriteString("<propstat><prop>")
+			for _, name := range r.Missing {
+				writeElement(&b, name, "")
+			}
+			b.WriteString("</prop><status>HTTP/1.1 404 Not Found</status></propstat>")
+		}
+		b.WriteString("</response>")
+	}
+	if syncToken != "" {
+		b.WriteString("<sync-token>" + syncToken + "</sync-token>")
+	}
+	b.WriteString("</multistatus>")
+
+	c.Data(http.StatusMultiStatus, "application/xml; charset=utf-8", []byte(b.String()))
+}
+
+// writeElement writes an element in its own default namespace, so that
+// properties from any namespace can be echoed without prefix bookkeeping.
+func writeElement(b *strings.Builder, name xml.Name, inner string) {
+	ns := ""
+	if name.Space != "" && name.Space != nsDAV {
+		ns = ` xmlns="` + xmlEscape(name.Space) + `"`
+	}
+	if inner == "" {
+		b.WriteString("<" + name.Local + ns + "/>")
+		return
+	}
+	b.WriteString("<" + name.Local + ns + ">" + inner + "</" + name.Local + ">")
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func davName(space, local string) xml.Name {
+	return xml.Name{Space: space, Local: local}
+}
+
+func hrefXML(href string) string {
+	return "<href>" + xmlEscape(href) + "</href>"
+}
+
+func syncTokenURI(token int64) string {
+	return syncTokenPrefix + strconv.FormatInt(token, 10)
+}
+
+func parseSyncToken(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if !strings.HasPrefix(s, syncTokenPrefix) {
+		return 0, ErrInvalidSyncToken
+	}
+	token, err := strconv.ParseInt(strings.TrimPrefix(s, syncTokenPrefix), 10, 64)
+	if err != nil || token < 0 {
+		return 0, ErrInvalidSyncToken
+	}
+	return token, nil
+}
+
+func todoHref(uid string) string {
+	return davCollection + url.PathEscape(uid) + ".ics"
+}
+
+// uidFromHref returns the UID of the resource an href points to, accepting
+// both absolute URLs and paths.
+func uidFromHref(href string) (string, bool) {
+	if u, err := url.Parse(strings.TrimSpace(href)); err == nil {
+		href = u.EscapedPath()
+	}
+	dir, name := path.Split(href)
+	if dir != davCollection || !strings.HasSuffix(name, ".ics") {
+		return "", false
+	}
+	uid, err := url.PathUnescape(strings.TrimSuffix(name, ".ics"))
+	return uid, err == nil && uid != ""
+}
+
+func todoICS(todo *Todo) string {
+	var buf bytes.Buffer
+	enc := newICSEncoder(&buf)
+	_ = enc.Encode(todo)
+	_ = enc.Close()
+	return buf.String()
+}
+
+func principalProps() []davProp {
+	principal := hrefXML(davRoot)
+	return []davProp{
+		{davName(nsDAV, "resourcetype"), "<collection/><principal/>"},
+		{davName(nsDAV, "displayname"), "todox"},
+		{davName(nsDAV, "current-user-principal"), principal},
+		{davName(nsDAV, "principal-URL"), principal},
+		{davName(nsCalDAV, "calendar-home-set"), hrefXML(davRoot)},
+	}
+}
+
+func collectionProps(token int64) []davProp {
+	return []davProp{
+		{davName(nsDAV, "resourcetype"), `<collection/><calendar xmlns="` + nsCalDAV + `"/>`},
+		{davName(nsDAV, "displayname"), "todox"},
+		{davName(nsDAV, "current-user-principal"), hrefXML(davRoot)},
+		{davName(nsDAV, "owner"), hrefXML(davRoot)},
+		{davName(nsDAV, "current-user-privilege-set"),
+			"<privilege><read/></privilege><privilege><write/></privilege>" +
+				"<privilege><write-content/></privilege><privilege><bind/></privilege>" +
+				"<privilege><unbind/></privilege>"},
+		{davName(nsDAV, "supported-report-set"),
+			`<supported-report><report><calendar-query xmlns="` + nsCalDAV + `"/></report></supported-report>` +
+				`<supported-report><report><calendar-multiget xmlns="` + nsCalDAV + `"/></report></supported-report>` +
+				"<supported-report><report><sync-collection/></report></supported-report>"},
+		{davName(nsDAV, "sync-token"), syncTokenURI(token)},
+		{davName(nsCS, "getctag"), syncTokenURI(token)},
+		{davName(nsCalDAV, "supported-calendar-component-set"), `<comp xmlns="` + nsCalDAV + `" name="VTODO"/>`},
+	}
+}
+
+// todoProps returns the properties of a todo resource. Calendar data is only
+// included when it is asked for explicitly.
+func todoProps(todo *Todo, requested []xml.Name) []davProp {
+	props := []davProp{
+		{davName(nsDAV, "resourcetype"), ""},
+		{davName(nsDAV, "getetag"), xmlEscape(ETag(todo))},
+		{davName(nsDAV, "getcontenttype"), "text/calendar; charset=utf-8; component=VTODO"},
+		{davName(nsDAV, "getlastmodified"), todo.UpdatedAt.UTC().Format(http.TimeFormat)},
+		{davName(nsDAV, "displayname"), xmlEscape(todo.Title)},
+	}
+	for _, name := range requested {
+		if name == davName(nsCalDAV, "calendar-data") {
+			props = append(props, davProp{name, xmlEscape(todoICS(todo))})
+		}
+	}
+	return props
+}
+
+func (h *Handler) registerCalDAV(r *gin.Engine) {
+	r.GET("/.well-known/caldav", func(c *gin.Context) {
+		c.Redirect(http.StatusMovedPermanently, davRoot)
+	})
+
+	dav := r.Group("/dav")
+	{
+		dav.Handle(http.MethodOptions, "/", h.DAVOptions)
+		dav.Handle("PROPFIND", "/", h.PropfindPrincipal)
+
+		dav.Handle(http.MethodOptions, "/todos/", h.DAVOptions)
+		dav.Handle("PROPFIND", "/todos/", h.PropfindCollection)
+		dav.Handle("REPORT", "/todos/", h.ReportCollection)
+		dav.GET("/todos/", h.CalendarFeed)
+
+		dav.Handle(http.MethodOptions, "/todos/:resource", h.DAVOptions)
+		dav.Handle("PROPFIND", "/todos/:resource", h.PropfindTodo)
+		dav.GET("/todos/:resource", h.GetCalendarTodo)
+		dav.PUT("/todos/:resource", h.PutCalendarTodo)
+		dav.DELETE("/todos/:resource", h.DeleteCalendarTodo)
+	}
+}
+
+func (h *Handler) DAVOptions(c *gin.Context) {
+	c.Header("DAV", "1, 3, calendar-access")
+	c.Header("Allow", "OPTIONS, GET, PUT, DELETE, PROPFIND, REPORT")
+	c.Status(http.StatusOK)
+}
+
+// readDAVBody parses an optional XML request body. It writes a 400 response
+// and returns false if the body is malformed.
+func readDAVBody(c *gin.Context) (*xmlNode, bool) {
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil || len(bytes.TrimSpace(data)) == 0 {
+		return nil, err == nil
+	}
+	var n xmlNode
+	if err := xml.Unmarshal(data, &n); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid XML body"})
+		return nil, false
+	}
+	return &n, true
+}
+
+func davDepth(c *gin.Context) string {
+	if d := c.GetHeader("Depth"); d == "0" {
+		return d
+	}
+	return "1"
+}
+
+func (h *Handler) PropfindPrincipal(c *gin.Context) {
+	body, ok := readDAVBody(c)
+	if !ok {
+		return
+	}
+	requested := requestedProps(body)
+
+	responses := []davResponse{selectProps(davRoot, principalProps(), requested)}
+	if davDepth(c) == "1" {
+		token, err := h.service.CollectionToken(c.Request.Context())
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+		responses = append(responses, selectProps(davCollection, collectionProps(token), requested))
+	}
+	writeMultistatus(c, responses, "")
+}
+
+func (h *Handler) PropfindCollection(c *gin.Context) {
+	body, ok := readDAVBody(c)
+	if !ok {
+		return
+	}
+	requested := requestedProps(body)
+	ctx := c.Request.Context()
+
+	token, err := h.service.CollectionToken(ctx)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	responses := []davResponse{selectProps(davCollection, collectionProps(token), requested)}
+	if davDepth(c) == "1" {
+		err := h.service.CollectionTodos(ctx, func(t *Todo) error {
+			responses = append(responses, selectProps(todoHref(t.UID), todoProps(t, requested), requested))
+			return nil
+		})
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+	}
+	writeMultistatus(c, responses, "")
+}
+
+func (h *Handler) PropfindTodo(c *gin.Context) {
+	body, ok := readDAVBody(c)
+	if !ok {
+		return
+	}
+	todo, ok := h.davTodo(c)
+	if !ok {
+		return
+	}
+	requested := requestedProps(body)
+	writeMultistatus(c, []davResponse{selectProps(todoHref(todo.UID), todoProps(todo, requested), requested)}, "")
+}
+
+// davTodo loads the todo named by the resource path parameter. It writes an
+// error response and returns false if there is none.
+func (h *Handler) davTodo(c *gin.Context) (*Todo, bool) {
+	uid, ok := uidFromHref(davCollection + url.PathEscape(c.Param("resource")))
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return nil, false
+	}
+	todo, err := h.service.GetByUID(c.Request.Context(), uid)
+	if err != nil {
+		handleError(c, err)
+		return nil, false
+	}
+	return todo, true
+}
+
+func (h *Handler) GetCalendarTodo(c *gin.Context) {
+	todo, ok := h.davTodo(c)
+	if !ok {
+		return
+	}
+	c.Header("ETag", ETag(todo))
+	c.Header("Last-Modified", todo.UpdatedAt.UTC().Format(http.TimeFormat))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(todoICS(todo)))
+}
+
+func (h *Handler) PutCalendarTodo(c *gin.Context) {
+	uid, ok := uidFromHref(davCollection + url.PathEscape(c.Param("resource")))
+	if !ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "resource name must end in .ics"})
+		return
+	}
+
+	items, err := ParseCalendarTodos(c.Request.Body)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	if len(items) != 1 {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "resource must contain exactly one VTODO"})
+		return
+	}
+	if items[0].UID != uid {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "UID does not match resource name"})
+		return
+	}
+
+	todo, created, err := h.service.PutCalendarTodo(c.Request.Context(), items[0],
+		c.GetHeader("If-Match"), c.GetHeader("If-None-Match"))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Header("ETag", ETag(todo))
+	if created {
+		c.Status(http.StatusCreated)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) DeleteCalendarTodo(c *gin.Context) {
+	uid, ok := uidFromHref(davCollection + url.PathEscape(c.Param("resource")))
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	if err := h.service.DeleteCalendarTodo(c.Request.Context(), uid, c.GetHeader("If-Match")); err != nil {
+		handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) ReportCollection(c *gin.Context) {
+	body, ok := readDAVBody(c)
+	if !ok {
+		return
+	}
+	if body == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "missing report body"})
+		return
+	}
+
+	switch body.XMLName {
+	case davName(nsCalDAV, "calendar-query"):
+		h.calendarQuery(c, body)
+	case davName(nsCalDAV, "calendar-multiget"):
+		h.calendarMultiget(c, body)
+	case davName(nsDAV, "sync-collection"):
+		h.syncCollection(c, body)
+	default:
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "unsupported report"})
+	}
+}
+
+// calendarQuery answers a calendar-query report. Only VTODO components
+// exist, so a filter on any other component matches nothing. A time-range
+// on VTODO is applied to the due date, and todos without one always match.
+func (h *Handler) calendarQuery(c *gin.Context, body *xmlNode) {
+	requested := requestedProps(body)
+
+	var (
+		start, end *time.Time
+		matchNone  bool
+	)
+	if filter := body.child(nsCalDAV, "filter"); filter != nil {
+		cal := filter.child(nsCalDAV, "comp-filter")
+		if cal == nil || !strings.EqualFold(cal.attr("name"), "VCALENDAR") {
+			matchNone = cal != nil
+		} else if comp := cal.child(nsCalDAV, "comp-filter"); comp != nil {
+			if !strings.EqualFold(comp.attr("name"), "VTODO") {
+				matchNone = true
+			} else if tr := comp.child(nsCalDAV, "time-range"); tr != nil {
+				var err error
+				if start, err = parseTimeRangeAttr(tr.attr("start")); err == nil {
+					end, err = parseTimeRangeAttr(tr.attr("end"))
+				}
+				if err != nil {
+					c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid time-range"})
+					return
+				}
+			}
+		}
+	}
+
+	responses := []davResponse{}
+	if !matchNone {
+		err := h.service.CollectionTodos(c.Request.Context(), func(t *Todo) error {
+			if t.DueDate != nil && ((start != nil && t.DueDate.Before(*start)) || (end != nil && !t.DueDate.Before(*end))) {
+				return nil
+			}
+			responses = append(responses, selectProps(todoHref(t.UID), todoProps(t, requested), requested))
+			return nil
+		})
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+	}
+	writeMultistatus(c, responses, "")
+}
+
+func parseTimeRangeAttr(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(icsTimeLayout, v)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (h *Handler) calendarMultiget(c *gin.Context, body *xmlNode) {
+	requested := requestedProps(body)
+	ctx := c.Request.Context()
+
+	responses := []davResponse{}
+	for _, child := range body.Children {
+		if child.XMLName != davName(nsDAV, "href") {
+			continue
+		}
+		href := strings.TrimSpace(child.Text)
+		uid, ok := uidFromHref(href)
+		if !ok {
+			responses = append(responses, davResponse{Href: href, Status: http.StatusNotFound})
+			continue
+		}
+		todo, err := h.service.GetByUID(ctx, uid)
+		if errors.Is(err, ErrNotFound) {
+			responses = append(responses, davResponse{Href: href, Status: http.StatusNotFound})
+			continue
+		}
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+		responses = append(responses, selectProps(todoHref(todo.UID), todoProps(todo, requested), requested))
+	}
+	writeMultistatus(c, responses, "")
+}
+
+func (h *Handler) syncCollection(c *gin.Context, body *xmlNode) {
+	requested := requestedProps(body)
+
+	since := int64(0)
+	if tokenNode := body.child(nsDAV, "sync-token"); tokenNode != nil {
+		var err error
+		if since, err = parseSyncToken(tokenNode.Text); err != nil {
+			handleError(c, err)
+			return
+		}
+	}
+
+	changed, deleted, token, err := h.service.SyncChanges(c.Request.Context(), since)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	responses := make([]davResponse, 0, len(changed)+len(deleted))
+	for _, t := range changed {
+		responses = append(responses, selectProps(todoHref(t.UID), todoProps(t, requested), requested))
+	}
+	for _, uid := range deleted {
+		responses = append(responses, davResponse{Href: todoHref(uid), Status: http.StatusNotFound})
+	}
+	writeMultistatus(c, responses, syncTokenURI(token))
+}
@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUIDFromHref(t *testing.T) {
+	tests := []struct {
+		href string
+		uid  string
+		ok   bool
+	}{
+		{href: "/dav/todos/abc%40todox.ics", uid: "abc@todox", ok: true},
+		{href: "https://todox.example.com/dav/todos/abc.ics", uid: "abc", ok: true},
+		{href: "/dav/todos/a%2Fb.ics", uid: "a/b", ok: true},
+		{href: "/dav/todos/abc", ok: false},
+		{href: "/dav/other/abc.ics", ok: false},
+		{href: "/dav/todos/.ics", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.href, func(t *testing.T) {
+			uid, ok := uidFromHref(tt.href)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.uid, uid)
+		})
+	}
+
+	uid, ok := uidFromHref(todoHref("x/y@todox"))
+	assert.True(t, ok)
+	assert.Equal(t, "x/y@todox", uid)
+}
+
+func TestParseSyncToken(t *testing.T) {
+	token, err := parseSyncToken(syncTokenURI(42))
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), token)
+
+	token, err = parseSyncToken("")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), token)
+
+	for _, bad := range []string{"42", "urn:todox:sync:x", "urn:todox:sync:-1"} {
+		_, err := parseSyncToken(bad)
+		assert.ErrorIs(t, err, ErrInvalidSyncToken, bad)
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	current := &Todo{UpdatedAt: time.UnixMicro(1234)}
+
+	tests := []struct {
+		current     *Todo
+		name        string
+		ifMatch     string
+		ifNoneMatch string
+		wantErr     bool
+	}{
+		{name: "create without headers", current: nil},
+		{name: "create only on new resource", current: nil, ifNoneMatch: "*"},
+		{name: "create only on existing resource", current: current, ifNoneMatch: "*", wantErr: true},
+		{name: "matching etag", current: current, ifMatch: `"1234"`},
+		{name: "stale etag", current: current, ifMatch: `"1"`, wantErr: true},
+		{name: "if-match on missing resource", current: nil, ifMatch: "*", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPreconditions(tt.current, tt.ifMatch, tt.ifNoneMatch)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrPreconditionFailed)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSelectProps(t *testing.T) {
+	all := []davProp{
+		{davName(nsDAV, "displayname"), "todox"},
+		{davName(nsDAV, "getetag"), `"1"`},
+	}
+
+	resp := selectProps("/dav/todos/", all, []xml.Name{
+		davName(nsDAV, "getetag"),
+		davName(nsCS, "getctag"),
+	})
+
+	assert.Equal(t, []davProp{{davName(nsDAV, "getetag"), `"1"`}}, resp.Found)
+	assert.Equal(t, []xml.Name{davName(nsCS, "getctag")}, resp.Missing)
+	assert.Equal(t, all, selectProps("/dav/todos/", all, nil).Found)
+}
+
+func TestHandler_PropfindPrincipal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CORSMiddleware())
+	handler := &Handler{service: &Service{repo: nil}}
+	handler.RegisterRoutes(r)
+
+	body := `<?xml version="1.0"?>
+<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:current-user-principal/><c:calendar-home-set/><d:quota-used-bytes/></d:prop>
+</d:propfind>`
+	req := httptest.NewRequest("PROPFIND", "/dav/", strings.NewReader(body))
+	req.Header.Set("Depth", "0")
+	rec := httptest.NewRecorder()
+
+	r.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusMultiStatus, rec.Code)
+
+	var ms struct {
+		Responses []struct {
+			Href      string `xml:"href"`
+			Propstats []struct {
+				Prop struct {
+					Principal string `xml:"current-user-principal>href"`
+					Home      string `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set>href"`
+				} `xml:"prop"`
+				Status string `xml:"status"`
+			} `xml:"propstat"`
+		} `xml:"response"`
+	}
+	require.NoError(t, xml.Unmarshal(rec.Body.Bytes(), &ms))
+	require.Len(t, ms.Responses, 1)
+	resp := ms.Responses[0]
+	assert.Equal(t, "/dav/", resp.Href)
+	require.Len(t, resp.Propstats, 2)
+	assert.Equal(t, "/dav/", resp.Propstats[0].Prop.Principal)
+	assert.Equal(t, "/dav/", resp.Propstats[0].Prop.Home)
+	assert.Equal(t, "HTTP/1.1 200 OK", resp.Propstats[0].Status)
+	assert.Equal(t, "HTTP/1.1 404 Not Found", resp.Propstats[1].Status)
+}
+
+func TestHandler_DAVOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CORSMiddleware())
+	handler := &Handler{service: &Service{repo: nil}}
+	handler.RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodOptions, "/dav/todos/", nil)
+	rec := httptest.NewRecorder()
+
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("DAV"), "calendar-access")
+}
+
+func TestRepository_ChangesSince_LateCommit(t *testing.T) {
+	repo := benchRepository(t)
+	ctx := WithActor(context.Background(), benchActor)
+	todos := benchTodos(0, 2)
+
+	// The first todo's event stands for one that committed after the
+	// token was read, though its ID is lower.
+	require.NoError(t, repo.BulkCreate(ctx, benchOperation(OperationCreate), todos[:1]))
+	require.NoError(t, repo.BulkCreate(ctx, benchOperation(OperationCreate), todos[1:]))
+	token, err := repo.LatestEventID(ctx)
+	require.NoError(t, err)
+
+	changed, deleted, err := repo.ChangesSince(ctx, TodoFilter{}, token, token)
+	require.NoError(t, err)
+	ids := make([]int64, 0, len(changed))
+	for _, todo := range changed {
+		ids = append(ids, todo.ID)
+	}
+	assert.Contains(t, ids, todos[0].ID)
+	assert.Contains(t, ids, todos[1].ID)
+	assert.Empty(t, deleted)
+}
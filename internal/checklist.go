@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ChecklistTodo is a todo read from a plain-text checklist (todo.txt or
+// Markdown). Unlike the structured formats, checklists record whether an item
+// is done and, for todo.txt, when it was created.
+type ChecklistTodo struct {
+	CreatedAt *time.Time
+	CreateTodoInput
+	Completed bool
+}
+
+// ParseChecklist reads todos from a todo.txt or Markdown checklist and
+// validates each. If any item is invalid it returns an *ImportError listing
+// all of them, numbered in the order the items appear.
+func ParseChecklist(r io.Reader, format string) ([]ChecklistTodo, error) {
+	var (
+		items []ChecklistTodo
+		rows  []RowError
+		err   error
+	)
+	switch format {
+	case FormatTodoTxt:
+		items, rows, err = parseTodoTxt(r)
+	case FormatMarkdown:
+		items, rows, err = parseMarkdown(r)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateRows(len(items), func(i int) *CreateTodoInput { return &items[i].CreateTodoInput }, rows); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ImportChecklist creates the todos of a todo.txt or Markdown checklist in a
+// single import operation, keeping their completion state and creation date.
+func (s *Service) ImportChecklist(ctx context.Context, r io.Reader, format string) ([]*Todo, *Operation, error) {
+	items, err := ParseChecklist(r, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(items) == 0 {
+		return nil, nil, ErrEmptyList
+	}
+
+	seen := make(map[string]bool)
+	now := time.Now()
+	todos := make([]*Todo, 0, len(items))
+	for _, item := range items {
+		if seen[item.Title] {
+			return nil, nil, ErrDuplicateInRequest
+		}
+		seen[item.Title] = true
+
+		todo := newTodo(item.CreateTodoInput, now)
+		todo.Completed = item.Completed
+		if item.CreatedAt != nil {
+			todo.CreatedAt = *item.CreatedAt
+		}
+		todos = append(todos, todo)
+	}
+	if err := s.authorizeNewTodos(ctx, todoListIDs(todos)); err != nil {
+		return nil, nil, err
+	}
+
+	op := s.newOperation(ctx, OperationImport)
+	if err := s.repo.BulkCreate(ctx, op, todos); err != nil {
+		return nil, nil, err
+	}
+	return todos, op, nil
+}
@@ -0,0 +1,602 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// maxCommentLength caps the length of a comment body, in characters.
+const maxCommentLength = 10000
+
+// maxMentions caps the number of actors one comment may mention.
+const maxMentions = 20
+
+// mentionPattern matches an @mention at the start of a body or after a
+// character that cannot be part of a word or email address, so that
+// alice@example.com mentions nobody.
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_.@])@([A-Za-z0-9][A-Za-z0-9._-]*)`)
+
+// Comment is a message in the discussion of a todo. Comments are kept when
+// their todo is deleted, so undoing the delete restores them too.
+type Comment struct {
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	Author    string    `json:"author" db:"author"`
+	Body      string    `json:"body" db:"body"`
+	ID        int64     `json:"id" db:"id"`
+	TodoID    int64     `json:"todo_id" db:"todo_id"`
+}
+
+// CommentInput creates or edits a comment.
+type CommentInput struct {
+	Body string `json:"body"`
+}
+
+func (in *CommentInput) Validate() error {
+	if strings.TrimSpace(in.Body) == "" || utf8.RuneCountInString(in.Body) > maxCommentLength {
+		return ErrInvalidComment
+	}
+	return nil
+}
+
+// Mention is an entry of an actor's inbox: a comment that mentions them.
+// ReadAt is null until they mark it as read.
+type Mention struct {
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	ReadAt    *time.Time `json:"read_at" db:"read_at"`
+	Actor     string     `json:"-" db:"actor"`
+	Author    string     `json:"author" db:"author"`
+	Body      string     `json:"body" db:"body"`
+	ID        int64      `json:"id" db:"id"`
+	CommentID int64      `json:"comment_id" db:"comment_id"`
+	TodoID    int64      `json:"todo_id" db:"todo_id"`
+}
+
+// MarkReadInput marks the caller's mentions with the given IDs as read, or
+// all of them.
+type MarkReadInput struct {
+	IDs []int64 `json:"ids"`
+	All bool    `json:"all"`
+}
+
+func (in *MarkReadInput) Validate() error {
+	if in.All == (len(in.IDs) > 0) {
+		return ErrInvalidMarkRead
+	}
+	if len(in.IDs) > 100 {
+		return ErrLimitExceeded
+	}
+	for _, id := range in.IDs {
+		if id <= 0 {
+			return ErrInvalidID
+		}
+	}
+	return nil
+}
+
+// parseMentions returns the actors body mentions, in order of first
+// mention, leaving out the author. Trailing punctuation is not part of a
+// name, so "thanks @bob." mentions bob.
+func parseMentions(body, author string) ([]string, error) {
+	var actors []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		actor := strings.TrimRight(match[1], "._-")
+		if actor == author || len(actor) > 255 || slices.Contains(actors, actor) {
+			continue
+		}
+		actors = append(actors, actor)
+	}
+	if len(actors) > maxMentions {
+		return nil, ErrTooManyMentions
+	}
+	return actors, nil
+}
+
+// encodeCursor returns the opaque cursor of the page that follows the row
+// with the given ID.
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+// decodeCursor returns the row ID a cursor from encodeCursor continues
+// after, or 0 for the empty cursor of the first page.
+func decodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
+
+// nextPage trims rows, read with one row more than limit, to limit and
+// returns the cursor of the page after them, or "" if there is none.
+func nextPage[T any](rows []T, limit int, id func(T) int64) ([]T, string) {
+	if len(rows) <= limit {
+		return rows, ""
+	}
+	rows = rows[:limit]
+	return rows, encodeCursor(id(rows[limit-1]))
+}
+
+// CreateComment adds comment to its todo and notifies the mentioned actors.
+func (r *Repository) CreateComment(ctx context.Context, comment *Comment, mentions []string) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		var found int64
+		err := tx.GetContext(ctx, &found, "SELECT id FROM todos WHERE id = ? FOR SHARE", comment.TodoID)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.NamedExecContext(ctx,
+			`INSERT INTO comments (todo_id, author, body, created_at, updated_at)
+			VALUES (:todo_id, :author, :body, :created_at, :updated_at)`, comment)
+		if err != nil {
+			return err
+		}
+		if comment.ID, err = result.LastInsertId(); err != nil {
+			return fmt.Errorf("failed to get last insert ID: %w", err)
+		}
+		return insertMentions(ctx, tx, comment, mentions)
+	})
+}
+
+// insertMentions adds a mention of comment for each actor that does not have
+// one yet. Existing mentions keep their read state.
+func insertMentions(ctx context.Context, tx *sqlx.Tx, comment *Comment, actors []string) error {
+	if len(actors) == 0 {
+		return nil
+	}
+	mentions := make([]Mention, len(actors))
+	for i, actor := range actors {
+		mentions[i] = Mention{CommentID: comment.ID, TodoID: comment.TodoID, Actor: actor, CreatedAt: comment.UpdatedAt}
+	}
+	_, err := tx.NamedExecContext(ctx,
+		`INSERT INTO mentions (comment_id, todo_id, actor, created_at)
+		VALUES (:comment_id, :todo_id, :actor, :created_at)
+		ON DUPLICATE KEY UPDATE id = id`, mentions)
+	return err
+}
+
+func (r *Repository) GetComment(ctx context.Context, todoID, id int64) (*Comment, error) {
+	var comment Comment
+	err := r.db.GetContext(ctx, &comment, "SELECT * FROM comments WHERE id = ? AND todo_id = ?", id, todoID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &comment, err
+}
+
+// ListComments returns up to limit comments of a todo that follow the one
+// with ID after, oldest first.
+func (r *Repository) ListComments(ctx context.Context, todoID, after int64, limit int) ([]Comment, error) {
+	comments := []Comment{}
+	err := r.db.SelectContext(ctx, &comments,
+		"SELECT * FROM comments WHERE todo_id = ? AND id > ? ORDER BY id LIMIT ?", todoID, after, limit)
+	return comments, err
+}
+
+// UpdateComment writes comment's body and replaces its mentions with the
+// given actors.
+func (r *Repository) UpdateComment(ctx context.Context, comment *Comment, mentions []string) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		result, err := tx.NamedExecContext(ctx,
+			"UPDATE comments SET body = :body, updated_at = :updated_at WHERE id = :id", comment)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		query, args := "DELETE FROM mentions WHERE comment_id = ?", []any{comment.ID}
+		if len(mentions) > 0 {
+			if query, args, err = sqlx.In(query+" AND actor NOT IN (?)", comment.ID, mentions); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, tx.Rebind(query), args...); err != nil {
+			return err
+		}
+		return insertMentions(ctx, tx, comment, mentions)
+	})
+}
+
+func (r *Repository) DeleteComment(ctx context.Context, id int64) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM mentions WHERE comment_id = ?", id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM comments WHERE id = ?", id)
+		return err
+	})
+}
+
+// mentionVisible is the SQL condition that a mention's todo is in a list
+// the user it takes as argument is a member of.
+const mentionVisible = ` AND EXISTS (SELECT 1 FROM todos t JOIN list_members lm ON lm.list_id = t.list_id
+	WHERE t.id = m.todo_id AND lm.user_id = ?)`
+
+// ListMentions returns up to limit of actor's mentions older than the one
+// with ID before, newest first. Unless all is set, only unread ones. With a
+// member, only mentions on todos of that user's lists are returned.
+func (r *Repository) ListMentions(ctx context.Context, actor string, member *int64, before int64, all bool, limit int) ([]Mention, error) {
+	query := `SELECT m.id, m.comment_id, m.todo_id, m.actor, m.created_at, m.read_at, c.author, c.body
+		FROM mentions m JOIN comments c ON c.id = m.comment_id
+		WHERE m.actor = ?`
+	args := []any{actor}
+	if member != nil {
+		query += mentionVisible
+		args = append(args, *member)
+	}
+	if !all {
+		query += " AND m.read_at IS NULL"
+	}
+	if before > 0 {
+		query += " AND m.id < ?"
+		args = append(args, before)
+	}
+
+	mentions := []Mention{}
+	err := r.db.SelectContext(ctx, &mentions, query+" ORDER BY m.id DESC LIMIT ?", append(args, limit)...)
+	return mentions, err
+}
+
+// CountUnreadMentions counts actor's unread mentions, with a member only
+// those on todos of that user's lists.
+func (r *Repository) CountUnreadMentions(ctx context.Context, actor string, member *int64) (int64, error) {
+	query, args := "SELECT COUNT(*) FROM mentions m WHERE m.actor = ? AND m.read_at IS NULL", []any{actor}
+	if member != nil {
+		query += mentionVisible
+		args = append(args, *member)
+	}
+	var count int64
+	err := r.db.GetContext(ctx, &count, query, args...)
+	return count, err
+}
+
+// MarkMentionsRead marks actor's unread mentions with the given IDs, or all
+// of them if ids is empty, as read at now and returns how many it marked.
+func (r *Repository) MarkMentionsRead(ctx context.Context, actor string, ids []int64, now time.Time) (int64, error) {
+	query, args := "UPDATE mentions SET read_at = ? WHERE actor = ? AND read_at IS NULL", []any{now, actor}
+	if len(ids) > 0 {
+		var err error
+		if query, args, err = sqlx.In(query+" AND id IN (?)", now, actor, ids); err != nil {
+			return 0, err
+		}
+	}
+	result, err := r.db.ExecContext(ctx, r.db.Rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CreateComment adds a comment by the caller to a todo. Actors the body
+// @mentions find it in their inbox.
+func (s *Service) CreateComment(ctx context.Context, todoID int64, input CommentInput) (*Comment, error) {
+	if todoID <= 0 {
+		return nil, ErrInvalidID
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	author := ActorFromContext(ctx)
+	mentions, err := parseMentions(input.Body, author)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeTodo(ctx, todoID, RoleEditor); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	comment := &Comment{TodoID: todoID, Author: author, Body: input.Body, CreatedAt: now, UpdatedAt: now}
+	if err := s.repo.CreateComment(ctx, comment, mentions); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// Comments returns a page of a todo's comments, oldest first, and the cursor
+// of the next page.
+func (s *Service) Comments(ctx context.Context, todoID int64, cursor string, limit int) ([]Comment, string, error) {
+	if todoID <= 0 {
+		return nil, "", ErrInvalidID
+	}
+	_, limit, err := normalizePage(1, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.authorizeTodo(ctx, todoID, RoleViewer); err != nil {
+		return nil, "", err
+	}
+	if _, err := s.repo.GetByID(ctx, todoID); err != nil {
+		return nil, "", err
+	}
+
+	comments, err := s.repo.ListComments(ctx, todoID, after, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	comments, next := nextPage(comments, limit, func(c Comment) int64 { return c.ID })
+	return comments, next, nil
+}
+
+// ownComment returns a comment of a todo if the caller wrote it.
+func (s *Service) ownComment(ctx context.Context, todoID, id int64) (*Comment, error) {
+	if todoID <= 0 || id <= 0 {
+		return nil, ErrInvalidID
+	}
+	if err := s.authorizeTodo(ctx, todoID, RoleViewer); err != nil {
+		return nil, err
+	}
+	comment, err := s.repo.GetComment(ctx, todoID, id)
+	if err != nil {
+		return nil, err
+	}
+	if comment.Author != ActorFromContext(ctx) {
+		return nil, ErrNotCommentAuthor
+	}
+	return comment, nil
+}
+
+// UpdateComment edits one of the caller's comments. Actors it no longer
+// mentions lose the mention, and newly mentioned ones get one.
+func (s *Service) UpdateComment(ctx context.Context, todoID, id int64, input CommentInput) (*Comment, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	comment, err := s.ownComment(ctx, todoID, id)
+	if err != nil {
+		return nil, err
+	}
+	mentions, err := parseMentions(input.Body, comment.Author)
+	if err != nil {
+		return nil, err
+	}
+
+	comment.Body = input.Body
+	comment.UpdatedAt = time.Now()
+	if err := s.repo.UpdateComment(ctx, comment, mentions); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// DeleteComment removes one of the caller's comments and its mentions.
+func (s *Service) DeleteComment(ctx context.Context, todoID, id int64) error {
+	comment, err := s.ownComment(ctx, todoID, id)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteComment(ctx, comment.ID)
+}
+
+// Inbox returns a page of the caller's unread mentions, or of all of them,
+// newest first, the cursor of the next page and the number unread.
+func (s *Service) Inbox(ctx context.Context, cursor string, limit int, all bool) ([]Mention, string, int64, error) {
+	_, limit, err := normalizePage(1, limit)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	before, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	// Users only see mentions on todos of the lists they are members of.
+	actor := ActorFromContext(ctx)
+	var member *int64
+	if user := UserFromContext(ctx); user != nil {
+		member = &user.ID
+	}
+	mentions, err := s.repo.ListMentions(ctx, actor, member, before, all, limit+1)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	unread, err := s.repo.CountUnreadMentions(ctx, actor, member)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	mentions, next := nextPage(mentions, limit, func(m Mention) int64 { return m.ID })
+	return mentions, next, unread, nil
+}
+
+// MarkMentionsRead marks mentions in the caller's inbox as read and returns
+// how many were unread.
+func (s *Service) MarkMentionsRead(ctx context.Context, input MarkReadInput) (int64, error) {
+	if err := input.Validate(); err != nil {
+		return 0, err
+	}
+	return s.repo.MarkMentionsRead(ctx, ActorFromContext(ctx), input.IDs, time.Now())
+}
+
+// parseCursorPage reads the cursor and limit query parameters. It writes a
+// 400 response and returns false if limit is malformed.
+func parseCursorPage(c *gin.Context) (string, int, bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'limit' parameter"})
+		return "", 0, false
+	}
+	return c.Query("cursor"), limit, true
+}
+
+// commentIDs reads the todo and comment IDs of a comment's path. It writes
+// a 400 response and returns false if either is malformed.
+func commentIDs(c *gin.Context) (int64, int64, bool) {
+	todoID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return 0, 0, false
+	}
+	id, err := strconv.ParseInt(c.Param("comment_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return 0, 0, false
+	}
+	return todoID, id, true
+}
+
+func (h *Handler) CreateComment(c *gin.Context) {
+	todoID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	var input CommentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	comment, err := h.service.CreateComment(c.Request.Context(), todoID, input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": comment})
+}
+
+// ListComments serves GET /v1/todos/:id/comments. Pages follow the opaque
+// next_cursor of the previous one.
+func (h *Handler) ListComments(c *gin.Context) {
+	todoID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	cursor, limit, ok := parseCursorPage(c)
+	if !ok {
+		return
+	}
+
+	comments, next, err := h.service.Comments(c.Request.Context(), todoID, cursor, limit)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": comments,
+		"meta": gin.H{
+			"limit":       limit,
+			"next_cursor": nullString(next),
+		},
+	})
+}
+
+func (h *Handler) UpdateComment(c *gin.Context) {
+	todoID, id, ok := commentIDs(c)
+	if !ok {
+		return
+	}
+	var input CommentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	comment, err := h.service.UpdateComment(c.Request.Context(), todoID, id, input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": comment})
+}
+
+func (h *Handler) DeleteComment(c *gin.Context) {
+	todoID, id, ok := commentIDs(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteComment(c.Request.Context(), todoID, id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetInbox serves GET /v1/inbox, the caller's unread mentions. all=true
+// includes the ones already read.
+func (h *Handler) GetInbox(c *gin.Context) {
+	cursor, limit, ok := parseCursorPage(c)
+	if !ok {
+		return
+	}
+	var all bool
+	if v := c.Query("all"); v != "" {
+		var err error
+		if all, err = strconv.ParseBool(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'all' parameter"})
+			return
+		}
+	}
+
+	mentions, next, unread, err := h.service.Inbox(c.Request.Context(), cursor, limit, all)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": mentions,
+		"meta": gin.H{
+			"limit":       limit,
+			"next_cursor": nullString(next),
+			"unread":      unread,
+		},
+	})
+}
+
+// MarkInboxRead serves POST /v1/inbox/read with a body of {"ids": [...]} or
+// {"all": true}.
+func (h *Handler) MarkInboxRead(c *gin.Context) {
+	var input MarkReadInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	marked, err := h.service.MarkMentionsRead(c.Request.Context(), input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"marked": marked}})
+}
@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "none", body: "no mentions here", want: nil},
+		{name: "start of body", body: "@alice can you look?", want: []string{"alice"}},
+		{name: "several in order", body: "cc @bob, @alice and @bob", want: []string{"bob", "alice"}},
+		{name: "trailing punctuation", body: "thanks @carol. and (@dave)", want: []string{"carol", "dave"}},
+		{name: "email address", body: "mail alice@example.com", want: nil},
+		{name: "names with dots and dashes", body: "@api-key @j.doe_2", want: []string{"api-key", "j.doe_2"}},
+		{name: "author left out", body: "@me and @you", want: []string{"you"}},
+		{name: "bare at sign", body: "meet @ 5pm", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMentions(tt.body, "me")
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("too many", func(t *testing.T) {
+		var b strings.Builder
+		for i := 0; i <= maxMentions; i++ {
+			fmt.Fprintf(&b, "@user%d ", i)
+		}
+		_, err := parseMentions(b.String(), "me")
+
+		assert.ErrorIs(t, err, ErrTooManyMentions)
+	})
+}
+
+func TestCursor(t *testing.T) {
+	id, err := decodeCursor(encodeCursor(42))
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), id)
+
+	id, err = decodeCursor("")
+	require.NoError(t, err)
+	assert.Zero(t, id)
+
+	for _, cursor := range []string{"not base64!", encodeCursor(0), "YWJj"} {
+		_, err := decodeCursor(cursor)
+		assert.ErrorIs(t, err, ErrInvalidCursor, cursor)
+	}
+}
+
+func TestNextPage(t *testing.T) {
+	id := func(n int64) int64 { return n }
+
+	rows, next := nextPage([]int64{1, 2, 3}, 3, id)
+	assert.Equal(t, []int64{1, 2, 3}, rows)
+	assert.Empty(t, next)
+
+	rows, next = nextPage([]int64{1, 2, 3, 4}, 3, id)
+	assert.Equal(t, []int64{1, 2, 3}, rows)
+	assert.Equal(t, encodeCursor(3), next)
+}
+
+func TestService_CreateComment_Validation(t *testing.T) {
+	service := &Service{repo: nil}
+	ctx := context.Background()
+
+	tests := []struct {
+		wantErr error
+		name    string
+		body    string
+		todoID  int64
+	}{
+		{name: "invalid todo id", todoID: 0, body: "hi", wantErr: ErrInvalidID},
+		{name: "empty body", todoID: 1, body: "  \n", wantErr: ErrInvalidComment},
+		{name: "body too long", todoID: 1, body: strings.Repeat("ü", maxCommentLength+1), wantErr: ErrInvalidComment},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateComment(ctx, tt.todoID, CommentInput{Body: tt.body})
+
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestService_Inbox_Validation(t *testing.T) {
+	service := &Service{repo: nil}
+	ctx := context.Background()
+
+	_, _, _, err := service.Inbox(ctx, "", 101, false)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	_, _, _, err = service.Inbox(ctx, "%%%", 10, false)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	tests := []struct {
+		wantErr error
+		name    string
+		input   MarkReadInput
+	}{
+		{name: "neither", input: MarkReadInput{}, wantErr: ErrInvalidMarkRead},
+		{name: "both", input: MarkReadInput{IDs: []int64{1}, All: true}, wantErr: ErrInvalidMarkRead},
+		{name: "invalid id", input: MarkReadInput{IDs: []int64{1, 0}}, wantErr: ErrInvalidID},
+		{name: "too many", input: MarkReadInput{IDs: make([]int64, 101)}, wantErr: ErrLimitExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.MarkMentionsRead(ctx, tt.input)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	CompletionCompleted = "completed"
+	CompletionReopened  = "reopened"
+)
+
+// Completion records one transition of a todo between open and completed.
+type Completion struct {
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	Action      string    `json:"action" db:"action"`
+	Actor       string    `json:"actor" db:"actor"`
+	RequestID   string    `json:"request_id" db:"request_id"`
+	OperationID string    `json:"operation_id,omitempty" db:"operation_id"`
+	ID          int64     `json:"id" db:"id"`
+	TodoID      int64     `json:"todo_id" db:"todo_id"`
+}
+
+// stampCompletion maintains after's completed_at and completed_by as it
+// replaces before, which is nil for a new todo. Completing a todo records
+// actor and now unless after already carries a completion time, as a todo
+// restored by an undo does; reopening one clears both.
+func stampCompletion(before, after *Todo, actor string, now time.Time) {
+	switch {
+	case !after.Completed:
+		after.CompletedAt, after.CompletedBy = nil, nil
+	case before != nil && before.Completed:
+		after.CompletedAt, after.CompletedBy = before.CompletedAt, before.CompletedBy
+	case after.CompletedAt == nil:
+		after.CompletedAt, after.CompletedBy = &now, &actor
+	}
+}
+
+// completionsOf returns the transitions recorded by events: a todo created
+// completed, or updated from open to completed or back.
+func completionsOf(events []TodoEvent) []Completion {
+	var completions []Completion
+	for _, event := range events {
+		change, ok := event.Changes["completed"]
+		if !ok || event.Action == EventDeleted {
+			continue
+		}
+		var action string
+		switch {
+		case change.After == true && change.Before != true:
+			action = CompletionCompleted
+		case change.After == false && change.Before == true:
+			action = CompletionReopened
+		default:
+			continue
+		}
+		completions = append(completions, Completion{
+			TodoID:      event.TodoID,
+			Action:      action,
+			Actor:       event.Actor,
+			RequestID:   event.RequestID,
+			OperationID: event.OperationID,
+			CreatedAt:   event.CreatedAt,
+		})
+	}
+	return completions
+}
+
+func insertCompletions(ctx context.Context, tx *sqlx.Tx, completions []Completion) error {
+	if len(completions) == 0 {
+		return nil
+	}
+	_, err := tx.NamedExecContext(ctx,
+		`INSERT INTO completion_history (todo_id, action, actor, request_id, operation_id, created_at)
+		 VALUES (:todo_id, :action, :actor, :request_id, :operation_id, :created_at)`, completions)
+	return err
+}
+
+func (r *Repository) ListCompletions(ctx context.Context, todoID int64, page, limit int) ([]Completion, int64, error) {
+	var total int64
+	if err := r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM completion_history WHERE todo_id = ?", todoID); err != nil {
+		return nil, 0, err
+	}
+
+	completions := []Completion{}
+	err := r.db.SelectContext(ctx, &completions,
+		"SELECT * FROM completion_history WHERE todo_id = ? ORDER BY id DESC LIMIT ? OFFSET ?",
+		todoID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	return completions, total, nil
+}
+
+// Completions returns the completion history of a todo, newest first. It is
+// kept after the todo is deleted.
+func (s *Service) Completions(ctx context.Context, todoID int64, page, limit int) ([]Completion, int64, error) {
+	if todoID <= 0 {
+		return nil, 0, ErrInvalidID
+	}
+	page, limit, err := normalizePage(page, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := s.authorizeTodo(ctx, todoID, RoleViewer); err != nil {
+		return nil, 0, err
+	}
+	return s.repo.ListCompletions(ctx, todoID, page, limit)
+}
+
+func (h *Handler) GetCompletions(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	completions, total, err := h.service.Completions(c.Request.Context(), id, page, limit)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": completions,
+		"meta": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStampCompletion(t *testing.T) {
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	earlier := now.Add(-time.Hour)
+	bob := "bob"
+
+	t.Run("completing an open todo", func(t *testing.T) {
+		before := &Todo{ID: 1}
+		after := &Todo{ID: 1, Completed: true}
+		stampCompletion(before, after, "alice", now)
+
+		assert.Equal(t, &now, after.CompletedAt)
+		assert.Equal(t, "alice", *after.CompletedBy)
+	})
+
+	t.Run("editing a completed todo", func(t *testing.T) {
+		before := &Todo{ID: 1, Completed: true, CompletedAt: &earlier, CompletedBy: &bob}
+		after := *before
+		after.Title = "Renamed"
+		stampCompletion(before, &after, "alice", now)
+
+		assert.Equal(t, &earlier, after.CompletedAt)
+		assert.Equal(t, &bob, after.CompletedBy)
+	})
+
+	t.Run("reopening", func(t *testing.T) {
+		before := &Todo{ID: 1, Completed: true, CompletedAt: &earlier, CompletedBy: &bob}
+		after := *before
+		after.Completed = false
+		stampCompletion(before, &after, "alice", now)
+
+		assert.Nil(t, after.CompletedAt)
+		assert.Nil(t, after.CompletedBy)
+	})
+
+	t.Run("created completed", func(t *testing.T) {
+		todo := &Todo{Completed: true}
+		stampCompletion(nil, todo, "alice", now)
+
+		assert.Equal(t, &now, todo.CompletedAt)
+		assert.Equal(t, "alice", *todo.CompletedBy)
+	})
+
+	t.Run("restored by an undo", func(t *testing.T) {
+		restored := &Todo{ID: 1, Completed: true, CompletedAt: &earlier, CompletedBy: &bob}
+		stampCompletion(&Todo{ID: 1}, restored, "alice", now)
+
+		assert.Equal(t, &earlier, restored.CompletedAt)
+		assert.Equal(t, &bob, restored.CompletedBy)
+	})
+}
+
+func TestCompletionsOf(t *testing.T) {
+	ctx := WithActor(context.Background(), "alice")
+	op := &Operation{ID: "op1"}
+	open := &Todo{ID: 1, Title: "a"}
+	done := &Todo{ID: 1, Title: "a", Completed: true}
+	renamed := &Todo{ID: 1, Title: "b", Completed: true}
+
+	events := []TodoEvent{
+		newTodoEvent(ctx, op, EventCreated, nil, open),
+		newTodoEvent(ctx, op, EventUpdated, open, done),
+		newTodoEvent(ctx, op, EventUpdated, done, renamed),
+		newTodoEvent(ctx, op, EventUpdated, renamed, open),
+		newTodoEvent(ctx, op, EventCreated, nil, &Todo{ID: 2, Title: "c", Completed: true}),
+		newTodoEvent(ctx, op, EventDeleted, &Todo{ID: 2, Title: "c", Completed: true}, nil),
+	}
+
+	completions := completionsOf(events)
+	if assert.Len(t, completions, 3) {
+		assert.Equal(t, CompletionCompleted, completions[0].Action)
+		assert.Equal(t, int64(1), completions[0].TodoID)
+		assert.Equal(t, "alice", completions[0].Actor)
+		assert.Equal(t, "op1", completions[0].OperationID)
+		assert.Equal(t, CompletionReopened, completions[1].Action)
+		assert.Equal(t, CompletionCompleted, completions[2].Action)
+		assert.Equal(t, int64(2), completions[2].TodoID)
+	}
+}
+
+func TestTodoFilter_CompletedRange(t *testing.T) {
+	after := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	where, args := TodoFilter{CompletedAfter: &after, CompletedBefore: &before}.where()
+
+	assert.Equal(t, " WHERE completed_at >= ? AND completed_at < ?", where)
+	assert.Equal(t, []any{after, before}, args)
+}
+
+func TestService_Completions_InvalidID(t *testing.T) {
+	svc := &Service{repo: nil}
+
+	_, _, err := svc.Completions(context.Background(), 0, 1, 10)
+	assert.ErrorIs(t, err, ErrInvalidID)
+}
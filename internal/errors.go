@@ -4,12 +4,79 @@ import "errors"
 
 var (
 	ErrNotFound           = errors.New("not found")
+	ErrUnauthorized       = errors.New("unauthorized")
 	ErrDuplicateTitle     = errors.New("duplicate title")
 	ErrTitleRequired      = errors.New("title is required")
 	ErrTitleEmpty         = errors.New("title cannot be empty")
 	ErrTitleMaxLength     = errors.New("title must be less than 255 characters")
 	ErrInvalidID          = errors.New("id not valid")
+	ErrInvalidPriority    = errors.New("priority must be between 0 and 25")
+	ErrInvalidTag         = errors.New("tags must be at most 64 characters without whitespace or commas")
+	ErrInvalidExternalID  = errors.New("external_id and source must be set together, at most 255 and 64 characters")
+	ErrInvalidOnConflict  = errors.New("on_conflict must be error, update or skip")
+	ErrEmptyPatch         = errors.New("patch must set at least one field")
+	ErrPreviewRequired    = errors.New("expected_count from a dry run is required")
+	ErrTooManyMatches     = errors.New("filter matches more todos than the batch limit")
+	ErrInvalidSearch      = errors.New("search query must contain at least one word to match")
+	ErrInvalidViewName    = errors.New("view name is required and must be at most 255 characters")
+	ErrDuplicateView      = errors.New("a view with this name already exists")
+	ErrInvalidInterval    = errors.New("interval must be day, week or month")
+	ErrInvalidTimezone    = errors.New("tz must be an IANA timezone such as Europe/Berlin")
+	ErrInvalidStatsRange  = errors.New("from must not be after to")
+	ErrTooManyBuckets     = errors.New("range spans too many buckets for the interval")
+	ErrInvalidList        = errors.New("list_id does not name an existing list")
+	ErrInvalidListName    = errors.New("list name is required and must be at most 255 characters")
+	ErrDuplicateList      = errors.New("a list with this name already exists")
+	ErrListNotEmpty       = errors.New("list still has todos")
+	ErrInvalidWorkflow    = errors.New("invalid workflow")
+	ErrStateInUse         = errors.New("workflow drops or changes a state todos are in")
+	ErrInvalidStatus      = errors.New("status is not a state of the todo's workflow")
+	ErrInvalidTransition  = errors.New("workflow does not allow moving from")
+	ErrWIPLimitExceeded   = errors.New("WIP limit reached")
+	ErrInvalidMove        = errors.New("exactly one of before and after must name another todo in the same list")
+	ErrPositionTie        = errors.New("neighbouring todos share a position, try again after they are rebalanced")
+	ErrInvalidSort        = errors.New("sort must be created or position")
+	ErrInvalidComment     = errors.New("comment body is required and must be at most 10000 characters")
+	ErrTooManyMentions    = errors.New("a comment may mention at most 20 users")
+	ErrNotCommentAuthor   = errors.New("only the author may change a comment")
+	ErrInvalidCursor      = errors.New("invalid cursor")
+	ErrInvalidMarkRead    = errors.New("exactly one of ids and all is required")
+	ErrEmptyAttachment    = errors.New("attachment is empty")
+	ErrAttachmentTooLarge = errors.New("attachment exceeds the maximum size")
+	ErrAttachmentType     = errors.New("attachment type is not allowed")
+	ErrInvalidDownloadURL = errors.New("download link is invalid or has expired")
+	ErrInvalidUserName    = errors.New("user name must be up to 64 letters, digits, dots, dashes and underscores and not reserved")
+	ErrInvalidTenant      = errors.New("tenant must be up to 64 lowercase letters, digits, dashes and underscores")
+	ErrDuplicateUser      = errors.New("a user with this name already exists")
+	ErrAdminOnly          = errors.New("requires the instance API key")
+	ErrNoCurrentUser      = errors.New("request is not authenticated as a user")
+	ErrInvalidUser        = errors.New("user_id does not name an existing user")
+	ErrTenantMismatch     = errors.New("user belongs to another tenant")
+	ErrUserTimezone       = errors.New("timezone must be an IANA timezone such as Europe/Berlin")
+	ErrInvalidShare       = errors.New("resource_type must be list or todo, and permission view, comment or edit")
+	ErrInvalidShareExpiry = errors.New("expires_at must be in the future")
+	ErrInvalidShareLink   = errors.New("share link is invalid, expired or revoked")
+	ErrSharePermission    = errors.New("share link does not permit this")
+	ErrInvalidRole        = errors.New("role must be owner, editor or viewer")
+	ErrInsufficientRole   = errors.New("your role on the list does not permit this")
+	ErrLastOwner          = errors.New("a list must keep at least one owner")
+	ErrListRequired       = errors.New("users must create todos in a list")
+	ErrInvalidEstimate    = errors.New("estimate_minutes must be between 0 and 120000")
+	ErrInvalidTimeEntry   = errors.New("minutes must be between 1 and 1440 and end no later than now, with a note of at most 1000 characters")
+	ErrTimerRunning       = errors.New("a timer is already running, stop it first")
+	ErrNoRunningTimer     = errors.New("no timer of yours is running on this todo")
+	ErrNotEntryActor      = errors.New("only the actor who logged time may remove it")
+	ErrInvalidSnooze      = errors.New("exactly one of a future until and a preset of later_today, tomorrow or next_week is required")
 	ErrEmptyList          = errors.New("list cannot be empty")
 	ErrDuplicateInRequest = errors.New("duplicate entry in request")
 	ErrLimitExceeded      = errors.New("limit exceeds maximum allowed")
+	ErrConflict           = errors.New("todo was modified by a later operation")
+	ErrOperationUndone    = errors.New("operation already undone")
+	ErrOperationExpired   = errors.New("operation can no longer be undone")
+	ErrJobFinished        = errors.New("job has already finished")
+	ErrUnsupportedFormat  = errors.New("unsupported format")
+	ErrUnknownSource      = errors.New("unknown import source")
+	ErrInvalidImport      = errors.New("invalid import file")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrInvalidSyncToken   = errors.New("invalid sync token")
 )
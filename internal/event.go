@@ -0,0 +1,329 @@
+package internal
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	EventCreated    = "created"
+	EventUpdated    = "updated"
+	EventDeleted    = "deleted"
+	EventAssigned   = "assigned"
+	EventUnassigned = "unassigned"
+)
+
+// TodoEvent is an append-only record of a single mutation of a todo.
+type TodoEvent struct {
+	CreatedAt   time.Time    `json:"created_at" db:"created_at"`
+	Changes     FieldChanges `json:"changes" db:"changes"`
+	Snapshot    TodoSnapshot `json:"-" db:"snapshot"`
+	Action      string       `json:"action" db:"action"`
+	Actor       string       `json:"actor" db:"actor"`
+	RequestID   string       `json:"request_id" db:"request_id"`
+	OperationID string       `json:"operation_id,omitempty" db:"operation_id"`
+	ID          int64        `json:"id" db:"id"`
+	TodoID      int64        `json:"todo_id" db:"todo_id"`
+}
+
+type FieldChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// FieldChanges maps a todo field name to its before and after values. It is
+// stored as a JSON column.
+type FieldChanges map[string]FieldChange
+
+func (f FieldChanges) Value() (driver.Value, error) {
+	if f == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(f)
+}
+
+func (f *FieldChanges) Scan(src any) error {
+	if src == nil {
+		*f = FieldChanges{}
+		return nil
+	}
+	return scanJSON(src, f)
+}
+
+// TodoSnapshot is a full copy of a todo as it was before an event, used to
+// undo the change. It is nil for creations.
+type TodoSnapshot struct {
+	Todo *Todo
+}
+
+func (s TodoSnapshot) Value() (driver.Value, error) {
+	if s.Todo == nil {
+		return nil, nil
+	}
+	return json.Marshal(s.Todo)
+}
+
+func (s *TodoSnapshot) Scan(src any) error {
+	if src == nil {
+		s.Todo = nil
+		return nil
+	}
+	s.Todo = &Todo{}
+	return scanJSON(src, s.Todo)
+}
+
+// scanJSON decodes a JSON column value into dst.
+func scanJSON(src any, dst any) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, dst)
+	case string:
+		return json.Unmarshal([]byte(v), dst)
+	default:
+		return fmt.Errorf("unsupported type for JSON column: %T", src)
+	}
+}
+
+type EventFilter struct {
+	Since  *time.Time
+	Until  *time.Time
+	Actor  string
+	TodoID int64
+}
+
+// todoFields returns the audited fields of a todo as JSON-friendly values. A nil todo has no fields.
+func todoFields(t *Todo) map[string]any {
+	if t == nil {
+		return map[string]any{}
+	}
+	var due, start, snoozed, priority, estimate, tags any
+	if t.DueDate != nil {
+		due = t.DueDate.UTC().Format(time.RFC3339)
+	}
+	if t.StartDate != nil {
+		start = t.StartDate.UTC().Format(time.RFC3339)
+	}
+	if t.SnoozedUntil != nil {
+		snoozed = t.SnoozedUntil.UTC().Format(time.RFC3339)
+	}
+	if t.Priority != nil {
+		priority = *t.Priority
+	}
+	if t.EstimateMinutes != nil {
+		estimate = *t.EstimateMinutes
+	}
+	if len(t.Tags) > 0 {
+		tags = []string(t.Tags)
+	}
+	return map[string]any{
+		"title":            t.Title,
+		"description":      t.Description,
+		"due_date":         due,
+		"start_date":       start,
+		"snoozed_until":    snoozed,
+		"completed":        t.Completed,
+		"status":           t.Status,
+		"position":         t.Position,
+		"priority":         priority,
+		"estimate_minutes": estimate,
+		"tags":             tags,
+	}
+}
+
+// diffTodos returns the fields that differ between before and after. Either
+// side may be nil to describe a creation or a deletion.
+func diffTodos(before, after *Todo) FieldChanges {
+	b, a := todoFields(before), todoFields(after)
+	changes := FieldChanges{}
+	for field, av := range a {
+		if bv, ok := b[field]; !ok || !reflect.DeepEqual(bv, av) {
+			changes[field] = FieldChange{Before: b[field], After: av}
+		}
+	}
+	for field, bv := range b {
+		if _, ok := a[field]; !ok {
+			changes[field] = FieldChange{Before: bv}
+		}
+	}
+	return changes
+}
+
+func newTodoEvent(ctx context.Context, op *Operation, action string, before, after *Todo) TodoEvent {
+	id := int64(0)
+	if after != nil {
+		id = after.ID
+	} else if before != nil {
+		id = before.ID
+	}
+	return TodoEvent{
+		TodoID:      id,
+		Action:      action,
+		Actor:       ActorFromContext(ctx),
+		RequestID:   RequestIDFromContext(ctx),
+		OperationID: op.ID,
+		Changes:     diffTodos(before, after),
+		Snapshot:    TodoSnapshot{Todo: before},
+		CreatedAt:   time.Now(),
+	}
+}
+
+func insertEvents(ctx context.Context, tx *sqlx.Tx, events []TodoEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	_, err := tx.NamedExecContext(ctx,
+		`INSERT INTO todo_events (todo_id, action, actor, request_id, operation_id, changes, snapshot, created_at)
+		 VALUES (:todo_id, :action, :actor, :request_id, :operation_id, :changes, :snapshot, :created_at)`, events)
+	if err != nil {
+		return err
+	}
+	return insertCompletions(ctx, tx, completionsOf(events))
+}
+
+func (r *Repository) ListEvents(ctx context.Context, filter EventFilter, page, limit int) ([]TodoEvent, int64, error) {
+	var (
+		conds []string
+		args  []any
+	)
+	if filter.TodoID > 0 {
+		conds = append(conds, "todo_id = ?")
+		args = append(args, filter.TodoID)
+	}
+	if filter.Actor != "" {
+		conds = append(conds, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+	if filter.Since != nil {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, *filter.Since)
+	}
+	if filter.Until != nil {
+		conds = append(conds, "created_at < ?")
+		args = append(args, *filter.Until)
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	offset := (page - 1) * limit
+
+	var events []TodoEvent
+	err := r.db.SelectContext(ctx, &events,
+		"SELECT * FROM todo_events"+where+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if events == nil {
+		events = []TodoEvent{}
+	}
+
+	var total int64
+	err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM todo_events"+where, args...)
+	return events, total, err
+}
+
+func (s *Service) History(ctx context.Context, todoID int64, page, limit int) ([]TodoEvent, int64, error) {
+	if todoID <= 0 {
+		return nil, 0, ErrInvalidID
+	}
+	page, limit, err := normalizePage(page, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := s.authorizeTodo(ctx, todoID, RoleViewer); err != nil {
+		return nil, 0, err
+	}
+	return s.repo.ListEvents(ctx, EventFilter{TodoID: todoID}, page, limit)
+}
+
+// ListEvents returns the audit log across all todos, which only callers
+// that are not users may read.
+func (s *Service) ListEvents(ctx context.Context, filter EventFilter, page, limit int) ([]TodoEvent, int64, error) {
+	page, limit, err := normalizePage(page, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := authorizeAdmin(ctx); err != nil {
+		return nil, 0, err
+	}
+	return s.repo.ListEvents(ctx, filter, page, limit)
+}
+
+func (h *Handler) GetHistory(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	events, total, err := h.service.History(c.Request.Context(), id, page, limit)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": events,
+		"meta": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+func (h *Handler) ListAuditEvents(c *gin.Context) {
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	filter := EventFilter{Actor: c.Query("actor")}
+	if v := c.Query("todo_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'todo_id' parameter"})
+			return
+		}
+		filter.TodoID = id
+	}
+	if filter.Since, ok = parseTimeQuery(c, "since"); !ok {
+		return
+	}
+	if filter.Until, ok = parseTimeQuery(c, "until"); !ok {
+		return
+	}
+
+	events, total, err := h.service.ListEvents(c.Request.Context(), filter, page, limit)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": events,
+		"meta": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
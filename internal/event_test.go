@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffTodos(t *testing.T) {
+	due := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	priority := 2
+	before := &Todo{ID: 1, Title: "Write report", Description: "draft", Status: StatusOpen, Position: "a0"}
+	after := &Todo{ID: 1, Title: "Write report", Description: "draft", Status: StatusDone, Position: "a0", Completed: true, DueDate: &due}
+
+	tests := []struct {
+		before *Todo
+		after  *Todo
+		want   FieldChanges
+		name   string
+	}{
+		{
+			name:   "update only records changed fields",
+			before: before,
+			after:  after,
+			want: FieldChanges{
+				"completed": {Before: false, After: true},
+				"status":    {Before: StatusOpen, After: StatusDone},
+				"due_date":  {Before: nil, After: "2026-01-02T03:04:05Z"},
+			},
+		},
+		{
+			name:   "no changes",
+			before: before,
+			after:  before,
+			want:   FieldChanges{},
+		},
+		{
+			name:   "create records every field",
+			before: nil,
+			after:  before,
+			want: FieldChanges{
+				"title":            {Before: nil, After: "Write report"},
+				"description":      {Before: nil, After: "draft"},
+				"due_date":         {Before: nil, After: nil},
+				"start_date":       {Before: nil, After: nil},
+				"snoozed_until":    {Before: nil, After: nil},
+				"completed":        {Before: nil, After: false},
+				"status":           {Before: nil, After: StatusOpen},
+				"position":         {Before: nil, After: "a0"},
+				"priority":         {Before: nil, After: nil},
+				"estimate_minutes": {Before: nil, After: nil},
+				"tags":             {Before: nil, After: nil},
+			},
+		},
+		{
+			name:   "delete records every field",
+			before: before,
+			after:  nil,
+			want: FieldChanges{
+				"title":            {Before: "Write report"},
+				"description":      {Before: "draft"},
+				"due_date":         {Before: nil},
+				"start_date":       {Before: nil},
+				"snoozed_until":    {Before: nil},
+				"completed":        {Before: false},
+				"status":           {Before: StatusOpen},
+				"position":         {Before: "a0"},
+				"priority":         {Before: nil},
+				"estimate_minutes": {Before: nil},
+				"tags":             {Before: nil},
+			},
+		},
+		{
+			name:   "tags and priority are compared by value",
+			before: &Todo{ID: 1, Title: "Write report", Tags: Tags{"work"}},
+			after:  &Todo{ID: 1, Title: "Write report", Tags: Tags{"work", "urgent"}, Priority: &priority},
+			want: FieldChanges{
+				"priority": {Before: nil, After: 2},
+				"tags":     {Before: []string{"work"}, After: []string{"work", "urgent"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, diffTodos(tt.before, tt.after))
+		})
+	}
+}
+
+func TestFieldChanges_RoundTrip(t *testing.T) {
+	changes := FieldChanges{"title": {Before: "a", After: "b"}}
+
+	v, err := changes.Value()
+	assert.NoError(t, err)
+
+	var got FieldChanges
+	assert.NoError(t, got.Scan(v))
+	assert.Equal(t, changes, got)
+}
+
+func TestTodoSnapshot_RoundTrip(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	snapshot := TodoSnapshot{Todo: &Todo{ID: 7, Title: "Ship it", CreatedAt: created, UpdatedAt: created}}
+
+	v, err := snapshot.Value()
+	assert.NoError(t, err)
+
+	var got TodoSnapshot
+	assert.NoError(t, got.Scan(v))
+	assert.Equal(t, snapshot, got)
+
+	v, err = TodoSnapshot{}.Value()
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+}
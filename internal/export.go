@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Export writes every todo matching filter to enc and closes it.
+func (s *Service) Export(ctx context.Context, filter TodoFilter, enc TodoEncoder) error {
+	if err := s.repo.Stream(ctx, visible(ctx, filter, RoleViewer), enc.Encode); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Import decodes todos in the given format and creates them in a single
+// bulk operation. iCalendar imports update todos whose UID already exists.
+func (s *Service) Import(ctx context.Context, r io.Reader, format string, mapping ColumnMapping) ([]*Todo, *Operation, error) {
+	switch format {
+	case FormatICS:
+		return s.ImportCalendar(ctx, r)
+	case FormatTodoTxt, FormatMarkdown:
+		return s.ImportChecklist(ctx, r, format)
+	}
+
+	inputs, err := DecodeTodos(r, format, mapping)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.BulkCreate(ctx, inputs)
+}
+
+func (h *Handler) ExportTodos(c *gin.Context) {
+	format := c.DefaultQuery("format", FormatJSON)
+	filter, ok := parseTodoFilter(c)
+	if !ok {
+		return
+	}
+
+	enc, err := NewTodoEncoder(c.Writer, format)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	// Exports can take longer than the server's write timeout.
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", ContentType(format))
+	c.Header("Content-Disposition", `attachment; filename="`+FileName(format)+`"`)
+	c.Status(http.StatusOK)
+
+	if err := h.service.Export(c.Request.Context(), filter, enc); err != nil {
+		logStreamError(c, err, format)
+	}
+}
+
+// logStreamError logs an error that interrupted a streamed export. The status
+// line has already been sent, so the client only sees a truncated body.
+func logStreamError(c *gin.Context, err error, format string) {
+	slog.Error("Export failed",
+		"error", err,
+		"format", format,
+		"path", c.Request.URL.Path,
+		"request_id", RequestIDFromContext(c.Request.Context()),
+	)
+}
+
+func (h *Handler) ImportTodos(c *gin.Context) {
+	format := c.DefaultQuery("format", FormatFromContentType(c.ContentType()))
+	mapping, err := ParseColumnMapping(c.Query("map"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	body, ok := requestFile(c)
+	if !ok {
+		return
+	}
+	defer body.Close()
+
+	todos, op, err := h.service.Import(c.Request.Context(), body, format, mapping)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": todos, "meta": operationMeta(op)})
+}
+
+// requestFile returns the uploaded multipart "file", or the raw request body
+// for any other content type. It writes a 400 response and returns false if
+// a multipart request has no readable file.
+func requestFile(c *gin.Context) (io.ReadCloser, bool) {
+	if !strings.HasPrefix(c.ContentType(), "multipart/") {
+		return c.Request.Body, true
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "file is required"})
+		return nil, false
+	}
+	var f multipart.File
+	if f, err = file.Open(); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid file"})
+		return nil, false
+	}
+	return f, true
+}
@@ -0,0 +1,373 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+var csvColumns = []string{"id", "title", "description", "due_date", "completed", "created_at", "updated_at"}
+
+// TodoEncoder writes todos to an export stream one at a time. Close must be
+// called once all todos are written.
+type TodoEncoder interface {
+	Encode(todo *Todo) error
+	Close() error
+}
+
+func NewTodoEncoder(w io.Writer, format string) (TodoEncoder, error) {
+	switch format {
+	case FormatJSON:
+		return &jsonEncoder{w: w}, nil
+	case FormatNDJSON:
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}, nil
+	case FormatCSV:
+		return &csvEncoder{w: csv.NewWriter(w)}, nil
+	case FormatICS:
+		return newICSEncoder(w), nil
+	case FormatTodoTxt:
+		return &todoTxtEncoder{w: w}, nil
+	case FormatMarkdown:
+		return &markdownEncoder{w: w}, nil
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+// ContentType returns the MIME type of a format.
+func ContentType(format string) string {
+	switch format {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatICS:
+		return "text/calendar; charset=utf-8"
+	case FormatTodoTxt:
+		return "text/plain; charset=utf-8"
+	case FormatMarkdown:
+		return "text/markdown; charset=utf-8"
+	default:
+		return "application/json; charset=utf-8"
+	}
+}
+
+// FormatFromContentType returns the import format for a request's MIME type,
+// defaulting to JSON.
+func FormatFromContentType(contentType string) string {
+	switch contentType {
+	case "application/x-ndjson":
+		return FormatNDJSON
+	case "text/csv":
+		return FormatCSV
+	case "text/calendar":
+		return FormatICS
+	case "text/plain":
+		return FormatTodoTxt
+	case "text/markdown":
+		return FormatMarkdown
+	default:
+		return FormatJSON
+	}
+}
+
+// FileName returns the conventional name of an export file in format.
+func FileName(format string) string {
+	switch format {
+	case FormatTodoTxt:
+		return "todo.txt"
+	case FormatMarkdown:
+		return "todos.md"
+	default:
+		return "todos." + format
+	}
+}
+
+type jsonEncoder struct {
+	w       io.Writer
+	started bool
+}
+
+func (e *jsonEncoder) Encode(todo *Todo) error {
+	data, err := json.Marshal(todo)
+	if err != nil {
+		return err
+	}
+	sep := ","
+	if !e.started {
+		sep = "["
+		e.started = true
+	}
+	if _, err := io.WriteString(e.w, sep); err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonEncoder) Close() error {
+	end := "]\n"
+	if !e.started {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(todo *Todo) error {
+	return e.enc.Encode(todo)
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return nil
+}
+
+type csvEncoder struct {
+	w       *csv.Writer
+	started bool
+}
+
+func (e *csvEncoder) Encode(todo *Todo) error {
+	if !e.started {
+		if err := e.w.Write(csvColumns); err != nil {
+			return err
+		}
+		e.started = true
+	}
+
+	due := ""
+	if todo.DueDate != nil {
+		due = todo.DueDate.UTC().Format(time.RFC3339)
+	}
+	return e.w.Write([]string{
+		strconv.FormatInt(todo.ID, 10),
+		todo.Title,
+		todo.Description,
+		due,
+		strconv.FormatBool(todo.Completed),
+		todo.CreatedAt.UTC().Format(time.RFC3339),
+		todo.UpdatedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (e *csvEncoder) Close() error {
+	if !e.started {
+		if err := e.w.Write(csvColumns); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ColumnMapping maps an importable todo field (title, description, due_date)
+// to the name of the CSV column holding it. Unmapped fields are read from
+// the column with the field's own name.
+type ColumnMapping map[string]string
+
+// ParseColumnMapping parses a mapping of the form
+// "title:Name,due_date:Due Date".
+func ParseColumnMapping(s string) (ColumnMapping, error) {
+	mapping := ColumnMapping{}
+	if strings.TrimSpace(s) == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		field, column, ok := strings.Cut(pair, ":")
+		field = strings.TrimSpace(field)
+		if !ok || strings.TrimSpace(column) == "" {
+			return nil, fmt.Errorf("invalid column mapping %q", pair)
+		}
+		switch field {
+		case "title", "description", "due_date":
+		default:
+			return nil, fmt.Errorf("unknown field %q in column mapping", field)
+		}
+		mapping[field] = strings.TrimSpace(column)
+	}
+	return mapping, nil
+}
+
+func (m ColumnMapping) column(field string) string {
+	if c, ok := m[field]; ok {
+		return c
+	}
+	return field
+}
+
+// RowError describes why a single input row was not imported. Rows are
+// numbered from 1 in the order they were submitted.
+type RowError struct {
+	Error string `json:"error"`
+	Row   int    `json:"row"`
+}
+
+// ImportError reports every row of an import that could not be parsed or
+// failed validation.
+type ImportError struct {
+	Rows []RowError
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("%d invalid rows", len(e.Rows))
+}
+
+// DecodeTodos reads todos to import in the given format and validates each
+// with CreateTodoInput.Validate. If any row is invalid it returns an
+// *ImportError listing all of them. The mapping only applies to CSV.
+func DecodeTodos(r io.Reader, format string, mapping ColumnMapping) ([]CreateTodoInput, error) {
+	var (
+		inputs []CreateTodoInput
+		rows   []RowError
+		err    error
+	)
+	switch format {
+	case FormatJSON:
+		inputs, err = decodeImportPayload(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+	case FormatNDJSON:
+		inputs, rows, err = decodeNDJSON(r)
+	case FormatCSV:
+		inputs, rows, err = decodeCSV(r, mapping)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateRows(len(inputs), func(i int) *CreateTodoInput { return &inputs[i] }, rows); err != nil {
+		return nil, err
+	}
+	return inputs, nil
+}
+
+// validateRows validates the n decoded inputs that did not already fail to
+// parse and returns an *ImportError listing every bad row, if any.
+func validateRows(n int, input func(i int) *CreateTodoInput, rows []RowError) error {
+	failed := make(map[int]bool, len(rows))
+	for _, row := range rows {
+		failed[row.Row] = true
+	}
+	for i := 0; i < n; i++ {
+		if failed[i+1] {
+			continue
+		}
+		if err := input(i).Validate(); err != nil {
+			rows = append(rows, RowError{Row: i + 1, Error: err.Error()})
+		}
+	}
+	if len(rows) > 0 {
+		slices.SortFunc(rows, func(a, b RowError) int { return a.Row - b.Row })
+		return &ImportError{Rows: rows}
+	}
+	return nil
+}
+
+func decodeNDJSON(r io.Reader) ([]CreateTodoInput, []RowError, error) {
+	var (
+		inputs []CreateTodoInput
+		rows   []RowError
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var input CreateTodoInput
+		if err := json.Unmarshal([]byte(line), &input); err != nil {
+			rows = append(rows, RowError{Row: len(inputs) + 1, Error: "invalid JSON"})
+		}
+		inputs = append(inputs, input)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	return inputs, rows, nil
+}
+
+func decodeCSV(r io.Reader, mapping ColumnMapping) ([]CreateTodoInput, []RowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: missing CSV header", ErrInvalidImport)
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+	if _, ok := index[mapping.column("title")]; !ok {
+		return nil, nil, fmt.Errorf("%w: missing %q column", ErrInvalidImport, mapping.column("title"))
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := index[mapping.column(name)]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var (
+		inputs []CreateTodoInput
+		rows   []RowError
+	)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+
+		input := CreateTodoInput{
+			Title:       field(record, "title"),
+			Description: field(record, "description"),
+		}
+		if due := field(record, "due_date"); due != "" {
+			t, err := parseDate(due)
+			if err != nil {
+				rows = append(rows, RowError{Row: len(inputs) + 1, Error: "invalid due_date"})
+			}
+			input.DueDate = t
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, rows, nil
+}
+
+// parseDate accepts an RFC3339 timestamp or a plain YYYY-MM-DD date, which is
+// read as midnight UTC.
+func parseDate(s string) (*time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
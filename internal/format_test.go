@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTodoEncoder_CSV(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	todos := []*Todo{
+		{ID: 1, Title: "First", Description: "a, b", CreatedAt: created, UpdatedAt: created},
+		{ID: 2, Title: "Second", Completed: true, DueDate: &created, CreatedAt: created, UpdatedAt: created},
+	}
+
+	var buf bytes.Buffer
+	enc, err := NewTodoEncoder(&buf, FormatCSV)
+	require.NoError(t, err)
+	for _, todo := range todos {
+		require.NoError(t, enc.Encode(todo))
+	}
+	require.NoError(t, enc.Close())
+
+	want := "id,title,description,due_date,completed,created_at,updated_at\n" +
+		"1,First,\"a, b\",,false,2026-01-02T03:04:05Z,2026-01-02T03:04:05Z\n" +
+		"2,Second,,2026-01-02T03:04:05Z,true,2026-01-02T03:04:05Z,2026-01-02T03:04:05Z\n"
+	assert.Equal(t, want, buf.String())
+}
+
+func TestTodoEncoder_JSONFormats(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	todos := []*Todo{
+		{ID: 1, UID: "a@todox", Title: "First", Description: "a, b", CreatedAt: created, UpdatedAt: created},
+		{ID: 2, UID: "b@todox", Title: "Second", Completed: true, DueDate: &created, CreatedAt: created, UpdatedAt: created},
+	}
+
+	decoders := map[string]func([]byte) ([]*Todo, error){
+		FormatJSON: func(data []byte) ([]*Todo, error) {
+			var got []*Todo
+			err := json.Unmarshal(data, &got)
+			return got, err
+		},
+		FormatNDJSON: func(data []byte) ([]*Todo, error) {
+			var got []*Todo
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+				var todo Todo
+				if err := json.Unmarshal([]byte(line), &todo); err != nil {
+					return nil, err
+				}
+				got = append(got, &todo)
+			}
+			return got, nil
+		},
+	}
+
+	for format, decode := range decoders {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc, err := NewTodoEncoder(&buf, format)
+			require.NoError(t, err)
+			for _, todo := range todos {
+				require.NoError(t, enc.Encode(todo))
+			}
+			require.NoError(t, enc.Close())
+
+			got, err := decode(buf.Bytes())
+			require.NoError(t, err)
+			assert.Equal(t, todos, got)
+		})
+	}
+}
+
+func TestTodoEncoder_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewTodoEncoder(&buf, FormatJSON)
+	require.NoError(t, err)
+	require.NoError(t, enc.Close())
+
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestDecodeTodos_CSVWithMapping(t *testing.T) {
+	body := "Task,Notes,Due\n  Buy milk ,2 litres,2026-03-01\nCall bob,,2026-03-02T09:00:00Z\n"
+	mapping, err := ParseColumnMapping("title:Task,description:Notes,due_date:Due")
+	require.NoError(t, err)
+
+	inputs, err := DecodeTodos(strings.NewReader(body), FormatCSV, mapping)
+	require.NoError(t, err)
+
+	require.Len(t, inputs, 2)
+	assert.Equal(t, "Buy milk", inputs[0].Title)
+	assert.Equal(t, "2 litres", inputs[0].Description)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), *inputs[0].DueDate)
+	assert.Equal(t, time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC), *inputs[1].DueDate)
+}
+
+func TestDecodeTodos_ReportsInvalidRows(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		body   string
+		want   []RowError
+	}{
+		{
+			name:   "csv",
+			format: FormatCSV,
+			body:   "title,due_date\nok,\n,\nbad date,tomorrow\n",
+			want: []RowError{
+				{Row: 2, Error: ErrTitleRequired.Error()},
+				{Row: 3, Error: "invalid due_date"},
+			},
+		},
+		{
+			name:   "ndjson",
+			format: FormatNDJSON,
+			body:   "{\"title\": \"ok\"}\n\n{oops}\n{\"title\": \" \"}\n",
+			want: []RowError{
+				{Row: 2, Error: "invalid JSON"},
+				{Row: 3, Error: ErrTitleRequired.Error()},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeTodos(strings.NewReader(tt.body), tt.format, nil)
+
+			var importErr *ImportError
+			require.True(t, errors.As(err, &importErr))
+			assert.Equal(t, tt.want, importErr.Rows)
+		})
+	}
+}
+
+func TestDecodeTodos_MissingTitleColumn(t *testing.T) {
+	_, err := DecodeTodos(strings.NewReader("name\nfoo\n"), FormatCSV, nil)
+
+	assert.ErrorIs(t, err, ErrInvalidImport)
+}
+
+func TestParseColumnMapping_Invalid(t *testing.T) {
+	for _, s := range []string{"title", "title:", "owner:Name"} {
+		_, err := ParseColumnMapping(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestHandler_ExportTodos_UnsupportedFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handler := &Handler{service: &Service{repo: nil}}
+	handler.RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/todos/export?format=xml", nil)
+	rec := httptest.NewRecorder()
+
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
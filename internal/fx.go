@@ -18,11 +18,13 @@ var Module = fx.Options(
 	fx.Provide(
 		NewDB,
 		NewRepository,
+		NewBlobStore,
 		NewService,
+		NewJobRunner,
 		NewHandler,
 		NewRouter,
 	),
-	fx.Invoke(StartServer),
+	fx.Invoke(StartServer, StartAttachmentCollector, StartSnoozeWaker, StartPositionRebalancer),
 )
 
 func NewDB() (*sqlx.DB, error) {
@@ -67,8 +69,9 @@ func NewRouter(handler *Handler) *gin.Engine {
 	r := gin.New()
 	r.Use(gin.Recovery())
 	r.Use(CORSMiddleware())
+	r.Use(RequestIDMiddleware())
 	r.Use(MetricsMiddleware())
-	r.Use(AuthMiddleware())
+	r.Use(AuthMiddleware(handler.service))
 
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
@@ -111,3 +114,41 @@ func StartServer(lc fx.Lifecycle, router *gin.Engine) {
 		},
 	})
 }
+
+// runEvery calls run every interval for the lifetime of the application.
+// The context passed to run is cancelled when the application stops, and
+// stopping waits for a run in progress to return.
+func runEvery(lc fx.Lifecycle, interval time.Duration, run func(context.Context)) {
+	var cancel context.CancelFunc
+	done := make(chan struct{})
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			go func() {
+				defer close(done)
+				ticker := time.NewTicker(interval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-ticker.C:
+					}
+					run(ctx)
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+}
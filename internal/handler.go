@@ -2,19 +2,22 @@ package internal
 
 import (
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Handler struct {
 	service *Service
+	jobs    *JobRunner
 }
 
-func NewHandler(service *Service) *Handler {
-	return &Handler{service: service}
+func NewHandler(service *Service, jobs *JobRunner) *Handler {
+	return &Handler{service: service, jobs: jobs}
 }
 
 func (h *Handler) RegisterRoutes(r *gin.Engine) {
@@ -22,8 +25,92 @@ func (h *Handler) RegisterRoutes(r *gin.Engine) {
 	{
 		v1.POST("/todos", h.CreateTodos)
 		v1.PATCH("/todos", h.UpdateTodos)
+		v1.DELETE("/todos", h.DeleteTodos)
 		v1.GET("/todos", h.ListTodos)
+		v1.POST("/todos:action", h.TodosAction)
+		v1.GET("/todos/search", h.SearchTodos)
+		v1.GET("/todos/export", h.ExportTodos)
+		v1.POST("/todos/import", h.ImportTodos)
+		v1.POST("/todos/import/:source", h.ImportFrom)
+		v1.GET("/todos.ics", h.CalendarFeed)
+		v1.GET("/todos/:id/history", h.GetHistory)
+		v1.GET("/todos/:id/completions", h.GetCompletions)
+		v1.POST("/todos/:id/move", h.MoveTodo)
+		v1.POST("/todos/:id/snooze", h.SnoozeTodo)
+		v1.DELETE("/todos/:id/snooze", h.WakeTodo)
+		v1.POST("/todos/:id/comments", h.CreateComment)
+		v1.GET("/todos/:id/comments", h.ListComments)
+		v1.PATCH("/todos/:id/comments/:comment_id", h.UpdateComment)
+		v1.DELETE("/todos/:id/comments/:comment_id", h.DeleteComment)
+
+		v1.POST("/todos/:id/attachments", h.UploadAttachment)
+		v1.GET("/todos/:id/attachments", h.ListAttachments)
+		v1.DELETE("/todos/:id/attachments/:attachment_id", h.DeleteAttachment)
+		v1.GET("/attachments/:id/download", h.DownloadAttachment)
+
+		v1.POST("/todos/:id/timer/start", h.StartTimer)
+		v1.POST("/todos/:id/timer/stop", h.StopTimer)
+		v1.POST("/todos/:id/time-entries", h.LogTime)
+		v1.GET("/todos/:id/time-entries", h.ListTimeEntries)
+		v1.DELETE("/todos/:id/time-entries/:entry_id", h.DeleteTimeEntry)
+		v1.GET("/timer", h.GetTimer)
+
+		v1.GET("/todos/:id/assignees", h.ListAssignees)
+		v1.POST("/todos/:id/assignees", h.AssignTodo)
+		v1.DELETE("/todos/:id/assignees/:user_id", h.UnassignTodo)
+		v1.GET("/todos/:id/watchers", h.ListWatchers)
+		v1.POST("/todos/:id/watchers", h.WatchTodo)
+		v1.DELETE("/todos/:id/watchers/:user_id", h.UnwatchTodo)
+
+		v1.POST("/users", h.CreateUser)
+		v1.GET("/users", h.ListUsers)
+		v1.GET("/users/:id", h.GetUser)
+		v1.GET("/me", h.GetMe)
+		v1.PATCH("/me", h.UpdateMe)
+		v1.GET("/me/todos", h.MyTodos)
+
+		v1.GET("/inbox", h.GetInbox)
+		v1.POST("/inbox/read", h.MarkInboxRead)
+
+		v1.POST("/operations/:id/undo", h.UndoOperation)
+
+		v1.POST("/views", h.CreateView)
+		v1.GET("/views", h.ListViews)
+		v1.GET("/views/:id", h.GetView)
+		v1.PATCH("/views/:id", h.UpdateView)
+		v1.DELETE("/views/:id", h.DeleteView)
+		v1.GET("/views/:id/todos", h.ViewTodos)
+
+		v1.POST("/lists", h.CreateList)
+		v1.GET("/lists", h.ListLists)
+		v1.GET("/lists/:id", h.GetList)
+		v1.PATCH("/lists/:id", h.UpdateList)
+		v1.DELETE("/lists/:id", h.DeleteList)
+		v1.GET("/lists/:id/board", h.GetBoard)
+		v1.GET("/lists/:id/members", h.ListMembers)
+		v1.PUT("/lists/:id/members/:user_id", h.SetMember)
+		v1.DELETE("/lists/:id/members/:user_id", h.RemoveMember)
+
+		v1.POST("/shares", h.CreateShare)
+		v1.GET("/shares", h.ListShares)
+		v1.DELETE("/shares/:id", h.RevokeShare)
+
+		v1.POST("/feed-tokens", h.CreateFeedToken)
+		v1.GET("/feed-tokens", h.ListFeedTokens)
+		v1.DELETE("/feed-tokens/:id", h.RevokeFeedToken)
+
+		v1.POST("/jobs/import", h.SubmitImportJob)
+		v1.GET("/jobs/:id", h.GetJob)
+		v1.POST("/jobs/:id/cancel", h.CancelJob)
+
+		v1.GET("/stats", h.GetStats)
+		v1.GET("/reports/time", h.GetTimeReport)
+
+		v1.GET("/admin/audit", h.ListAuditEvents)
 	}
+
+	h.registerShared(r)
+	h.registerCalDAV(r)
 }
 
 type ErrorResponse struct {
@@ -40,13 +127,15 @@ func (h *Handler) CreateTodos(c *gin.Context) {
 		return
 	}
 
-	todos, err := h.service.BulkCreate(c.Request.Context(), body.Todos)
+	todos, results, op, err := h.service.BulkUpsert(c.Request.Context(), body.Todos, c.Query("on_conflict"))
 	if err != nil {
 		handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"data": todos})
+	meta := operationMeta(op)
+	meta["results"] = results
+	c.JSON(http.StatusCreated, gin.H{"data": todos, "meta": meta})
 }
 
 func (h *Handler) UpdateTodos(c *gin.Context) {
@@ -59,28 +148,45 @@ func (h *Handler) UpdateTodos(c *gin.Context) {
 		return
 	}
 
-	todos, err := h.service.BulkUpdate(c.Request.Context(), body.Todos)
+	todos, op, err := h.service.BulkUpdate(c.Request.Context(), body.Todos)
 	if err != nil {
 		handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": todos})
+	c.JSON(http.StatusOK, gin.H{"data": todos, "meta": operationMeta(op)})
 }
 
-func (h *Handler) ListTodos(c *gin.Context) {
-	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'page' parameter"})
+func (h *Handler) DeleteTodos(c *gin.Context) {
+	var body struct {
+		IDs []int64 `json:"ids" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
 		return
 	}
-	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	todos, op, err := h.service.BulkDelete(c.Request.Context(), body.IDs)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'limit' parameter"})
+		handleError(c, err)
 		return
 	}
 
-	todos, total, err := h.service.List(c.Request.Context(), page, limit)
+	c.JSON(http.StatusOK, gin.H{"data": todos, "meta": operationMeta(op)})
+}
+
+func (h *Handler) ListTodos(c *gin.Context) {
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	filter, ok := parseListFilter(c)
+	if !ok {
+		return
+	}
+
+	todos, total, err := h.service.List(c.Request.Context(), filter, c.Query("sort"), page, limit)
 	if err != nil {
 		handleError(c, err)
 		return
@@ -96,8 +202,135 @@ func (h *Handler) ListTodos(c *gin.Context) {
 	})
 }
 
+// parsePagination reads the page and limit query parameters. It writes a 400
+// response and returns false if either is malformed.
+func parsePagination(c *gin.Context) (int, int, bool) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'page' parameter"})
+		return 0, 0, false
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'limit' parameter"})
+		return 0, 0, false
+	}
+	return page, limit, true
+}
+
+// parseTodoFilter reads the list filters shared by the endpoints that return
+// todos. It writes a 400 response and returns false if any is malformed.
+func parseTodoFilter(c *gin.Context) (TodoFilter, bool) {
+	filter := TodoFilter{Query: c.Query("q"), Status: c.Query("status")}
+
+	if v := c.Query("query"); v != "" {
+		expr, err := ParseTodoQuery(v)
+		if err != nil {
+			handleError(c, err)
+			return filter, false
+		}
+		filter.Expression = expr
+	}
+
+	if v := c.Query("completed"); v != "" {
+		completed, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'completed' parameter"})
+			return filter, false
+		}
+		filter.Completed = &completed
+	}
+
+	if v := c.Query("assignee"); v != "" {
+		switch v {
+		case "none":
+			filter.Unassigned = true
+		case "me":
+			user, err := currentUser(c.Request.Context())
+			if err != nil {
+				handleError(c, err)
+				return filter, false
+			}
+			filter.AssigneeID = &user.ID
+		default:
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || id <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'assignee' parameter"})
+				return filter, false
+			}
+			filter.AssigneeID = &id
+		}
+	}
+
+	if v := c.Query("list_id"); v != "" {
+		listID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'list_id' parameter"})
+			return filter, false
+		}
+		filter.ListID = &listID
+	}
+
+	var ok bool
+	if filter.DueAfter, ok = parseTimeQuery(c, "due_after"); !ok {
+		return filter, false
+	}
+	if filter.DueBefore, ok = parseTimeQuery(c, "due_before"); !ok {
+		return filter, false
+	}
+	if filter.CompletedAfter, ok = parseTimeQuery(c, "completed_after"); !ok {
+		return filter, false
+	}
+	if filter.CompletedBefore, ok = parseTimeQuery(c, "completed_before"); !ok {
+		return filter, false
+	}
+	return filter, true
+}
+
+// parseListFilter reads the filters of the list views: those of
+// parseTodoFilter, narrowed to the todos actionable now unless include is
+// snoozed.
+func parseListFilter(c *gin.Context) (TodoFilter, bool) {
+	filter, ok := parseTodoFilter(c)
+	if !ok {
+		return filter, false
+	}
+	switch c.Query("include") {
+	case "":
+		now := time.Now()
+		filter.ActionableAt = &now
+	case "snoozed":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'include' parameter"})
+		return filter, false
+	}
+	return filter, true
+}
+
+// parseTimeQuery reads an optional RFC3339 query parameter. It writes a 400
+// response and returns false if the value is malformed.
+func parseTimeQuery(c *gin.Context, name string) (*time.Time, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, true
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid '%s' parameter", name)})
+		return nil, false
+	}
+	return &t, true
+}
+
 func handleError(c *gin.Context, err error) {
+	var (
+		importErr *ImportError
+		queryErr  *QueryError
+	)
+
 	switch {
+	case errors.Is(err, ErrUnauthorized):
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: ErrUnauthorized.Error()})
 	case errors.Is(err, ErrNotFound):
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: ErrNotFound.Error()})
 	case errors.Is(err, ErrDuplicateTitle):
@@ -110,12 +343,142 @@ func handleError(c *gin.Context, err error) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrTitleMaxLength.Error()})
 	case errors.Is(err, ErrInvalidID):
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+	case errors.Is(err, ErrInvalidPriority):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidPriority.Error()})
+	case errors.Is(err, ErrInvalidTag):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidTag.Error()})
+	case errors.Is(err, ErrInvalidExternalID):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidExternalID.Error()})
+	case errors.Is(err, ErrInvalidOnConflict):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidOnConflict.Error()})
+	case errors.Is(err, ErrEmptyPatch):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrEmptyPatch.Error()})
+	case errors.Is(err, ErrPreviewRequired):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrPreviewRequired.Error()})
+	case errors.Is(err, ErrTooManyMatches):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrTooManyMatches.Error()})
+	case errors.Is(err, ErrInvalidSearch):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidSearch.Error()})
+	case errors.Is(err, ErrInvalidViewName):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidViewName.Error()})
+	case errors.Is(err, ErrDuplicateView):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: ErrDuplicateView.Error()})
+	case errors.Is(err, ErrInvalidInterval):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidInterval.Error()})
+	case errors.Is(err, ErrInvalidTimezone):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidTimezone.Error()})
+	case errors.Is(err, ErrInvalidStatsRange):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidStatsRange.Error()})
+	case errors.Is(err, ErrTooManyBuckets):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrTooManyBuckets.Error()})
+	case errors.Is(err, ErrInvalidList):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidList.Error()})
+	case errors.Is(err, ErrInvalidListName):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidListName.Error()})
+	case errors.Is(err, ErrDuplicateList):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: ErrDuplicateList.Error()})
+	case errors.Is(err, ErrListNotEmpty):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: ErrListNotEmpty.Error()})
+	case errors.Is(err, ErrInvalidWorkflow), errors.Is(err, ErrInvalidStatus):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, ErrStateInUse), errors.Is(err, ErrInvalidTransition), errors.Is(err, ErrWIPLimitExceeded):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, ErrInvalidMove):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidMove.Error()})
+	case errors.Is(err, ErrPositionTie):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: ErrPositionTie.Error()})
+	case errors.Is(err, ErrInvalidSort):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidSort.Error()})
+	case errors.Is(err, ErrInvalidComment):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidComment.Error()})
+	case errors.Is(err, ErrTooManyMentions):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrTooManyMentions.Error()})
+	case errors.Is(err, ErrNotCommentAuthor):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: ErrNotCommentAuthor.Error()})
+	case errors.Is(err, ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidCursor.Error()})
+	case errors.Is(err, ErrInvalidMarkRead):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidMarkRead.Error()})
+	case errors.Is(err, ErrEmptyAttachment):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrEmptyAttachment.Error()})
+	case errors.Is(err, ErrAttachmentTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: ErrAttachmentTooLarge.Error()})
+	case errors.Is(err, ErrAttachmentType):
+		c.JSON(http.StatusUnsupportedMediaType, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, ErrInvalidDownloadURL):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: ErrInvalidDownloadURL.Error()})
+	case errors.Is(err, ErrInvalidUserName):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidUserName.Error()})
+	case errors.Is(err, ErrInvalidTenant):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidTenant.Error()})
+	case errors.Is(err, ErrDuplicateUser):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: ErrDuplicateUser.Error()})
+	case errors.Is(err, ErrAdminOnly):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: ErrAdminOnly.Error()})
+	case errors.Is(err, ErrNoCurrentUser):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: ErrNoCurrentUser.Error()})
+	case errors.Is(err, ErrInvalidUser):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidUser.Error()})
+	case errors.Is(err, ErrUserTimezone):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrUserTimezone.Error()})
+	case errors.Is(err, ErrTenantMismatch):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrTenantMismatch.Error()})
+	case errors.Is(err, ErrInvalidShare):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidShare.Error()})
+	case errors.Is(err, ErrInvalidShareExpiry):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidShareExpiry.Error()})
+	case errors.Is(err, ErrInvalidShareLink):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: ErrInvalidShareLink.Error()})
+	case errors.Is(err, ErrSharePermission):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: ErrSharePermission.Error()})
+	case errors.Is(err, ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidRole.Error()})
+	case errors.Is(err, ErrInsufficientRole):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: ErrInsufficientRole.Error()})
+	case errors.Is(err, ErrLastOwner):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: ErrLastOwner.Error()})
+	case errors.Is(err, ErrListRequired):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrListRequired.Error()})
+	case errors.Is(err, ErrInvalidEstimate):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidEstimate.Error()})
+	case errors.Is(err, ErrInvalidTimeEntry):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidTimeEntry.Error()})
+	case errors.Is(err, ErrTimerRunning):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: ErrTimerRunning.Error()})
+	case errors.Is(err, ErrNoRunningTimer):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: ErrNoRunningTimer.Error()})
+	case errors.Is(err, ErrNotEntryActor):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: ErrNotEntryActor.Error()})
+	case errors.Is(err, ErrInvalidSnooze):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidSnooze.Error()})
 	case errors.Is(err, ErrEmptyList):
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrEmptyList.Error()})
 	case errors.Is(err, ErrDuplicateInRequest):
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrDuplicateInRequest.Error()})
 	case errors.Is(err, ErrLimitExceeded):
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrLimitExceeded.Error()})
+	case errors.Is(err, ErrConflict):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: ErrConflict.Error()})
+	case errors.Is(err, ErrOperationUndone):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: ErrOperationUndone.Error()})
+	case errors.Is(err, ErrOperationExpired):
+		c.JSON(http.StatusGone, ErrorResponse{Error: ErrOperationExpired.Error()})
+	case errors.Is(err, ErrJobFinished):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: ErrJobFinished.Error()})
+	case errors.Is(err, ErrPreconditionFailed):
+		c.JSON(http.StatusPreconditionFailed, ErrorResponse{Error: ErrPreconditionFailed.Error()})
+	case errors.Is(err, ErrInvalidSyncToken):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: ErrInvalidSyncToken.Error()})
+	case errors.Is(err, ErrUnsupportedFormat):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrUnsupportedFormat.Error()})
+	case errors.Is(err, ErrUnknownSource):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrUnknownSource.Error()})
+	case errors.Is(err, ErrInvalidImport):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.As(err, &queryErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": queryErr.Error(), "position": queryErr.Position})
+	case errors.As(err, &importErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rows", "rows": importErr.Rows})
 	default:
 		// Log unexpected errors
 		slog.Error("Unexpected error",
@@ -123,6 +486,7 @@ func handleError(c *gin.Context, err error) {
 			"method", c.Request.Method,
 			"path", c.Request.URL.Path,
 			"client_ip", c.ClientIP(),
+			"request_id", RequestIDFromContext(c.Request.Context()),
 		)
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
 	}
@@ -13,6 +13,7 @@ import (
 func TestHandler_CreateTodos(t *testing.T) {
 	tests := []struct {
 		name           string
+		query          string
 		body           string
 		expectedStatus int
 	}{
@@ -26,6 +27,12 @@ func TestHandler_CreateTodos(t *testing.T) {
 			body:           `{"todos": []}`,
 			expectedStatus: http.StatusBadRequest,
 		},
+		{
+			name:           "invalid on_conflict",
+			query:          "?on_conflict=replace",
+			body:           `{"todos": [{"title": "a"}]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
@@ -36,7 +43,7 @@ func TestHandler_CreateTodos(t *testing.T) {
 			handler := &Handler{service: service}
 			handler.RegisterRoutes(r)
 
-			req := httptest.NewRequest(http.MethodPost, "/v1/todos", bytes.NewBufferString(tt.body))
+			req := httptest.NewRequest(http.MethodPost, "/v1/todos"+tt.query, bytes.NewBufferString(tt.body))
 			req.Header.Set("Content-Type", "application/json")
 			rec := httptest.NewRecorder()
 
@@ -46,3 +53,64 @@ func TestHandler_CreateTodos(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_DeleteTodos(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "invalid json",
+			body:           "{invalid}",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "empty ids",
+			body:           `{"ids": []}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid id",
+			body:           `{"ids": [0]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "duplicate ids",
+			body:           `{"ids": [1, 1]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			service := &Service{repo: nil}
+			handler := &Handler{service: service}
+			handler.RegisterRoutes(r)
+
+			req := httptest.NewRequest(http.MethodDelete, "/v1/todos", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestHandler_GetHistory_InvalidID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handler := &Handler{service: &Service{repo: nil}}
+	handler.RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/todos/abc/history", nil)
+	rec := httptest.NewRecorder()
+
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
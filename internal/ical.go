@@ -0,0 +1,566 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const FormatICS = "ics"
+
+const icsTimeLayout = "20060102T150405Z"
+
+// icsEncoder writes todos as RFC 5545 VTODO components of one VCALENDAR.
+type icsEncoder struct {
+	w       *bufio.Writer
+	now     time.Time
+	started bool
+}
+
+func newICSEncoder(w io.Writer) *icsEncoder {
+	return &icsEncoder{w: bufio.NewWriter(w), now: time.Now()}
+}
+
+func (e *icsEncoder) begin() {
+	if e.started {
+		return
+	}
+	e.started = true
+	writeICSLine(e.w, "BEGIN:VCALENDAR")
+	writeICSLine(e.w, "VERSION:2.0")
+	writeICSLine(e.w, "PRODID:-//todox//todox//EN")
+	writeICSLine(e.w, "X-WR-CALNAME:todox")
+}
+
+func (e *icsEncoder) Encode(todo *Todo) error {
+	e.begin()
+	for _, line := range vtodoLines(todo, e.now) {
+		writeICSLine(e.w, line)
+	}
+	return e.w.Flush()
+}
+
+func (e *icsEncoder) Close() error {
+	e.begin()
+	writeICSLine(e.w, "END:VCALENDAR")
+	return e.w.Flush()
+}
+
+// vtodoLines returns the unfolded content lines of a VTODO for todo.
+func vtodoLines(todo *Todo, stamp time.Time) []string {
+	lines := []string{
+		"BEGIN:VTODO",
+		"UID:" + escapeICSText(todo.UID),
+		"DTSTAMP:" + formatICSTime(stamp),
+		"CREATED:" + formatICSTime(todo.CreatedAt),
+		"LAST-MODIFIED:" + formatICSTime(todo.UpdatedAt),
+		"SUMMARY:" + escapeICSText(todo.Title),
+	}
+	if todo.Description != "" {
+		lines = append(lines, "DESCRIPTION:"+escapeICSText(todo.Description))
+	}
+	if todo.DueDate != nil {
+		lines = append(lines, "DUE:"+formatICSTime(*todo.DueDate))
+	}
+	if todo.Completed {
+		lines = append(lines, "STATUS:COMPLETED", "COMPLETED:"+formatICSTime(todo.UpdatedAt))
+	} else {
+		lines = append(lines, "STATUS:NEEDS-ACTION")
+	}
+	return append(lines, "END:VTODO")
+}
+
+func formatICSTime(t time.Time) string {
+	return t.UTC().Format(icsTimeLayout)
+}
+
+// writeICSLine writes a content line terminated by CRLF, folding it so that
+// no physical line exceeds 75 octets. Folds never split a UTF-8 sequence.
+func writeICSLine(w *bufio.Writer, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		_, _ = w.WriteString(line[:cut])
+		_, _ = w.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts towards the limit.
+		limit = 74
+	}
+	_, _ = w.WriteString(line)
+	_, _ = w.WriteString("\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+var (
+	icsTextEscaper   = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	icsTextUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+)
+
+func escapeICSText(s string) string {
+	return icsTextEscaper.Replace(s)
+}
+
+// CalendarTodo is a VTODO parsed for import. UID identifies the todo across
+// repeated imports.
+type CalendarTodo struct {
+	CreateTodoInput
+	UID       string
+	Completed bool
+}
+
+// icsProperty is one unfolded content line.
+type icsProperty struct {
+	Params map[string]string
+	Name   string
+	Value  string
+}
+
+// readICSProperties unfolds and splits the content lines of an iCalendar
+// stream.
+func readICSProperties(r io.Reader) ([]icsProperty, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var (
+		props []icsProperty
+		lines []string
+	)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if len(lines) > 0 {
+				lines[len(lines)-1] += line[1:]
+			}
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		prop, err := parseICSProperty(line)
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, prop)
+	}
+	return props, nil
+}
+
+func parseICSProperty(line string) (icsProperty, error) {
+	// The name and parameters end at the first colon outside a quoted
+	// parameter value.
+	quoted := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		}
+		if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return icsProperty{}, fmt.Errorf("invalid content line %q", line)
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	prop := icsProperty{
+		Name:   strings.ToUpper(parts[0]),
+		Value:  line[colon+1:],
+		Params: make(map[string]string, len(parts)-1),
+	}
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		prop.Params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+	return prop, nil
+}
+
+// parseICSTime parses a DATE or DATE-TIME value. Floating times are read in
+// the zone named by TZID, or UTC if there is none.
+func parseICSTime(prop icsProperty) (time.Time, error) {
+	loc := time.UTC
+	if tzid := prop.Params["TZID"]; tzid != "" {
+		l, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unknown TZID %q", tzid)
+		}
+		loc = l
+	}
+
+	v := prop.Value
+	switch {
+	case prop.Params["VALUE"] == "DATE" || len(v) == 8:
+		return time.ParseInLocation("20060102", v, loc)
+	case strings.HasSuffix(v, "Z"):
+		return time.Parse(icsTimeLayout, v)
+	default:
+		return time.ParseInLocation("20060102T150405", v, loc)
+	}
+}
+
+// ParseCalendarTodos reads every VTODO from an iCalendar stream. Components
+// other than VTODO are ignored. Each todo is validated with
+// CreateTodoInput.Validate; invalid ones are reported in an *ImportError.
+func ParseCalendarTodos(r io.Reader) ([]CalendarTodo, error) {
+	props, err := readICSProperties(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+
+	var (
+		todos   []CalendarTodo
+		rows    []RowError
+		current *CalendarTodo
+		bad     string
+	)
+	for _, prop := range props {
+		switch {
+		case prop.Name == "BEGIN" && strings.EqualFold(prop.Value, "VTODO"):
+			current = &CalendarTodo{}
+			bad = ""
+		case prop.Name == "END" && strings.EqualFold(prop.Value, "VTODO") && current != nil:
+			row := len(todos) + 1
+			switch {
+			case bad != "":
+				rows = append(rows, RowError{Row: row, Error: bad})
+			case current.UID == "":
+				rows = append(rows, RowError{Row: row, Error: "UID is required"})
+			default:
+				if err := current.Validate(); err != nil {
+					rows = append(rows, RowError{Row: row, Error: err.Error()})
+				}
+			}
+			todos = append(todos, *current)
+			current = nil
+		case current == nil:
+			continue
+		case prop.Name == "UID":
+			current.UID = prop.Value
+		case prop.Name == "SUMMARY":
+			current.Title = icsTextUnescaper.Replace(prop.Value)
+		case prop.Name == "DESCRIPTION":
+			current.Description = icsTextUnescaper.Replace(prop.Value)
+		case prop.Name == "DUE":
+			due, err := parseICSTime(prop)
+			if err != nil {
+				bad = "invalid DUE"
+				continue
+			}
+			current.DueDate = &due
+		case prop.Name == "STATUS":
+			current.Completed = strings.EqualFold(prop.Value, "COMPLETED")
+		case prop.Name == "COMPLETED":
+			current.Completed = true
+		}
+	}
+
+	if len(rows) > 0 {
+		return nil, &ImportError{Rows: rows}
+	}
+	return todos, nil
+}
+
+// UpsertByUID creates todos whose UID is new and updates the ones that
+// already exist, keeping their ID and creation time. Unless check is nil, it
+// is called with the locked row of each todo, nil for a new UID, before the
+// todo is written, and its error aborts the upsert.
+func (r *Repository) UpsertByUID(ctx context.Context, op *Operation, todos []*Todo, check func(existing *Todo) error) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		events := make([]TodoEvent, 0, len(todos))
+		for _, todo := range todos {
+			var existing Todo
+			err := tx.GetContext(ctx, &existing, "SELECT * FROM todos WHERE uid = ? FOR UPDATE", todo.UID)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			found := err == nil
+			if check != nil {
+				current := &existing
+				if !found {
+					current = nil
+				}
+				if err := check(current); err != nil {
+					return err
+				}
+			}
+
+			if !found {
+				checks, err := enforceWorkflows(ctx, tx, nil, []*Todo{todo})
+				if err != nil {
+					return err
+				}
+				if err := insertTodo(ctx, tx, todo); err != nil {
+					return err
+				}
+				if err := checkWIP(ctx, tx, checks); err != nil {
+					return err
+				}
+				events = append(events, newTodoEvent(ctx, op, EventCreated, nil, todo))
+				continue
+			}
+
+			// VTODOs do not carry todox's priority, estimate, start date,
+			// snooze, tags, list and workflow status, so keep them;
+			// completing or reopening the VTODO moves the todo like a v1
+			// client setting completed.
+			todo.ID = existing.ID
+			todo.CreatedAt = existing.CreatedAt
+			todo.Priority = existing.Priority
+			todo.EstimateMinutes = existing.EstimateMinutes
+			todo.StartDate = existing.StartDate
+			todo.SnoozedUntil = existing.SnoozedUntil
+			todo.Tags = existing.Tags
+			todo.ListID = existing.ListID
+			todo.Status = existing.Status
+			checks, err := enforceWorkflows(ctx, tx, []*Todo{&existing}, []*Todo{todo})
+			if err != nil {
+				return err
+			}
+			if err := updateTodo(ctx, tx, &existing, todo); err != nil {
+				return err
+			}
+			if err := checkWIP(ctx, tx, checks); err != nil {
+				return err
+			}
+			events = append(events, newTodoEvent(ctx, op, EventUpdated, &existing, todo))
+		}
+
+		// The operation is recorded last, so that check may still set its
+		// kind.
+		if err := insertOperation(ctx, tx, op); err != nil {
+			return err
+		}
+		return insertEvents(ctx, tx, events)
+	})
+}
+
+// ImportCalendar creates or updates todos from the VTODOs of an iCalendar
+// stream in a single operation. Todos are matched on UID, so importing the
+// same file twice updates rather than duplicates.
+func (s *Service) ImportCalendar(ctx context.Context, r io.Reader) ([]*Todo, *Operation, error) {
+	// Todos are matched on UID among all todos, whatever their list.
+	if err := authorizeAdmin(ctx); err != nil {
+		return nil, nil, err
+	}
+	items, err := ParseCalendarTodos(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(items) == 0 {
+		return nil, nil, ErrEmptyList
+	}
+
+	seen := make(map[string]bool)
+	now := time.Now()
+	todos := make([]*Todo, 0, len(items))
+	for _, item := range items {
+		if seen[item.UID] {
+			return nil, nil, ErrDuplicateInRequest
+		}
+		seen[item.UID] = true
+
+		todo := newTodo(item.CreateTodoInput, now)
+		todo.UID = item.UID
+		todo.Completed = item.Completed
+		todos = append(todos, todo)
+	}
+
+	op := s.newOperation(ctx, OperationImport)
+	if err := s.repo.UpsertByUID(ctx, op, todos, nil); err != nil {
+		return nil, nil, err
+	}
+	return todos, op, nil
+}
+
+// FeedToken grants read access to the calendar feed of the actor that
+// created it. Only a hash of the token is stored.
+type FeedToken struct {
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	Actor     string     `json:"actor" db:"actor"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	Token     string     `json:"token,omitempty" db:"-"`
+	ID        int64      `json:"id" db:"id"`
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *Repository) CreateFeedToken(ctx context.Context, token *FeedToken) error {
+	result, err := r.db.NamedExecContext(ctx,
+		`INSERT INTO feed_tokens (actor, token_hash, created_at) VALUES (:actor, :token_hash, :created_at)`, token)
+	if err != nil {
+		return err
+	}
+	token.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *Repository) ListFeedTokens(ctx context.Context, actor string) ([]FeedToken, error) {
+	tokens := []FeedToken{}
+	err := r.db.SelectContext(ctx, &tokens,
+		"SELECT id, actor, token_hash, created_at, revoked_at FROM feed_tokens WHERE actor = ? ORDER BY id DESC", actor)
+	return tokens, err
+}
+
+// FeedTokenActor returns the actor owning an unrevoked token with the given
+// hash.
+func (r *Repository) FeedTokenActor(ctx context.Context, tokenHash string) (string, error) {
+	var actor string
+	err := r.db.GetContext(ctx, &actor,
+		"SELECT actor FROM feed_tokens WHERE token_hash = ? AND revoked_at IS NULL", tokenHash)
+	if err == sql.ErrNoRows {
+		return "", ErrUnauthorized
+	}
+	return actor, err
+}
+
+func (r *Repository) RevokeFeedToken(ctx context.Context, id int64, actor string, now time.Time) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE feed_tokens SET revoked_at = ? WHERE id = ? AND actor = ? AND revoked_at IS NULL", now, id, actor)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CreateFeedToken issues a new feed token for the caller. The plain token is
+// only ever returned here.
+func (s *Service) CreateFeedToken(ctx context.Context) (*FeedToken, error) {
+	plain := RandomID() + RandomID()
+	token := &FeedToken{
+		Actor:     ActorFromContext(ctx),
+		TokenHash: hashToken(plain),
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.CreateFeedToken(ctx, token); err != nil {
+		return nil, err
+	}
+	token.Token = plain
+	return token, nil
+}
+
+func (s *Service) ListFeedTokens(ctx context.Context) ([]FeedToken, error) {
+	return s.repo.ListFeedTokens(ctx, ActorFromContext(ctx))
+}
+
+func (s *Service) RevokeFeedToken(ctx context.Context, id int64) error {
+	if id <= 0 {
+		return ErrInvalidID
+	}
+	return s.repo.RevokeFeedToken(ctx, id, ActorFromContext(ctx), time.Now())
+}
+
+// AuthenticateFeed returns ctx attributed to the owner of a feed token. A
+// token issued to a user only serves what that user can see.
+func (s *Service) AuthenticateFeed(ctx context.Context, token string) (context.Context, error) {
+	actor, err := s.repo.FeedTokenActor(ctx, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.repo.GetUserByName(ctx, actor)
+	if err == nil {
+		ctx = WithUser(ctx, user)
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	return WithActor(ctx, actor), nil
+}
+
+// CalendarFeed serves the todos matching the list filters as an iCalendar
+// feed. Calendar apps cannot send headers, so a feed token may be passed as
+// the token query parameter instead of the API key.
+func (h *Handler) CalendarFeed(c *gin.Context) {
+	ctx := c.Request.Context()
+	if token := c.Query("token"); token != "" {
+		var err error
+		if ctx, err = h.service.AuthenticateFeed(ctx, token); err != nil {
+			handleError(c, err)
+			return
+		}
+	}
+
+	filter, ok := parseTodoFilter(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	if err := h.service.Export(ctx, filter, newICSEncoder(c.Writer)); err != nil {
+		logStreamError(c, err, FormatICS)
+	}
+}
+
+func (h *Handler) CreateFeedToken(c *gin.Context) {
+	token, err := h.service.CreateFeedToken(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": token,
+		"meta": gin.H{"feed_url": "/v1/todos.ics?token=" + token.Token},
+	})
+}
+
+func (h *Handler) ListFeedTokens(c *gin.Context) {
+	tokens, err := h.service.ListFeedTokens(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": tokens})
+}
+
+func (h *Handler) RevokeFeedToken(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+
+	if err := h.service.RevokeFeedToken(c.Request.Context(), id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
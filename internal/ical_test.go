@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestICSEncoder(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	due := time.Date(2026, 2, 1, 9, 0, 0, 0, time.FixedZone("SAST", 2*60*60))
+	todo := &Todo{
+		ID:          1,
+		UID:         "abc@todox",
+		Title:       "Plan; review, ship",
+		Description: "line one\nline two",
+		DueDate:     &due,
+		Completed:   true,
+		CreatedAt:   created,
+		UpdatedAt:   created,
+	}
+
+	var buf bytes.Buffer
+	enc := newICSEncoder(&buf)
+	enc.now = created
+	require.NoError(t, enc.Encode(todo))
+	require.NoError(t, enc.Close())
+
+	want := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//todox//todox//EN",
+		"X-WR-CALNAME:todox",
+		"BEGIN:VTODO",
+		"UID:abc@todox",
+		"DTSTAMP:20260102T030405Z",
+		"CREATED:20260102T030405Z",
+		"LAST-MODIFIED:20260102T030405Z",
+		`SUMMARY:Plan\; review\, ship`,
+		`DESCRIPTION:line one\nline two`,
+		"DUE:20260201T070000Z",
+		"STATUS:COMPLETED",
+		"COMPLETED:20260102T030405Z",
+		"END:VTODO",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+	assert.Equal(t, want, buf.String())
+}
+
+func TestWriteICSLine_Folds(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	line := "SUMMARY:" + strings.Repeat("é", 100)
+
+	writeICSLine(w, line)
+	require.NoError(t, w.Flush())
+
+	physical := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+	assert.Greater(t, len(physical), 1)
+	for _, p := range physical {
+		assert.LessOrEqual(t, len(p), 75)
+	}
+
+	props, err := readICSProperties(&buf)
+	require.NoError(t, err)
+	require.Len(t, props, 1)
+	assert.Equal(t, strings.Repeat("é", 100), props[0].Value)
+}
+
+func TestParseCalendarTodos_RoundTrip(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	due := time.Date(2026, 2, 1, 9, 0, 0, 0, time.UTC)
+	todos := []*Todo{
+		{UID: "a@todox", Title: "Plan; review, ship", Description: `back\slash` + "\nnext", DueDate: &due, CreatedAt: created, UpdatedAt: created},
+		{UID: "b@todox", Title: "Done already", Completed: true, CreatedAt: created, UpdatedAt: created},
+	}
+
+	var buf bytes.Buffer
+	enc := newICSEncoder(&buf)
+	for _, todo := range todos {
+		require.NoError(t, enc.Encode(todo))
+	}
+	require.NoError(t, enc.Close())
+
+	got, err := ParseCalendarTodos(&buf)
+	require.NoError(t, err)
+
+	require.Len(t, got, 2)
+	assert.Equal(t, "a@todox", got[0].UID)
+	assert.Equal(t, todos[0].Title, got[0].Title)
+	assert.Equal(t, todos[0].Description, got[0].Description)
+	assert.Equal(t, due, *got[0].DueDate)
+	assert.False(t, got[0].Completed)
+	assert.Equal(t, "b@todox", got[1].UID)
+	assert.True(t, got[1].Completed)
+	assert.Nil(t, got[1].DueDate)
+}
+
+func TestParseCalendarTodos_DueForms(t *testing.T) {
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:ignored",
+		"SUMMARY:not a todo",
+		"END:VEVENT",
+		"BEGIN:VTODO",
+		"UID:date",
+		"SUMMARY:date only",
+		"DUE;VALUE=DATE:20260301",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:zoned",
+		"SUMMARY:zoned",
+		`DUE;TZID="America/New_York":20260301T090000`,
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\n")
+
+	got, err := ParseCalendarTodos(strings.NewReader(ics))
+	require.NoError(t, err)
+
+	require.Len(t, got, 2)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), *got[0].DueDate)
+	assert.Equal(t, time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC), got[1].DueDate.UTC())
+}
+
+func TestParseCalendarTodos_InvalidRows(t *testing.T) {
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VTODO",
+		"SUMMARY:no uid",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:x",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:y",
+		"SUMMARY:bad due",
+		"DUE:tomorrow",
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	_, err := ParseCalendarTodos(strings.NewReader(ics))
+
+	var importErr *ImportError
+	require.True(t, errors.As(err, &importErr))
+	assert.Equal(t, []RowError{
+		{Row: 1, Error: "UID is required"},
+		{Row: 2, Error: ErrTitleRequired.Error()},
+		{Row: 3, Error: "invalid DUE"},
+	}, importErr.Rows)
+}
@@ -0,0 +1,300 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Tools whose export files can be imported.
+const (
+	SourceTodoist = "todoist"
+	SourceTrello  = "trello"
+	SourceJira    = "jira"
+)
+
+// Outcomes of importing or upserting a single todo.
+const (
+	ResultCreated = "created"
+	ResultUpdated = "updated"
+	ResultSkipped = "skipped"
+)
+
+// ImportedTodo is one todo read from another tool's export file. Fields
+// todox has no column for are already folded into the description.
+type ImportedTodo struct {
+	CreateTodoInput
+	Subtasks  []*ImportedTodo
+	Completed bool
+}
+
+// Importer reads the export file of another todo tool.
+type Importer interface {
+	Parse(r io.Reader) ([]*ImportedTodo, error)
+}
+
+var importers = map[string]Importer{
+	SourceTodoist: todoistImporter{},
+	SourceTrello:  trelloImporter{},
+	SourceJira:    jiraImporter{},
+}
+
+// ImportReport describes the todos an import created or, in a dry run, would
+// create. Todos whose title already exists are skipped rather than failing
+// the import.
+type ImportReport struct {
+	Items   []ImportResult `json:"items"`
+	Source  string         `json:"source"`
+	Created int            `json:"created"`
+	Skipped int            `json:"skipped"`
+	DryRun  bool           `json:"dry_run"`
+}
+
+// ImportResult is the outcome for one imported todo. For a skipped todo it
+// holds the existing todo with the same title. Parent is the title of the
+// todo a subtask belongs to.
+type ImportResult struct {
+	Todo   *Todo  `json:"todo"`
+	Parent string `json:"parent,omitempty"`
+	Result string `json:"result"`
+}
+
+// importNode is an imported todo in depth-first order, parents first.
+type importNode struct {
+	item   *ImportedTodo
+	parent int
+}
+
+func flattenImported(items []*ImportedTodo, parent int, nodes []importNode) []importNode {
+	for _, item := range items {
+		nodes = append(nodes, importNode{item: item, parent: parent})
+		nodes = flattenImported(item.Subtasks, len(nodes)-1, nodes)
+	}
+	return nodes
+}
+
+// importNotes collects fields of an imported todo that todox has no column
+// for. They are appended to the description as "Name: value" lines.
+type importNotes []string
+
+func (n *importNotes) add(name, value string) {
+	if value = strings.TrimSpace(value); value != "" {
+		*n = append(*n, name+": "+value)
+	}
+}
+
+func (n importNotes) description(desc string) string {
+	desc = strings.TrimSpace(desc)
+	if len(n) == 0 {
+		return desc
+	}
+	notes := strings.Join(n, "\n")
+	if desc == "" {
+		return notes
+	}
+	return desc + "\n\n" + notes
+}
+
+// importTag turns a label from another tool into a valid tag by replacing
+// whitespace and commas with dashes.
+func importTag(label string) string {
+	tag := strings.Join(strings.FieldsFunc(label, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ','
+	}), "-")
+	for len(tag) > 64 {
+		_, size := utf8.DecodeLastRuneInString(tag)
+		tag = tag[:len(tag)-size]
+	}
+	return tag
+}
+
+// importFieldLabel turns a column name such as "DATE_LANG" into "Date lang".
+func importFieldLabel(name string) string {
+	name = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), "_", " "))
+	if name == "" {
+		return name
+	}
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+// parseImportDate parses the date formats other tools export, in addition to
+// RFC3339 and YYYY-MM-DD. Times without a zone are read as UTC.
+func parseImportDate(s string, layouts ...string) (*time.Time, bool) {
+	layouts = append([]string{time.RFC3339, time.DateOnly, "2006-01-02T15:04:05", time.DateTime}, layouts...)
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t, true
+		}
+	}
+	return nil, false
+}
+
+// trimBOM removes the byte order mark some tools write at the start of CSV
+// files.
+func trimBOM(s string) string {
+	return strings.TrimPrefix(s, "\ufeff")
+}
+
+// titleKey is the key titles are compared by when deduplicating. It
+// approximates the case-insensitive collation of the title column.
+func titleKey(title string) string {
+	return strings.ToLower(title)
+}
+
+// IDsByTitle returns the IDs of the todos with the given titles, keyed by
+// titleKey.
+func (r *Repository) IDsByTitle(ctx context.Context, titles []string) (map[string]int64, error) {
+	const chunkSize = 500
+
+	ids := make(map[string]int64, len(titles))
+	for start := 0; start < len(titles); start += chunkSize {
+		chunk := titles[start:min(start+chunkSize, len(titles))]
+		query, args, err := sqlx.In("SELECT id, title FROM todos WHERE title IN (?)", chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		var rows []struct {
+			Title string `db:"title"`
+			ID    int64  `db:"id"`
+		}
+		if err := r.db.SelectContext(ctx, &rows, r.db.Rebind(query), args...); err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			ids[titleKey(row.Title)] = row.ID
+		}
+	}
+	return ids, nil
+}
+
+// ImportFrom imports another tool's export file in a single import
+// operation. Todos whose title already exists, in the database or earlier in
+// the file, are skipped; subtasks of a skipped todo are attached to the
+// existing one. A dry run only reports what would be created. The operation
+// is nil if nothing was created.
+func (s *Service) ImportFrom(ctx context.Context, source string, r io.Reader, dryRun bool) (*ImportReport, *Operation, error) {
+	importer, ok := importers[source]
+	if !ok {
+		return nil, nil, ErrUnknownSource
+	}
+	items, err := importer.Parse(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nodes := flattenImported(items, -1, nil)
+	if len(nodes) == 0 {
+		return nil, nil, ErrEmptyList
+	}
+	if err := validateRows(len(nodes), func(i int) *CreateTodoInput { return &nodes[i].item.CreateTodoInput }, nil); err != nil {
+		return nil, nil, err
+	}
+	listIDs := make([]*int64, len(nodes))
+	for i, node := range nodes {
+		listIDs[i] = node.item.ListID
+	}
+	if err := s.authorizeNewTodos(ctx, listIDs); err != nil {
+		return nil, nil, err
+	}
+
+	titles := make([]string, len(nodes))
+	for i, node := range nodes {
+		titles[i] = node.item.Title
+	}
+	existing, err := s.repo.IDsByTitle(ctx, titles)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &ImportReport{Source: source, DryRun: dryRun, Items: make([]ImportResult, 0, len(nodes))}
+	planned := make(map[string]*Todo)
+	resolved := make([]*Todo, len(nodes))
+	todos := make([]*Todo, 0, len(nodes))
+	now := time.Now()
+
+	for i, node := range nodes {
+		result := ImportResult{Result: ResultSkipped}
+		key := titleKey(node.item.Title)
+		if id, ok := existing[key]; ok {
+			resolved[i] = &Todo{ID: id, Title: node.item.Title}
+		} else if todo, ok := planned[key]; ok {
+			resolved[i] = todo
+		} else {
+			todo := newTodo(node.item.CreateTodoInput, now)
+			todo.Completed = node.item.Completed
+			if node.parent >= 0 {
+				// Parents are created before their subtasks in the same
+				// transaction, so by the time a subtask is inserted this
+				// points at its parent's new ID.
+				parent := resolved[node.parent]
+				if !dryRun || parent.ID != 0 {
+					todo.ParentID = &parent.ID
+				}
+			}
+			planned[key] = todo
+			resolved[i] = todo
+			todos = append(todos, todo)
+			result.Result = ResultCreated
+		}
+
+		result.Todo = resolved[i]
+		if node.parent >= 0 {
+			result.Parent = resolved[node.parent].Title
+		}
+		if result.Result == ResultCreated {
+			report.Created++
+		} else {
+			report.Skipped++
+		}
+		report.Items = append(report.Items, result)
+	}
+
+	if dryRun || len(todos) == 0 {
+		return report, nil, nil
+	}
+
+	op := s.newOperation(ctx, OperationImport)
+	if err := s.repo.BulkCreate(ctx, op, todos); err != nil {
+		return nil, nil, err
+	}
+	return report, op, nil
+}
+
+func (h *Handler) ImportFrom(c *gin.Context) {
+	dryRun := false
+	if v := c.Query("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'dry_run' parameter"})
+			return
+		}
+	}
+
+	body, ok := requestFile(c)
+	if !ok {
+		return
+	}
+	defer body.Close()
+
+	report, op, err := h.service.ImportFrom(c.Request.Context(), c.Param("source"), body, dryRun)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if op == nil {
+		c.JSON(http.StatusOK, gin.H{"data": report})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": report, "meta": operationMeta(op)})
+}
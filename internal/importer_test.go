@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTodoistImporter_JSON(t *testing.T) {
+	body := `{
+		"projects": [{"id": "p1", "name": "Home"}],
+		"items": [
+			{"id": "1", "project_id": "p1", "content": "Paint fence", "description": "white",
+			 "priority": 4, "labels": ["garden work"], "due": {"date": "2026-02-01", "string": "Feb 1"},
+			 "url": "https://todoist.com/showTask?id=1", "child_order": 1},
+			{"id": "2", "parent_id": "1", "project_id": "p1", "content": "Buy paint", "priority": 1, "checked": true},
+			{"id": 3, "content": "Pay rent", "due": {"date": "2026-03-01T09:00:00", "string": "every month", "is_recurring": true}}
+		]
+	}`
+
+	items, err := todoistImporter{}.Parse(strings.NewReader(body))
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+
+	fence := items[0]
+	assert.Equal(t, "Paint fence", fence.Title)
+	assert.Equal(t, 0, *fence.Priority)
+	assert.Equal(t, Tags{"garden-work"}, fence.Tags)
+	assert.Equal(t, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), *fence.DueDate)
+	assert.Equal(t, "white\n\nProject: Home\nUrl: https://todoist.com/showTask?id=1", fence.Description)
+	require.Len(t, fence.Subtasks, 1)
+	assert.Equal(t, "Buy paint", fence.Subtasks[0].Title)
+	assert.True(t, fence.Subtasks[0].Completed)
+	assert.Nil(t, fence.Subtasks[0].Priority)
+
+	assert.Equal(t, time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC), *items[1].DueDate)
+	assert.Equal(t, "Recurrence: every month", items[1].Description)
+}
+
+func TestTodoistImporter_CSV(t *testing.T) {
+	body := "\ufeffTYPE,CONTENT,DESCRIPTION,PRIORITY,INDENT,AUTHOR,RESPONSIBLE,DATE,DATE_LANG,TIMEZONE\n" +
+		"section,Errands,,,,,,,,\n" +
+		"task,Groceries @shopping,,1,1,Ann (1),,2026-02-01,en,UTC\n" +
+		"task,Milk,,4,2,Ann (1),,,en,UTC\n" +
+		"note,Get oat milk,,,,Ann (1),,,,\n" +
+		",,,,,,,,,\n" +
+		"task,Dentist,,2,1,Ann (1),,every monday,en,UTC\n"
+
+	items, err := todoistImporter{}.Parse(strings.NewReader(body))
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+
+	groceries := items[0]
+	assert.Equal(t, "Groceries", groceries.Title)
+	assert.Equal(t, Tags{"shopping"}, groceries.Tags)
+	assert.Equal(t, 0, *groceries.Priority)
+	assert.Equal(t, "Section: Errands\nAuthor: Ann (1)", groceries.Description)
+	require.Len(t, groceries.Subtasks, 1)
+	assert.Equal(t, "Milk", groceries.Subtasks[0].Title)
+	assert.Nil(t, groceries.Subtasks[0].Priority)
+	assert.Equal(t, "Section: Errands\nAuthor: Ann (1)\nComment: Get oat milk", groceries.Subtasks[0].Description)
+
+	assert.Equal(t, 1, *items[1].Priority)
+	assert.Nil(t, items[1].DueDate)
+	assert.Contains(t, items[1].Description, "Due: every monday")
+}
+
+func TestTrelloImporter(t *testing.T) {
+	body := `{
+		"name": "Launch",
+		"lists": [
+			{"id": "l2", "name": "Doing", "pos": 2},
+			{"id": "l1", "name": "To Do", "pos": 1},
+			{"id": "l3", "name": "Old", "pos": 3, "closed": true}
+		],
+		"cards": [
+			{"id": "c1", "idList": "l2", "name": "Write copy", "desc": "Landing page", "pos": 1,
+			 "due": "2026-02-01T12:00:00.000Z", "dueComplete": true, "shortUrl": "https://trello.com/c/abc",
+			 "labels": [{"name": "Needs Review", "color": "red"}, {"name": "", "color": "green"}]},
+			{"id": "c2", "idList": "l1", "name": "Pick domain", "pos": 1},
+			{"id": "c3", "idList": "l1", "name": "Archived", "pos": 2, "closed": true},
+			{"id": "c4", "idList": "l3", "name": "On archived list", "pos": 1}
+		],
+		"checklists": [
+			{"id": "k1", "idCard": "c1", "name": "Steps", "pos": 1, "checkItems": [
+				{"name": "Proofread", "state": "incomplete", "pos": 2},
+				{"name": "Draft", "state": "complete", "pos": 1}
+			]}
+		]
+	}`
+
+	items, err := trelloImporter{}.Parse(strings.NewReader(body))
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+
+	assert.Equal(t, "Pick domain", items[0].Title)
+	card := items[1]
+	assert.Equal(t, "Write copy", card.Title)
+	assert.True(t, card.Completed)
+	assert.Equal(t, Tags{"Needs-Review", "green"}, card.Tags)
+	assert.Equal(t, time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC), *card.DueDate)
+	assert.Equal(t, "Landing page\n\nBoard: Launch\nList: Doing\nTrello: https://trello.com/c/abc", card.Description)
+	require.Len(t, card.Subtasks, 2)
+	assert.Equal(t, "Draft", card.Subtasks[0].Title)
+	assert.True(t, card.Subtasks[0].Completed)
+	assert.Equal(t, "Proofread", card.Subtasks[1].Title)
+	assert.Equal(t, "Checklist: Steps", card.Subtasks[1].Description)
+}
+
+func TestJiraImporter(t *testing.T) {
+	body := "Summary,Issue key,Issue id,Parent id,Issue Type,Status,Priority,Labels,Labels,Due Date,Resolution,Assignee,Description\n" +
+		"Fix login,WEB-2,10002,10001,Sub-task,Done,High,auth,,01/Feb/26 12:00 AM,Fixed,Ann,Users get 500\n" +
+		"Auth revamp,WEB-1,10001,,Story,In Progress,Medium,auth,security,,Unresolved,,\n"
+
+	items, err := jiraImporter{}.Parse(strings.NewReader(body))
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+
+	story := items[0]
+	assert.Equal(t, "WEB-1 Auth revamp", story.Title)
+	assert.False(t, story.Completed)
+	assert.Equal(t, 2, *story.Priority)
+	assert.Equal(t, Tags{"auth", "security"}, story.Tags)
+	assert.Equal(t, "Issue Type: Story\nStatus: In Progress", story.Description)
+
+	require.Len(t, story.Subtasks, 1)
+	sub := story.Subtasks[0]
+	assert.Equal(t, "WEB-2 Fix login", sub.Title)
+	assert.True(t, sub.Completed)
+	assert.Equal(t, 1, *sub.Priority)
+	assert.Equal(t, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), *sub.DueDate)
+	assert.Equal(t, "Users get 500\n\nIssue Type: Sub-task\nStatus: Done\nAssignee: Ann", sub.Description)
+}
+
+func TestImporters_InvalidFile(t *testing.T) {
+	for source, body := range map[string]string{
+		SourceTodoist: "{not json",
+		SourceTrello:  "[]",
+		SourceJira:    "Key,Title\n",
+	} {
+		_, err := importers[source].Parse(strings.NewReader(body))
+		assert.ErrorIs(t, err, ErrInvalidImport, source)
+	}
+}
+
+func TestService_ImportFrom_UnknownSource(t *testing.T) {
+	service := &Service{repo: nil}
+
+	_, _, err := service.ImportFrom(context.Background(), "asana", strings.NewReader("{}"), true)
+
+	assert.ErrorIs(t, err, ErrUnknownSource)
+}
+
+func TestService_ImportFrom_InvalidRows(t *testing.T) {
+	service := &Service{repo: nil}
+	body := `[{"id": "1", "content": "ok"}, {"id": "2", "parent_id": "1", "content": " "}]`
+
+	_, _, err := service.ImportFrom(context.Background(), SourceTodoist, strings.NewReader(body), true)
+
+	var importErr *ImportError
+	require.True(t, errors.As(err, &importErr))
+	assert.Equal(t, []RowError{{Row: 2, Error: ErrTitleRequired.Error()}}, importErr.Rows)
+}
+
+func TestHandler_ImportFrom_InvalidDryRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handler := &Handler{service: &Service{repo: nil}}
+	handler.RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/todos/import/trello?dry_run=maybe", strings.NewReader("{}"))
+	rec := httptest.NewRecorder()
+
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// jiraImporter reads Jira's CSV issue export. Each issue becomes a todo
+// titled with its key and summary, so re-importing an export skips the
+// issues already imported. Sub-tasks are nested under their parent issue.
+type jiraImporter struct{}
+
+// jiraPriorities maps Jira's default priority scheme onto todox's.
+var jiraPriorities = map[string]int{
+	"blocker": 0, "highest": 0, "critical": 0,
+	"high": 1, "major": 1,
+	"medium": 2,
+	"low":    3, "minor": 3,
+	"lowest": 4, "trivial": 4,
+}
+
+// jiraDoneStatuses are the statuses treated as completed when the export has
+// no "Status Category" or "Resolution" column.
+var jiraDoneStatuses = map[string]bool{"done": true, "closed": true, "resolved": true}
+
+// jiraColumns are the columns mapped onto a todo or used to link sub-tasks.
+// Every other non-empty column is kept in the description.
+var jiraColumns = map[string]bool{
+	"Summary": true, "Issue key": true, "Issue id": true, "Parent id": true, "Parent": true,
+	"Description": true, "Priority": true, "Labels": true, "Due Date": true, "Due date": true,
+	"Status Category": true, "Resolution": true,
+}
+
+// jiraDateLayouts are the date formats Jira uses in CSV exports.
+var jiraDateLayouts = []string{"02/Jan/06 3:04 PM", "02/Jan/06", "2006-01-02 15:04"}
+
+func (jiraImporter) Parse(r io.Reader) ([]*ImportedTodo, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing CSV header", ErrInvalidImport)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(trimBOM(header[i]))
+	}
+	if !slices.Contains(header, "Summary") {
+		return nil, fmt.Errorf("%w: missing \"Summary\" column", ErrInvalidImport)
+	}
+
+	type issue struct {
+		item   *ImportedTodo
+		parent string
+	}
+	var (
+		issues []issue
+		byRef  = make(map[string]*ImportedTodo)
+	)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+		// Jira repeats columns such as Labels, Sprint and Comment once per
+		// value, so every lookup returns all of them.
+		values := func(name string) []string {
+			var vs []string
+			for i, h := range header {
+				if h == name && i < len(record) {
+					if v := strings.TrimSpace(record[i]); v != "" {
+						vs = append(vs, v)
+					}
+				}
+			}
+			return vs
+		}
+		first := func(names ...string) string {
+			for _, name := range names {
+				if vs := values(name); len(vs) > 0 {
+					return vs[0]
+				}
+			}
+			return ""
+		}
+
+		key := first("Issue key")
+		item := &ImportedTodo{}
+		item.Title = strings.TrimSpace(key + " " + first("Summary"))
+		if p, ok := jiraPriorities[strings.ToLower(first("Priority"))]; ok {
+			item.Priority = &p
+		}
+		for _, label := range values("Labels") {
+			if tag := importTag(label); tag != "" {
+				item.Tags = append(item.Tags, tag)
+			}
+		}
+
+		var notes importNotes
+		if due := first("Due Date", "Due date"); due != "" {
+			if t, ok := parseImportDate(due, jiraDateLayouts...); ok {
+				item.DueDate = t
+			} else {
+				notes.add("Due", due)
+			}
+		}
+		switch {
+		case slices.Contains(header, "Status Category"):
+			item.Completed = strings.EqualFold(first("Status Category"), "Done")
+		case slices.Contains(header, "Resolution"):
+			resolution := first("Resolution")
+			item.Completed = resolution != "" && !strings.EqualFold(resolution, "Unresolved")
+		default:
+			item.Completed = jiraDoneStatuses[strings.ToLower(first("Status"))]
+		}
+		for i, h := range header {
+			if !jiraColumns[h] && i < len(record) {
+				notes.add(h, record[i])
+			}
+		}
+		item.Description = notes.description(first("Description"))
+
+		issues = append(issues, issue{item: item, parent: first("Parent id", "Parent")})
+		for _, ref := range []string{key, first("Issue id")} {
+			if ref != "" {
+				byRef[ref] = item
+			}
+		}
+	}
+
+	var roots []*ImportedTodo
+	for _, is := range issues {
+		if parent, ok := byRef[is.parent]; ok && is.parent != "" && parent != is.item {
+			parent.Subtasks = append(parent.Subtasks, is.item)
+			continue
+		}
+		roots = append(roots, is.item)
+	}
+	return roots, nil
+}
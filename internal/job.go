@@ -0,0 +1,555 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/fx"
+)
+
+const (
+	JobKindImport = "import"
+
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// maxJobErrors caps how many row errors are kept on a job. The failed count
+// keeps counting past the cap.
+const maxJobErrors = 1000
+
+// maxJobErrorLength is the most characters of a failed job's error that are
+// kept, the size of the error column.
+const maxJobErrorLength = 1024
+
+// Job is a bulk import processed in the background by the JobRunner.
+type Job struct {
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty" db:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+	Errors      JobErrors  `json:"errors" db:"errors"`
+	Payload     []byte     `json:"-" db:"payload"`
+	ID          string     `json:"id" db:"id"`
+	Kind        string     `json:"kind" db:"kind"`
+	Status      string     `json:"status" db:"status"`
+	Actor       string     `json:"actor" db:"actor"`
+	RequestID   string     `json:"request_id" db:"request_id"`
+	OperationID string     `json:"operation_id" db:"operation_id"`
+	Error       string     `json:"error,omitempty" db:"error"`
+	Total       int        `json:"total" db:"total"`
+	Processed   int        `json:"processed" db:"processed"`
+	Created     int        `json:"created" db:"created_count"`
+	Failed      int        `json:"failed" db:"failed_count"`
+}
+
+type JobErrors []RowError
+
+func (e JobErrors) Value() (driver.Value, error) {
+	if e == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(e)
+}
+
+func (e *JobErrors) Scan(src any) error {
+	if src == nil {
+		*e = JobErrors{}
+		return nil
+	}
+	return scanJSON(src, e)
+}
+
+// addError records a row error, dropping it once maxJobErrors is reached.
+func (j *Job) addError(row int, err error) {
+	j.Failed++
+	if len(j.Errors) < maxJobErrors {
+		j.Errors = append(j.Errors, RowError{Row: row, Error: err.Error()})
+	}
+}
+
+const jobColumns = `id, kind, status, actor, request_id, operation_id, error, total, processed,
+	created_count, failed_count, errors, created_at, updated_at, started_at, finished_at`
+
+func (r *Repository) CreateJob(ctx context.Context, job *Job) error {
+	_, err := r.db.NamedExecContext(ctx,
+		`INSERT INTO jobs (id, kind, status, actor, request_id, operation_id, total, errors, payload, created_at, updated_at)
+		 VALUES (:id, :kind, :status, :actor, :request_id, :operation_id, :total, :errors, :payload, :created_at, :updated_at)`, job)
+	return err
+}
+
+func (r *Repository) GetJob(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	err := r.db.GetContext(ctx, &job, "SELECT "+jobColumns+" FROM jobs WHERE id = ?", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ClaimJob marks the oldest queued job as running and returns it with its
+// payload. It returns nil if no job is queued. Locked rows are skipped so
+// that several instances can share the queue.
+func (r *Repository) ClaimJob(ctx context.Context, now time.Time) (*Job, error) {
+	var job *Job
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		var j Job
+		err := tx.GetContext(ctx, &j,
+			"SELECT "+jobColumns+", payload FROM jobs WHERE status = ? ORDER BY created_at LIMIT 1 FOR UPDATE SKIP LOCKED",
+			JobQueued)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if j.StartedAt == nil {
+			j.StartedAt = &now
+		}
+		j.Status = JobRunning
+		_, err = tx.ExecContext(ctx, "UPDATE jobs SET status = ?, started_at = ? WHERE id = ?",
+			j.Status, j.StartedAt, j.ID)
+		if err != nil {
+			return err
+		}
+		job = &j
+		return nil
+	})
+	return job, err
+}
+
+func (r *Repository) GetJobStatus(ctx context.Context, id string) (string, error) {
+	var status string
+	err := r.db.GetContext(ctx, &status, "SELECT status FROM jobs WHERE id = ?", id)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return status, err
+}
+
+const updateJobProgressQuery = `UPDATE jobs SET processed = :processed, created_count = :created_count,
+	 failed_count = :failed_count, errors = :errors WHERE id = :id`
+
+func (r *Repository) UpdateJobProgress(ctx context.Context, job *Job) error {
+	_, err := r.db.NamedExecContext(ctx, updateJobProgressQuery, job)
+	return err
+}
+
+// ImportTodos creates todos as part of op and records job's progress in the
+// same transaction, so that a resumed job never imports them again.
+func (r *Repository) ImportTodos(ctx context.Context, op *Operation, job *Job, todos []*Todo) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if len(todos) > 0 {
+			if err := createTodos(ctx, tx, op, todos); err != nil {
+				return err
+			}
+		}
+		_, err := tx.NamedExecContext(ctx, updateJobProgressQuery, job)
+		return err
+	})
+}
+
+// FinishJob records the final status of a running job. A job cancelled
+// while it was running keeps its cancelled status.
+func (r *Repository) FinishJob(ctx context.Context, job *Job) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE jobs SET status = ?, error = ?, finished_at = ? WHERE id = ? AND status = ?",
+		job.Status, job.Error, job.FinishedAt, job.ID, JobRunning)
+	return err
+}
+
+// RequeueJob puts a running job back on the queue so that it resumes from
+// its last recorded progress.
+func (r *Repository) RequeueJob(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE jobs SET status = ? WHERE id = ? AND status = ?",
+		JobQueued, id, JobRunning)
+	return err
+}
+
+// RequeueStaleJobs requeues running jobs that have made no progress since
+// before, left behind by an instance that stopped without finishing them.
+func (r *Repository) RequeueStaleJobs(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE jobs SET status = ? WHERE status = ? AND updated_at < ?",
+		JobQueued, JobRunning, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *Repository) CancelJob(ctx context.Context, id string, now time.Time) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE jobs SET status = ?, finished_at = ? WHERE id = ? AND status IN (?, ?)",
+		JobCancelled, now, id, JobQueued, JobRunning)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		if _, err := r.GetJobStatus(ctx, id); err != nil {
+			return err
+		}
+		return ErrJobFinished
+	}
+	return nil
+}
+
+func (s *Service) SubmitImport(ctx context.Context, inputs []CreateTodoInput) (*Job, error) {
+	if len(inputs) == 0 {
+		return nil, ErrEmptyList
+	}
+	listIDs := make([]*int64, len(inputs))
+	for i, input := range inputs {
+		listIDs[i] = input.ListID
+	}
+	if err := s.authorizeNewTodos(ctx, listIDs); err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(inputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode import payload: %w", err)
+	}
+
+	now := time.Now()
+	job := &Job{
+		ID:          RandomID(),
+		Kind:        JobKindImport,
+		Status:      JobQueued,
+		Actor:       ActorFromContext(ctx),
+		RequestID:   RequestIDFromContext(ctx),
+		OperationID: RandomID(),
+		Total:       len(inputs),
+		Errors:      JobErrors{},
+		Payload:     payload,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.repo.CreateJob(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *Service) GetJob(ctx context.Context, id string) (*Job, error) {
+	return s.repo.GetJob(ctx, id)
+}
+
+func (s *Service) CancelJob(ctx context.Context, id string) (*Job, error) {
+	if err := s.repo.CancelJob(ctx, id, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.repo.GetJob(ctx, id)
+}
+
+// RunImportJob imports the job's rows in chunks of chunkSize, one
+// transaction per chunk, resuming after any rows already processed. All
+// chunks share the job's operation so the whole import can be undone at
+// once. It stops early if the job is cancelled or ctx is done.
+func (s *Service) RunImportJob(ctx context.Context, job *Job, chunkSize int) error {
+	ctx = WithRequestID(WithActor(ctx, job.Actor), job.RequestID)
+
+	var inputs []CreateTodoInput
+	if err := json.Unmarshal(job.Payload, &inputs); err != nil {
+		return fmt.Errorf("failed to decode import payload: %w", err)
+	}
+
+	op := s.newOperation(ctx, OperationImport)
+	op.ID = job.OperationID
+
+	for job.Processed < len(inputs) {
+		status, err := s.repo.GetJobStatus(ctx, job.ID)
+		if err != nil {
+			return err
+		}
+		if status != JobRunning {
+			return nil
+		}
+
+		end := min(job.Processed+chunkSize, len(inputs))
+		if err := s.importChunk(ctx, op, job, inputs[job.Processed:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importChunk creates the valid rows of one chunk and records the job's
+// progress past it in a single transaction. If the chunk collides with
+// existing titles it falls back to one transaction per row so that only the
+// offending rows are reported.
+func (s *Service) importChunk(ctx context.Context, op *Operation, job *Job, inputs []CreateTodoInput) error {
+	start, now := job.Processed, time.Now()
+
+	next := *job
+	next.Errors = slices.Clone(job.Errors)
+	todos := make([]*Todo, 0, len(inputs))
+	for i, input := range inputs {
+		if err := input.Validate(); err != nil {
+			next.addError(start+i+1, err)
+			continue
+		}
+		todos = append(todos, newTodo(input, now))
+	}
+	next.Processed = start + len(inputs)
+	next.Created += len(todos)
+
+	err := s.repo.ImportTodos(ctx, op, &next, todos)
+	if err == nil {
+		*job = next
+		return nil
+	}
+	if !errors.Is(err, ErrDuplicateTitle) {
+		return err
+	}
+
+	// Each row's transaction records the progress up to that row.
+	for i, input := range inputs {
+		job.Processed = start + i + 1
+		if err := input.Validate(); err != nil {
+			job.addError(job.Processed, err)
+			continue
+		}
+		next := *job
+		next.Created++
+		err := s.repo.ImportTodos(ctx, op, &next, []*Todo{newTodo(input, now)})
+		if errors.Is(err, ErrDuplicateTitle) {
+			job.addError(job.Processed, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		*job = next
+	}
+	return s.repo.UpdateJobProgress(ctx, job)
+}
+
+// JobRunner processes queued jobs on a fixed pool of workers for the
+// lifetime of the application.
+type JobRunner struct {
+	service      *Service
+	notify       chan struct{}
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+	workers      int
+	chunkSize    int
+	pollInterval time.Duration
+	staleAfter   time.Duration
+}
+
+func NewJobRunner(lc fx.Lifecycle, service *Service) *JobRunner {
+	runner := &JobRunner{
+		service:      service,
+		notify:       make(chan struct{}, 1),
+		workers:      GetEnvInt("JOB_WORKERS", 2),
+		chunkSize:    GetEnvInt("JOB_CHUNK_SIZE", 500),
+		pollInterval: GetEnvDuration("JOB_POLL_INTERVAL", 2*time.Second),
+		staleAfter:   GetEnvDuration("JOB_STALE_AFTER", 5*time.Minute),
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			requeued, err := service.repo.RequeueStaleJobs(ctx, time.Now().Add(-runner.staleAfter))
+			if err != nil {
+				return fmt.Errorf("failed to requeue stale jobs: %w", err)
+			}
+
+			slog.Info("Starting job workers",
+				"workers", runner.workers,
+				"chunk_size", runner.chunkSize,
+				"requeued_jobs", requeued,
+			)
+
+			runCtx, cancel := context.WithCancel(context.Background())
+			runner.cancel = cancel
+			for range runner.workers {
+				runner.wg.Add(1)
+				go runner.work(runCtx)
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			slog.Info("Stopping job workers...")
+			runner.cancel()
+
+			done := make(chan struct{})
+			go func() {
+				runner.wg.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+
+	return runner
+}
+
+// Notify wakes an idle worker to look for newly queued jobs.
+func (jr *JobRunner) Notify() {
+	select {
+	case jr.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (jr *JobRunner) work(ctx context.Context) {
+	defer jr.wg.Done()
+
+	ticker := time.NewTicker(jr.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := jr.service.repo.ClaimJob(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Failed to claim job", "error", err)
+		}
+		if job != nil {
+			jr.run(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-jr.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (jr *JobRunner) run(ctx context.Context, job *Job) {
+	slog.Info("Running job", "job_id", job.ID, "kind", job.Kind, "total", job.Total, "processed", job.Processed)
+
+	err := jr.service.RunImportJob(ctx, job, jr.chunkSize)
+
+	// Use a fresh context so the job's state is saved even during shutdown.
+	saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if ctx.Err() != nil {
+		if rerr := jr.service.repo.RequeueJob(saveCtx, job.ID); rerr != nil {
+			slog.Error("Failed to requeue job", "job_id", job.ID, "error", rerr)
+		}
+		return
+	}
+
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Status = JobSucceeded
+	if err != nil {
+		slog.Error("Job failed", "job_id", job.ID, "error", err)
+		job.Status = JobFailed
+		job.Error = truncate(err.Error(), maxJobErrorLength)
+	}
+	if ferr := jr.service.repo.FinishJob(saveCtx, job); ferr != nil {
+		slog.Error("Failed to finish job", "job_id", job.ID, "error", ferr)
+		return
+	}
+	slog.Info("Job finished", "job_id", job.ID, "status", job.Status, "created", job.Created, "failed", job.Failed)
+}
+
+// truncate cuts s to at most n characters.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// decodeImportPayload reads todos to import from either a JSON array or an
+// object with a "todos" array.
+func decodeImportPayload(r io.Reader) ([]CreateTodoInput, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs []CreateTodoInput
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(data, &inputs)
+	} else {
+		var body struct {
+			Todos []CreateTodoInput `json:"todos"`
+		}
+		err = json.Unmarshal(data, &body)
+		inputs = body.Todos
+	}
+	return inputs, err
+}
+
+func (h *Handler) SubmitImportJob(c *gin.Context) {
+	body, ok := requestFile(c)
+	if !ok {
+		return
+	}
+	defer body.Close()
+
+	inputs, err := decodeImportPayload(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	job, err := h.service.SubmitImport(c.Request.Context(), inputs)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	if h.jobs != nil {
+		h.jobs.Notify()
+	}
+
+	c.Header("Location", "/v1/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, gin.H{"data": job})
+}
+
+func (h *Handler) GetJob(c *gin.Context) {
+	job, err := h.service.GetJob(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": job})
+}
+
+func (h *Handler) CancelJob(c *gin.Context) {
+	job, err := h.service.CancelJob(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": job})
+}
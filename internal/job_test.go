@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeImportPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "array",
+			body: `[{"title": "a"}, {"title": "b"}]`,
+			want: []string{"a", "b"},
+		},
+		{
+			name: "object",
+			body: ` {"todos": [{"title": "a"}]}`,
+			want: []string{"a"},
+		},
+		{
+			name:    "invalid json",
+			body:    `{invalid}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs, err := decodeImportPayload(strings.NewReader(tt.body))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			titles := make([]string, 0, len(inputs))
+			for _, input := range inputs {
+				titles = append(titles, input.Title)
+			}
+			assert.Equal(t, tt.want, titles)
+		})
+	}
+}
+
+func TestJob_AddErrorCapsStoredErrors(t *testing.T) {
+	job := &Job{}
+
+	for i := range maxJobErrors + 5 {
+		job.addError(i+1, errors.New("bad row"))
+	}
+
+	assert.Equal(t, maxJobErrors+5, job.Failed)
+	assert.Len(t, job.Errors, maxJobErrors)
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", truncate("short", maxJobErrorLength))
+	assert.Equal(t, "ää", truncate("äää", 2))
+	assert.Len(t, []rune(truncate(strings.Repeat("é", 2000), maxJobErrorLength)), maxJobErrorLength)
+}
+
+func TestHandler_SubmitImportJob(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "invalid json",
+			body:           "{invalid}",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "empty array",
+			body:           `{"todos": []}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			handler := &Handler{service: &Service{repo: nil}}
+			handler.RegisterRoutes(r)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/jobs/import", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,426 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// List groups todos that share a workflow.
+type List struct {
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	Workflow  Workflow  `json:"workflow" db:"workflow"`
+	Name      string    `json:"name" db:"name"`
+	Tenant    string    `json:"tenant" db:"tenant"`
+	ID        int64     `json:"id" db:"id"`
+}
+
+// ListInput creates a list, or updates the fields it sets. A list created
+// without a workflow follows the default open/done one.
+type ListInput struct {
+	Name     *string   `json:"name"`
+	Workflow *Workflow `json:"workflow"`
+}
+
+func (in *ListInput) Validate() error {
+	if in.Name != nil {
+		name := strings.TrimSpace(*in.Name)
+		if name == "" || len(name) > 255 {
+			return ErrInvalidListName
+		}
+		in.Name = &name
+	}
+	if in.Workflow != nil {
+		return in.Workflow.Validate()
+	}
+	return nil
+}
+
+// Board is the todos of a list grouped by state, one column per state in
+// workflow order.
+type Board struct {
+	List    *List         `json:"list"`
+	Columns []BoardColumn `json:"columns"`
+}
+
+// BoardColumn holds the first todos in a state and how many match in all.
+type BoardColumn struct {
+	WIPLimit *int   `json:"wip_limit,omitempty"`
+	Status   string `json:"status"`
+	Todos    []Todo `json:"todos"`
+	Total    int64  `json:"total"`
+	Done     bool   `json:"done"`
+}
+
+// CreateList inserts list and, if owner is set, makes that user its owner.
+func (r *Repository) CreateList(ctx context.Context, list *List, owner *int64) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		result, err := tx.NamedExecContext(ctx,
+			`INSERT INTO lists (name, workflow, tenant, created_at, updated_at)
+			VALUES (:name, :workflow, :tenant, :created_at, :updated_at)`, list)
+		if err != nil {
+			if isDuplicateError(err) {
+				return ErrDuplicateList
+			}
+			return err
+		}
+		if list.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		if owner == nil {
+			return nil
+		}
+		return insertMember(ctx, tx, list.ID, *owner, RoleOwner, list.CreatedAt)
+	})
+}
+
+// ListLists returns the lists by name: those a user is a member of, or all
+// of them if member is nil.
+func (r *Repository) ListLists(ctx context.Context, member *int64) ([]List, error) {
+	lists := []List{}
+	if member != nil {
+		err := r.db.SelectContext(ctx, &lists,
+			"SELECT l.* FROM lists l JOIN list_members m ON m.list_id = l.id WHERE m.user_id = ? ORDER BY l.name", *member)
+		return lists, err
+	}
+	err := r.db.SelectContext(ctx, &lists, "SELECT * FROM lists ORDER BY name")
+	return lists, err
+}
+
+func (r *Repository) GetList(ctx context.Context, id int64) (*List, error) {
+	var list List
+	err := r.db.GetContext(ctx, &list, "SELECT * FROM lists WHERE id = ?", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &list, err
+}
+
+// lockList reads and locks a list inside tx. Writes to the list's todos lock
+// it too, so its todos keep their states until tx ends.
+func lockList(ctx context.Context, tx *sqlx.Tx, id int64) error {
+	var found int64
+	err := tx.GetContext(ctx, &found, "SELECT id FROM lists WHERE id = ? FOR UPDATE", id)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// UpdateList writes list's name and workflow. It fails with ErrStateInUse if
+// the workflow drops a state some of the list's todos are in, or changes
+// whether it is done, which would leave their completion stale. Lowering a
+// WIP limit below a state's count only stops further todos from entering it.
+func (r *Repository) UpdateList(ctx context.Context, list *List) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := lockList(ctx, tx, list.ID); err != nil {
+			return err
+		}
+		var current Workflow
+		if err := tx.GetContext(ctx, &current, "SELECT workflow FROM lists WHERE id = ?", list.ID); err != nil {
+			return err
+		}
+		var statuses []string
+		if err := tx.SelectContext(ctx, &statuses, "SELECT DISTINCT status FROM todos WHERE list_id = ?", list.ID); err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := list.Workflow.state(status)
+			if state == nil {
+				return fmt.Errorf("%w: %q", ErrStateInUse, status)
+			}
+			if old := current.state(status); old != nil && old.Done != state.Done {
+				return fmt.Errorf("%w: %q changes done", ErrStateInUse, status)
+			}
+		}
+
+		_, err := tx.NamedExecContext(ctx,
+			"UPDATE lists SET name = :name, workflow = :workflow, updated_at = :updated_at WHERE id = :id", list)
+		if err != nil && isDuplicateError(err) {
+			return ErrDuplicateList
+		}
+		return err
+	})
+}
+
+// DeleteList removes a list that has no todos left.
+func (r *Repository) DeleteList(ctx context.Context, id int64) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := lockList(ctx, tx, id); err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.GetContext(ctx, &count, "SELECT COUNT(*) FROM todos WHERE list_id = ?", id); err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrListNotEmpty
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM list_members WHERE list_id = ?", id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM lists WHERE id = ?", id)
+		return err
+	})
+}
+
+// Board returns the columns of list's board: up to limit of the todos in
+// each state that also match filter, in manual order, and their counts.
+func (r *Repository) Board(ctx context.Context, list *List, filter TodoFilter, limit int) ([]BoardColumn, error) {
+	filter.ListID = &list.ID
+	where, args := filter.where()
+
+	var counts []struct {
+		Status string `db:"status"`
+		Total  int64  `db:"total"`
+	}
+	if err := r.db.SelectContext(ctx, &counts, "SELECT status, COUNT(*) AS total FROM todos"+where+" GROUP BY status", args...); err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Todo
+		N int64 `db:"n"`
+	}
+	err := r.db.SelectContext(ctx, &rows, `SELECT * FROM (
+			SELECT todos.*, ROW_NUMBER() OVER (PARTITION BY status ORDER BY position, id) AS n
+			FROM todos`+where+`
+		) ranked WHERE n <= ? ORDER BY n`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]BoardColumn, len(list.Workflow.States))
+	index := make(map[string]int, len(columns))
+	for i, state := range list.Workflow.States {
+		columns[i] = BoardColumn{Status: state.Name, WIPLimit: state.WIPLimit, Done: state.Done, Todos: []Todo{}}
+		index[state.Name] = i
+	}
+	for _, count := range counts {
+		if i, ok := index[count.Status]; ok {
+			columns[i].Total = count.Total
+		}
+	}
+	for _, row := range rows {
+		if i, ok := index[row.Status]; ok {
+			columns[i].Todos = append(columns[i].Todos, row.Todo)
+		}
+	}
+	return columns, nil
+}
+
+func (s *Service) CreateList(ctx context.Context, input ListInput) (*List, error) {
+	if input.Name == nil {
+		return nil, ErrInvalidListName
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	list := &List{
+		Name:      *input.Name,
+		Workflow:  *DefaultWorkflow(),
+		Tenant:    tenantFromContext(ctx),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if input.Workflow != nil {
+		list.Workflow = *input.Workflow
+	}
+	var owner *int64
+	if user := UserFromContext(ctx); user != nil {
+		owner = &user.ID
+	}
+	if err := s.repo.CreateList(ctx, list, owner); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ListLists returns the lists the caller can see.
+func (s *Service) ListLists(ctx context.Context) ([]List, error) {
+	var member *int64
+	if user := UserFromContext(ctx); user != nil {
+		member = &user.ID
+	}
+	return s.repo.ListLists(ctx, member)
+}
+
+func (s *Service) GetList(ctx context.Context, id int64) (*List, error) {
+	if id <= 0 {
+		return nil, ErrInvalidID
+	}
+	if err := s.authorizeList(ctx, id, RoleViewer); err != nil {
+		return nil, err
+	}
+	return s.repo.GetList(ctx, id)
+}
+
+// UpdateList renames a list or replaces its workflow. Todos keep their
+// states, so the new workflow must still have every state in use, each as
+// done or not as before.
+func (s *Service) UpdateList(ctx context.Context, id int64, input ListInput) (*List, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if id > 0 {
+		if err := s.authorizeList(ctx, id, RoleOwner); err != nil {
+			return nil, err
+		}
+	}
+	list, err := s.GetList(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Name != nil {
+		list.Name = *input.Name
+	}
+	if input.Workflow != nil {
+		list.Workflow = *input.Workflow
+	}
+	list.UpdatedAt = time.Now()
+	if err := s.repo.UpdateList(ctx, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *Service) DeleteList(ctx context.Context, id int64) error {
+	if id <= 0 {
+		return ErrInvalidID
+	}
+	if err := s.authorizeList(ctx, id, RoleOwner); err != nil {
+		return err
+	}
+	return s.repo.DeleteList(ctx, id)
+}
+
+// Board returns a list's board, with up to limit todos per column.
+func (s *Service) Board(ctx context.Context, id int64, filter TodoFilter, limit int) (*Board, error) {
+	_, limit, err := normalizePage(1, limit)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.GetList(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := s.repo.Board(ctx, list, filter, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &Board{List: list, Columns: columns}, nil
+}
+
+func (h *Handler) CreateList(c *gin.Context) {
+	var input ListInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	list, err := h.service.CreateList(c.Request.Context(), input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": list})
+}
+
+func (h *Handler) ListLists(c *gin.Context) {
+	lists, err := h.service.ListLists(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": lists})
+}
+
+func (h *Handler) GetList(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+
+	list, err := h.service.GetList(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+func (h *Handler) UpdateList(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	var input ListInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	list, err := h.service.UpdateList(c.Request.Context(), id, input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+func (h *Handler) DeleteList(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+
+	if err := h.service.DeleteList(c.Request.Context(), id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetBoard serves GET /v1/lists/:id/board. limit caps the todos returned per
+// column, and the list filters of ListTodos narrow them.
+func (h *Handler) GetBoard(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	_, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	filter, ok := parseListFilter(c)
+	if !ok {
+		return
+	}
+
+	board, err := h.service.Board(c.Request.Context(), id, filter, limit)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": board})
+}
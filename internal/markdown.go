@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatMarkdown is a Markdown task list: one "- [ ]" or "- [x]" item per
+// todo, with #tags, due:YYYY-MM-DD and !P<n> priority markers after the
+// title and the description on indented lines below it.
+const FormatMarkdown = "markdown"
+
+// markdownItem matches a task list item, capturing its indentation, check
+// mark and text.
+var markdownItem = regexp.MustCompile(`^(\s*)[-*+] \[([ xX])\](?:\s+(.*))?$`)
+
+type markdownEncoder struct {
+	w io.Writer
+}
+
+func (e *markdownEncoder) Encode(todo *Todo) error {
+	var b strings.Builder
+	if todo.Completed {
+		b.WriteString("- [x] ")
+	} else {
+		b.WriteString("- [ ] ")
+	}
+	b.WriteString(strings.Join(strings.Fields(todo.Title), " "))
+	for _, tag := range todo.Tags {
+		b.WriteString(" #" + tag)
+	}
+	if todo.DueDate != nil {
+		b.WriteString(" due:" + todo.DueDate.UTC().Format(time.DateOnly))
+	}
+	if todo.Priority != nil {
+		b.WriteString(" !P" + strconv.Itoa(*todo.Priority))
+	}
+	b.WriteString("\n")
+	for _, line := range strings.Split(todo.Description, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *markdownEncoder) Close() error {
+	return nil
+}
+
+// parseMarkdown reads every task list item in a Markdown document. Indented
+// lines below an item that are not items themselves form its description;
+// all other lines, such as headings and plain bullets, are ignored.
+func parseMarkdown(r io.Reader) ([]ChecklistTodo, []RowError, error) {
+	var (
+		items       []ChecklistTodo
+		rows        []RowError
+		description []string
+	)
+	flush := func() {
+		if len(items) > 0 && len(description) > 0 {
+			items[len(items)-1].Description = strings.Join(description, "\n")
+		}
+		description = nil
+	}
+
+	inItem := false
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := markdownItem.FindStringSubmatch(line); m != nil {
+			flush()
+			item, err := parseMarkdownItem(m[2], m[3])
+			if err != nil {
+				rows = append(rows, RowError{Row: len(items) + 1, Error: err.Error()})
+			}
+			items = append(items, item)
+			inItem = true
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if inItem && (line[0] == ' ' || line[0] == '\t') {
+			description = append(description, strings.TrimSpace(line))
+			continue
+		}
+		flush()
+		inItem = false
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	flush()
+	return items, rows, nil
+}
+
+func parseMarkdownItem(mark, text string) (ChecklistTodo, error) {
+	item := ChecklistTodo{Completed: mark != " "}
+
+	var title []string
+	for _, word := range strings.Fields(text) {
+		switch {
+		case len(word) > 1 && word[0] == '#':
+			item.Tags = append(item.Tags, word[1:])
+		case strings.HasPrefix(word, "due:"):
+			due, err := parseDate(strings.TrimPrefix(word, "due:"))
+			if err != nil {
+				return item, errors.New("invalid due date")
+			}
+			item.DueDate = due
+		case len(word) > 2 && strings.HasPrefix(word, "!P"):
+			p, err := strconv.Atoi(word[2:])
+			if err != nil {
+				return item, ErrInvalidPriority
+			}
+			item.Priority = &p
+		default:
+			title = append(title, word)
+		}
+	}
+	item.Title = strings.Join(title, " ")
+	return item, nil
+}
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkdown_RoundTrip(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	due := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	p := 1
+	todos := []*Todo{
+		{Title: "Write report", Description: "intro\nfindings", Tags: Tags{"work"}, DueDate: &due, Priority: &p, CreatedAt: created, UpdatedAt: created},
+		{Title: "Buy milk", Completed: true, CreatedAt: created, UpdatedAt: created},
+	}
+
+	var buf bytes.Buffer
+	enc, err := NewTodoEncoder(&buf, FormatMarkdown)
+	require.NoError(t, err)
+	for _, todo := range todos {
+		require.NoError(t, enc.Encode(todo))
+	}
+	require.NoError(t, enc.Close())
+
+	want := "- [ ] Write report #work due:2026-02-01 !P1\n" +
+		"  intro\n" +
+		"  findings\n" +
+		"- [x] Buy milk\n"
+	require.Equal(t, want, buf.String())
+
+	items, err := ParseChecklist(&buf, FormatMarkdown)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	for i, item := range items {
+		assert.Equal(t, todos[i].Title, item.Title)
+		assert.Equal(t, todos[i].Description, item.Description)
+		assert.Equal(t, todos[i].Tags, item.Tags)
+		assert.Equal(t, todos[i].DueDate, item.DueDate)
+		assert.Equal(t, todos[i].Priority, item.Priority)
+		assert.Equal(t, todos[i].Completed, item.Completed)
+	}
+}
+
+func TestParseChecklist_MarkdownDocument(t *testing.T) {
+	body := "# Sprint\n\nSome notes.\n\n" +
+		"* [X] Ship release\n" +
+		"- plain bullet\n" +
+		"- [ ] Review PR #backend\n" +
+		"    - [ ] Nested item\n" +
+		"      with details\n"
+
+	items, err := ParseChecklist(strings.NewReader(body), FormatMarkdown)
+	require.NoError(t, err)
+
+	require.Len(t, items, 3)
+	assert.True(t, items[0].Completed)
+	assert.Equal(t, "Ship release", items[0].Title)
+	assert.Equal(t, "Review PR", items[1].Title)
+	assert.Equal(t, Tags{"backend"}, items[1].Tags)
+	assert.Empty(t, items[1].Description)
+	assert.Equal(t, "Nested item", items[2].Title)
+	assert.Equal(t, "with details", items[2].Description)
+}
+
+func TestParseChecklist_MarkdownInvalidRows(t *testing.T) {
+	body := "- [ ] ok\n- [ ]\n- [ ] late due:someday\n- [ ] loud !P99\n"
+
+	_, err := ParseChecklist(strings.NewReader(body), FormatMarkdown)
+
+	var importErr *ImportError
+	require.True(t, errors.As(err, &importErr))
+	assert.Equal(t, []RowError{
+		{Row: 2, Error: ErrTitleRequired.Error()},
+		{Row: 3, Error: "invalid due date"},
+		{Row: 4, Error: ErrInvalidPriority.Error()},
+	}, importErr.Rows)
+}
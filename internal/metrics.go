@@ -26,6 +26,14 @@ var (
 		},
 		[]string{"method", "path"},
 	)
+
+	txRetriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tx_retries_total",
+			Help: "Total number of database transactions retried after a deadlock or lock wait timeout, by transaction and MySQL error number",
+		},
+		[]string{"tx", "error"},
+	)
 )
 
 func MetricsMiddleware() gin.HandlerFunc {
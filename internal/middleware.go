@@ -1,18 +1,67 @@
 package internal
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	actorKey
+	userKey
+	shareKey
+)
+
+const (
+	ActorAPIKey    = "api-key"
+	ActorAnonymous = "anonymous"
+	ActorSystem    = "system"
+)
+
+// WithRequestID returns a copy of ctx carrying the given request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, or an empty
+// string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithActor returns a copy of ctx carrying the name of the caller performing
+// the request.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// ActorFromContext returns the actor stored in ctx. Work done outside an
+// HTTP request is attributed to the system actor.
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey).(string); ok && actor != "" {
+		return actor
+	}
+	return ActorSystem
+}
+
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-API-Key")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-API-Key, X-Request-ID, Depth, If-Match, If-None-Match")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE, PROPFIND, REPORT")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, ETag, DAV")
 
-		if c.Request.Method == "OPTIONS" {
+		// CalDAV clients use OPTIONS to discover capabilities, so it is
+		// answered by the CalDAV handlers rather than as a CORS preflight.
+		if c.Request.Method == "OPTIONS" && !strings.HasPrefix(c.Request.URL.Path, "/dav/") {
 			c.AbortWithStatus(204)
 			return
 		}
@@ -21,25 +70,123 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
-func AuthMiddleware() gin.HandlerFunc {
+// RequestIDMiddleware propagates the caller's X-Request-ID header, or
+// generates a new ID, and stores it on the request context.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if id == "" || len(id) > 64 {
+			id = RandomID()
+		}
+
+		c.Writer.Header().Set("X-Request-ID", id)
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+
+		c.Next()
+	}
+}
+
+// requestAPIKey returns the API key sent in the X-API-Key header, or as the
+// password of HTTP Basic credentials for clients such as CalDAV apps that
+// cannot send custom headers.
+func requestAPIKey(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if _, password, ok := c.Request.BasicAuth(); ok {
+		return password
+	}
+	return ""
+}
+
+// AuthMiddleware admits callers with the instance API key, and users with
+// their own key, whom it stores on the request context. Without API_KEY,
+// requests that send no key are admitted as anonymous until the first user
+// is created; a user key is still checked whenever one is sent.
+func AuthMiddleware(service *Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		apiKey := GetEnv("API_KEY", "")
 
-		if apiKey == "" {
+		if c.Request.URL.Path == "/health" || c.Request.URL.Path == "/metrics" {
 			c.Next()
 			return
 		}
 
-		if c.Request.URL.Path == "/health" || c.Request.URL.Path == "/metrics" {
+		// The calendar feed authenticates its own token, since calendar
+		// apps cannot send an API key header.
+		if c.Request.URL.Path == "/v1/todos.ics" && c.Query("token") != "" {
+			c.Next()
+			return
+		}
+
+		// Share links are authenticated by ShareMiddleware.
+		if strings.HasPrefix(c.Request.URL.Path, "/v1/shared/") {
+			c.Next()
+			return
+		}
+
+		// Attachment downloads are authenticated by their signed link. Only
+		// the download route itself is exempt.
+		if c.Request.Method == http.MethodGet && c.FullPath() == "/v1/attachments/:id/download" && c.Query("signature") != "" {
 			c.Next()
 			return
 		}
 
-		if c.GetHeader("X-API-Key") != apiKey {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		key := requestAPIKey(c)
+		if key == "" && apiKey == "" {
+			allowed, err := service.AllowsAnonymous(c.Request.Context())
+			if err != nil {
+				handleError(c, err)
+				c.Abort()
+				return
+			}
+			if allowed {
+				c.Request = c.Request.WithContext(WithActor(c.Request.Context(), ActorAnonymous))
+				c.Next()
+				return
+			}
+		}
+		if key != "" && key == apiKey {
+			c.Request = c.Request.WithContext(WithActor(c.Request.Context(), ActorAPIKey))
+			c.Next()
+			return
+		}
+
+		if key != "" {
+			user, err := service.Authenticate(c.Request.Context(), key)
+			if err == nil {
+				ctx := WithUser(c.Request.Context(), user)
+				c.Request = c.Request.WithContext(WithActor(ctx, user.Name))
+				c.Next()
+				return
+			}
+			if !errors.Is(err, ErrUnauthorized) {
+				slog.Error("Failed to authenticate user", "error", err)
+			}
+		}
+
+		// CalDAV clients only send credentials after a Basic challenge.
+		if strings.HasPrefix(c.Request.URL.Path, "/dav/") {
+			c.Header("WWW-Authenticate", `Basic realm="todox"`)
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: ErrUnauthorized.Error()})
+	}
+}
+
+// ShareMiddleware admits requests through a valid share link, whose token is
+// the token path parameter, and stores the share on the request context.
+// Changes made through it are attributed to the share.
+func ShareMiddleware(service *Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		share, err := service.ResolveShare(c.Request.Context(), c.Param("token"))
+		if err != nil {
+			handleError(c, err)
+			c.Abort()
 			return
 		}
 
+		ctx := WithShare(c.Request.Context(), share)
+		c.Request = c.Request.WithContext(WithActor(ctx, share.actor()))
 		c.Next()
 	}
 }
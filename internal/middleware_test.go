@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthMiddleware_BasicAuth(t *testing.T) {
+	t.Setenv("API_KEY", "secret")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AuthMiddleware(&Service{repo: nil}))
+	r.GET("/dav/", func(c *gin.Context) {
+		c.String(http.StatusOK, ActorFromContext(c.Request.Context()))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/dav/", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Basic realm="todox"`, rec.Header().Get("WWW-Authenticate"))
+
+	req = httptest.NewRequest(http.MethodGet, "/dav/", nil)
+	req.SetBasicAuth("alice", "secret")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, ActorAPIKey, rec.Body.String())
+}
+
+func TestAuthMiddleware_WithoutAPIKey(t *testing.T) {
+	t.Setenv("API_KEY", "")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	service := &Service{repo: nil}
+	service.usersExist.Store(true)
+	r.Use(AuthMiddleware(service))
+	r.GET("/v1/me", func(c *gin.Context) {
+		c.String(http.StatusOK, ActorFromContext(c.Request.Context()))
+	})
+	r.Handle("PROPFIND", "/dav/todos/", func(c *gin.Context) {
+		c.Status(http.StatusMultiStatus)
+	})
+
+	// Once a user exists, requests without a key are no longer anonymous.
+	req := httptest.NewRequest(http.MethodGet, "/v1/me", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req = httptest.NewRequest("PROPFIND", "/dav/todos/", nil)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Basic realm="todox"`, rec.Header().Get("WWW-Authenticate"))
+}
+
+func TestAuthMiddleware_AttachmentDownload(t *testing.T) {
+	t.Setenv("API_KEY", "secret")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AuthMiddleware(&Service{repo: nil}))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/v1/attachments/:id/download", ok)
+	r.GET("/v1/attachments/:id", ok)
+	r.DELETE("/v1/attachments/:id/download", ok)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{name: "signed download", method: http.MethodGet, target: "/v1/attachments/7/download?signature=x", want: http.StatusOK},
+		{name: "unsigned download", method: http.MethodGet, target: "/v1/attachments/7/download", want: http.StatusUnauthorized},
+		{name: "other route", method: http.MethodGet, target: "/v1/attachments/7?signature=x", want: http.StatusUnauthorized},
+		{name: "other method", method: http.MethodDelete, target: "/v1/attachments/7/download?signature=x", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
@@ -1,24 +1,119 @@
 package internal
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"strings"
 	"time"
+	"unicode"
 )
 
+// MaxPriority is the lowest priority a todo can have. Priority 0 is the
+// highest, matching todo.txt's (A).
+const MaxPriority = 25
+
+// Todo is a task. Status is a state of the workflow of the todo's list, and
+// Completed, kept for v1 clients, is whether that state is a done one.
+// A todo is actionable once its StartDate, if any, has come and it is not
+// snoozed. LoggedMinutes totals the todo's finished time entries and only
+// changes as they are logged or removed.
 type Todo struct {
-	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
-	DueDate     *time.Time `json:"due_date,omitempty" db:"due_date"`
-	Title       string     `json:"title" db:"title"`
-	Description string     `json:"description,omitempty" db:"description"`
-	ID          int64      `json:"id" db:"id"`
-	Completed   bool       `json:"completed" db:"completed"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+	DueDate         *time.Time `json:"due_date,omitempty" db:"due_date"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	StartDate       *time.Time `json:"start_date,omitempty" db:"start_date"`
+	SnoozedUntil    *time.Time `json:"snoozed_until,omitempty" db:"snoozed_until"`
+	CompletedBy     *string    `json:"completed_by,omitempty" db:"completed_by"`
+	Priority        *int       `json:"priority,omitempty" db:"priority"`
+	EstimateMinutes *int       `json:"estimate_minutes,omitempty" db:"estimate_minutes"`
+	ParentID        *int64     `json:"parent_id,omitempty" db:"parent_id"`
+	ListID          *int64     `json:"list_id,omitempty" db:"list_id"`
+	ExternalID      *string    `json:"external_id,omitempty" db:"external_id"`
+	Source          *string    `json:"source,omitempty" db:"source"`
+	Tags            Tags       `json:"tags,omitempty" db:"tags"`
+	UID             string     `json:"uid" db:"uid"`
+	Title           string     `json:"title" db:"title"`
+	Description     string     `json:"description,omitempty" db:"description"`
+	Status          string     `json:"status" db:"status"`
+	Position        string     `json:"position" db:"position"`
+	ID              int64      `json:"id" db:"id"`
+	LoggedMinutes   int64      `json:"logged_minutes" db:"logged_minutes"`
+	Completed       bool       `json:"completed" db:"completed"`
+}
+
+// Tags is a todo's set of tags, stored as a JSON array.
+type Tags []string
+
+func (t Tags) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(t)
+}
+
+func (t *Tags) Scan(src any) error {
+	if src == nil {
+		*t = nil
+		return nil
+	}
+	return scanJSON(src, t)
+}
+
+// normalizeTags trims tags and drops empty and repeated ones. It returns
+// ErrInvalidTag if a tag is too long or contains whitespace or commas.
+func normalizeTags(tags Tags) (Tags, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	seen := make(map[string]bool, len(tags))
+	out := make(Tags, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > 64 || strings.ContainsFunc(tag, func(r rune) bool { return unicode.IsSpace(r) || r == ',' }) {
+			return nil, ErrInvalidTag
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	return out, nil
 }
 
+func validatePriority(p *int) error {
+	if p != nil && (*p < 0 || *p > MaxPriority) {
+		return ErrInvalidPriority
+	}
+	return nil
+}
+
+// maxEstimateMinutes caps the estimate of a todo: a year of eight-hour working
+// days.
+const maxEstimateMinutes = 250 * 8 * 60
+
+func validateEstimate(minutes *int) error {
+	if minutes != nil && (*minutes < 0 || *minutes > maxEstimateMinutes) {
+		return ErrInvalidEstimate
+	}
+	return nil
+}
+
+// CreateTodoInput creates a todo in ListID, or outside any list if it is
+// nil. Without a status the todo starts in its workflow's initial state.
 type CreateTodoInput struct {
-	DueDate     *time.Time `json:"due_date"`
-	Title       string     `json:"title" binding:"required"`
-	Description string     `json:"description"`
+	DueDate         *time.Time `json:"due_date"`
+	StartDate       *time.Time `json:"start_date"`
+	Priority        *int       `json:"priority"`
+	EstimateMinutes *int       `json:"estimate_minutes"`
+	ListID          *int64     `json:"list_id"`
+	Tags            Tags       `json:"tags"`
+	Title           string     `json:"title" binding:"required"`
+	Description     string     `json:"description"`
+	ExternalID      string     `json:"external_id"`
+	Source          string     `json:"source"`
+	Status          string     `json:"status"`
 }
 
 func (c *CreateTodoInput) Validate() error {
@@ -29,15 +124,47 @@ func (c *CreateTodoInput) Validate() error {
 	if len(c.Title) > 255 {
 		return ErrTitleMaxLength
 	}
+	if err := validatePriority(c.Priority); err != nil {
+		return err
+	}
+	if err := validateEstimate(c.EstimateMinutes); err != nil {
+		return err
+	}
+	tags, err := normalizeTags(c.Tags)
+	if err != nil {
+		return err
+	}
+	c.Tags = tags
+
+	c.ExternalID = strings.TrimSpace(c.ExternalID)
+	c.Source = strings.TrimSpace(c.Source)
+	if (c.ExternalID == "") != (c.Source == "") || len(c.ExternalID) > 255 || len(c.Source) > 64 {
+		return ErrInvalidExternalID
+	}
+	if c.ListID != nil && *c.ListID <= 0 {
+		return ErrInvalidList
+	}
+	c.Status = strings.TrimSpace(c.Status)
 	return nil
 }
 
+// UpdateTodoInput changes the fields it sets. Setting status moves the todo
+// within its workflow and wins over completed.
 type UpdateTodoInput struct {
-	Title       *string    `json:"title"`
-	Description *string    `json:"description"`
-	DueDate     *time.Time `json:"due_date"`
-	Completed   *bool      `json:"completed"`
-	ID          int64      `json:"id" binding:"required"`
+	Title           *string    `json:"title"`
+	Description     *string    `json:"description"`
+	DueDate         *time.Time `json:"due_date"`
+	StartDate       *time.Time `json:"start_date"`
+	Completed       *bool      `json:"completed"`
+	Status          *string    `json:"status"`
+	Priority        *int       `json:"priority"`
+	EstimateMinutes *int       `json:"estimate_minutes"`
+	Tags            *Tags      `json:"tags"`
+	ID              int64      `json:"id" binding:"required"`
+	// snoozedUntil and wake are set by Snooze and Wake; clients change
+	// snoozes through the snooze endpoint only.
+	snoozedUntil *time.Time
+	wake         bool
 }
 
 func (u *UpdateTodoInput) Validate() error {
@@ -53,5 +180,72 @@ func (u *UpdateTodoInput) Validate() error {
 			return ErrTitleMaxLength
 		}
 	}
+	if err := validatePriority(u.Priority); err != nil {
+		return err
+	}
+	if err := validateEstimate(u.EstimateMinutes); err != nil {
+		return err
+	}
+	if u.Tags != nil {
+		tags, err := normalizeTags(*u.Tags)
+		if err != nil {
+			return err
+		}
+		*u.Tags = tags
+	}
+	return validateStatus(u.Status)
+}
+
+// apply returns a copy of todo with the fields set in the input changed and
+// its update time set to now.
+func (u UpdateTodoInput) apply(todo *Todo, now time.Time) *Todo {
+	updated := *todo
+	if u.Title != nil {
+		updated.Title = *u.Title
+	}
+	if u.Description != nil {
+		updated.Description = *u.Description
+	}
+	if u.DueDate != nil {
+		updated.DueDate = u.DueDate
+	}
+	if u.StartDate != nil {
+		updated.StartDate = u.StartDate
+	}
+	if u.snoozedUntil != nil {
+		updated.SnoozedUntil = u.snoozedUntil
+	}
+	if u.wake {
+		updated.SnoozedUntil = nil
+	}
+	if u.Completed != nil {
+		updated.Completed = *u.Completed
+	}
+	if u.Status != nil {
+		updated.Status = *u.Status
+	}
+	if u.Priority != nil {
+		updated.Priority = u.Priority
+	}
+	if u.EstimateMinutes != nil {
+		updated.EstimateMinutes = u.EstimateMinutes
+	}
+	if u.Tags != nil {
+		updated.Tags = *u.Tags
+	}
+	updated.UpdatedAt = now
+	return &updated
+}
+
+// validateStatus trims a status being set. Whether the todo's workflow has
+// the state is only known once the todo is read.
+func validateStatus(status *string) error {
+	if status == nil {
+		return nil
+	}
+	*status = strings.TrimSpace(*status)
+	if *status == "" {
+		return ErrInvalidStatus
+	}
 	return nil
 }
@@ -0,0 +1,240 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+	OperationImport = "import"
+	OperationMove   = "move"
+	OperationUndo   = "undo"
+)
+
+// Operation groups the events written by a single bulk request so that the
+// request can be undone as a unit until ExpiresAt.
+type Operation struct {
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UndoneAt  *time.Time `json:"undone_at,omitempty" db:"undone_at"`
+	ID        string     `json:"id" db:"id"`
+	Kind      string     `json:"kind" db:"kind"`
+	Actor     string     `json:"actor" db:"actor"`
+}
+
+// insertOperation records op. Recording the same operation again is a no-op,
+// which lets long-running imports spread one operation over several
+// transactions.
+func insertOperation(ctx context.Context, tx *sqlx.Tx, op *Operation) error {
+	_, err := tx.NamedExecContext(ctx,
+		`INSERT INTO operations (id, kind, actor, created_at, expires_at)
+		 VALUES (:id, :kind, :actor, :created_at, :expires_at)
+		 ON DUPLICATE KEY UPDATE id = id`, op)
+	return err
+}
+
+// OperationActor returns the actor that performed an operation.
+func (r *Repository) OperationActor(ctx context.Context, id string) (string, error) {
+	var actor string
+	err := r.db.GetContext(ctx, &actor, "SELECT actor FROM operations WHERE id = ?", id)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return actor, err
+}
+
+// Undo reverts every change recorded under the operation id, in reverse
+// order, as part of the new operation undo. It fails with ErrConflict if any
+// affected todo has been changed since.
+func (r *Repository) Undo(ctx context.Context, id string, undo *Operation) ([]*Todo, error) {
+	var reverted []*Todo
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		var op Operation
+		err := tx.GetContext(ctx, &op, "SELECT * FROM operations WHERE id = ? FOR UPDATE", id)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if op.UndoneAt != nil {
+			return ErrOperationUndone
+		}
+		if undo.CreatedAt.After(op.ExpiresAt) {
+			return ErrOperationExpired
+		}
+
+		var events []TodoEvent
+		err = tx.SelectContext(ctx, &events,
+			"SELECT * FROM todo_events WHERE operation_id = ? ORDER BY id DESC", id)
+		if err != nil {
+			return err
+		}
+
+		if err := insertOperation(ctx, tx, undo); err != nil {
+			return err
+		}
+
+		reverted = make([]*Todo, 0, len(events))
+		undoEvents := make([]TodoEvent, 0, len(events))
+		for _, event := range events {
+			todo, undoEvent, err := revertEvent(ctx, tx, undo, event)
+			if err != nil {
+				return err
+			}
+			reverted = append(reverted, todo)
+			undoEvents = append(undoEvents, undoEvent)
+		}
+		if err := insertEvents(ctx, tx, undoEvents); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE operations SET undone_at = ? WHERE id = ?", undo.CreatedAt, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reverted, nil
+}
+
+// revertEvent restores the todo touched by event to its state before the
+// event. It returns the affected todo and the event recording the reversal.
+func revertEvent(ctx context.Context, tx *sqlx.Tx, undo *Operation, event TodoEvent) (*Todo, TodoEvent, error) {
+	var current *Todo
+	if event.Action != EventDeleted {
+		var err error
+		current, err = getForUpdate(ctx, tx, event.TodoID)
+		if err == ErrNotFound {
+			return nil, TodoEvent{}, ErrConflict
+		}
+		if err != nil {
+			return nil, TodoEvent{}, err
+		}
+	}
+
+	var latest int64
+	err := tx.GetContext(ctx, &latest, "SELECT MAX(id) FROM todo_events WHERE todo_id = ?", event.TodoID)
+	if err != nil {
+		return nil, TodoEvent{}, err
+	}
+	if latest != event.ID {
+		return nil, TodoEvent{}, ErrConflict
+	}
+
+	switch event.Action {
+	case EventCreated:
+		if _, err := tx.ExecContext(ctx, "DELETE FROM todos WHERE id = ?", current.ID); err != nil {
+			return nil, TodoEvent{}, err
+		}
+		return current, newTodoEvent(ctx, undo, EventDeleted, current, nil), nil
+
+	case EventUpdated:
+		restored := restoreSnapshot(event.Snapshot.Todo)
+		restored.UpdatedAt = undo.CreatedAt
+		// Logged time is not part of what an update changes.
+		restored.LoggedMinutes = current.LoggedMinutes
+		// Nor is the position, unless the update was a move: the list may
+		// have been rebalanced since, which rewrites positions without an
+		// event, and the old key would put the todo out of place.
+		if _, moved := event.Changes["position"]; !moved {
+			restored.Position = current.Position
+		}
+		if err := updateTodo(ctx, tx, current, &restored); err != nil {
+			return nil, TodoEvent{}, err
+		}
+		return &restored, newTodoEvent(ctx, undo, EventUpdated, current, &restored), nil
+
+	case EventDeleted:
+		restored := restoreSnapshot(event.Snapshot.Todo)
+		restored.UpdatedAt = undo.CreatedAt
+		if err := insertTodo(ctx, tx, &restored); err != nil {
+			return nil, TodoEvent{}, err
+		}
+		// Time stopped while the todo was deleted is missing from its
+		// snapshot.
+		logged, err := syncLoggedMinutes(ctx, tx, restored.ID)
+		if err != nil {
+			return nil, TodoEvent{}, err
+		}
+		restored.LoggedMinutes = logged
+		return &restored, newTodoEvent(ctx, undo, EventCreated, nil, &restored), nil
+	}
+
+	return nil, TodoEvent{}, fmt.Errorf("cannot undo event action %q", event.Action)
+}
+
+// restoreSnapshot returns a copy of a todo recorded by an event, to be
+// written back as it was. Undo bypasses workflow transitions and WIP limits.
+// Snapshots taken before todos had a status get the default workflow's.
+func restoreSnapshot(snapshot *Todo) Todo {
+	restored := *snapshot
+	if restored.Status == "" {
+		restored.Status = defaultWorkflow.first(restored.Completed)
+	}
+	return restored
+}
+
+// newOperation starts a new operation of the given kind attributed to the
+// caller in ctx.
+func (s *Service) newOperation(ctx context.Context, kind string) *Operation {
+	now := time.Now()
+	return &Operation{
+		ID:        RandomID(),
+		Kind:      kind,
+		Actor:     ActorFromContext(ctx),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.undoWindow),
+	}
+}
+
+// Undo reverts an operation. Users may only undo their own.
+func (s *Service) Undo(ctx context.Context, id string) ([]*Todo, *Operation, error) {
+	if id == "" {
+		return nil, nil, ErrInvalidID
+	}
+	if user := UserFromContext(ctx); user != nil {
+		actor, err := s.repo.OperationActor(ctx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if actor != user.Name {
+			return nil, nil, ErrNotFound
+		}
+	}
+
+	op := s.newOperation(ctx, OperationUndo)
+	todos, err := s.repo.Undo(ctx, id, op)
+	if err != nil {
+		return nil, nil, err
+	}
+	return todos, op, nil
+}
+
+func (h *Handler) UndoOperation(c *gin.Context) {
+	todos, op, err := h.service.Undo(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": todos, "meta": operationMeta(op)})
+}
+
+// operationMeta describes op in the meta object of a bulk response so that
+// clients can undo it.
+func operationMeta(op *Operation) gin.H {
+	return gin.H{
+		"operation_id":    op.ID,
+		"undo_expires_at": op.ExpiresAt,
+	}
+}
@@ -0,0 +1,522 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/fx"
+)
+
+// Sort orders for lists of todos: newest first, or the manual order set by
+// moving todos.
+const (
+	SortCreated  = "created"
+	SortPosition = "position"
+)
+
+// todoOrders are the ORDER BY clauses of the sort orders.
+var todoOrders = map[string]string{
+	"":           "created_at DESC",
+	SortCreated:  "created_at DESC",
+	SortPosition: "position, id",
+}
+
+// positionDigits are the base-62 digits of position keys, in byte order.
+const positionDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// positionRebalanceLength is the key length past which the rebalancer
+// rewrites a list's positions. The column holds 255 characters, which leaves
+// room for the moves made until it runs.
+const positionRebalanceLength = 64
+
+// A position key is a variable-length integer followed by a fraction, both
+// in base 62, that sorts bytewise. The integer's first character gives its
+// length and sign: a0 to az, then b00 to bzz and so on upwards, Zz to Z0,
+// then Yzz and so on downwards. Appending or prepending increments the
+// integer, so keys grow logarithmically; inserting between two keys takes
+// the midpoint of their fractions, which grows by a character every few
+// moves into the same gap until the keys are rebalanced.
+
+// integerLength returns the length of a key's integer part given its first
+// character.
+func integerLength(head byte) (int, error) {
+	switch {
+	case head >= 'a' && head <= 'z':
+		return int(head-'a') + 2, nil
+	case head >= 'A' && head <= 'Z':
+		return int('Z'-head) + 2, nil
+	}
+	return 0, fmt.Errorf("invalid position key head %q", head)
+}
+
+// splitPosition splits a key into its integer and fraction parts.
+func splitPosition(key string) (string, string, error) {
+	if key == "" {
+		return "", "", errors.New("empty position key")
+	}
+	n, err := integerLength(key[0])
+	if err != nil {
+		return "", "", err
+	}
+	if n > len(key) {
+		return "", "", fmt.Errorf("invalid position key %q", key)
+	}
+	if strings.HasSuffix(key[n:], "0") {
+		return "", "", fmt.Errorf("position key %q has a trailing zero", key)
+	}
+	return key[:n], key[n:], nil
+}
+
+// incrementInteger returns the integer after x, or false if x is the
+// largest.
+func incrementInteger(x string) (string, bool) {
+	head, digits := x[0], []byte(x[1:])
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := strings.IndexByte(positionDigits, digits[i]) + 1
+		if d < len(positionDigits) {
+			digits[i] = positionDigits[d]
+			return string(head) + string(digits), true
+		}
+		digits[i] = positionDigits[0]
+	}
+	switch head {
+	case 'Z':
+		return "a0", true
+	case 'z':
+		return "", false
+	}
+	head++
+	if head > 'a' {
+		digits = append(digits, positionDigits[0])
+	} else {
+		digits = digits[:len(digits)-1]
+	}
+	return string(head) + string(digits), true
+}
+
+// decrementInteger returns the integer before x, or false if x is the
+// smallest.
+func decrementInteger(x string) (string, bool) {
+	head, digits := x[0], []byte(x[1:])
+	last := positionDigits[len(positionDigits)-1]
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := strings.IndexByte(positionDigits, digits[i]) - 1
+		if d >= 0 {
+			digits[i] = positionDigits[d]
+			return string(head) + string(digits), true
+		}
+		digits[i] = last
+	}
+	switch head {
+	case 'a':
+		return "Z" + string(last), true
+	case 'A':
+		return "", false
+	}
+	head--
+	if head < 'Z' {
+		digits = append(digits, last)
+	} else {
+		digits = digits[:len(digits)-1]
+	}
+	return string(head) + string(digits), true
+}
+
+// midpoint returns a fraction between the fractions a and b, where b is
+// empty for no upper bound. a must sort before b.
+func midpoint(a, b string) string {
+	if b != "" {
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			return b[:n] + midpoint(a[min(n, len(a)):], b[n:])
+		}
+	}
+	digitA := 0
+	if a != "" {
+		digitA = strings.IndexByte(positionDigits, a[0])
+	}
+	digitB := len(positionDigits)
+	if b != "" {
+		digitB = strings.IndexByte(positionDigits, b[0])
+	}
+	if digitB-digitA > 1 {
+		return string(positionDigits[(digitA+digitB+1)/2])
+	}
+	if len(b) > 1 {
+		return b[:1]
+	}
+	return string(positionDigits[digitA]) + midpoint(a[min(1, len(a)):], "")
+}
+
+// digitAt returns the digit of fraction a at i, or zero past its end.
+func digitAt(a string, i int) byte {
+	if i < len(a) {
+		return a[i]
+	}
+	return positionDigits[0]
+}
+
+// positionBetween returns a key that sorts after a and before b. Either may
+// be empty for no bound.
+func positionBetween(a, b string) (string, error) {
+	if a != "" && b != "" && a >= b {
+		return "", ErrPositionTie
+	}
+	var ia, fa, ib, fb string
+	var err error
+	if a != "" {
+		if ia, fa, err = splitPosition(a); err != nil {
+			return "", err
+		}
+	}
+	if b != "" {
+		if ib, fb, err = splitPosition(b); err != nil {
+			return "", err
+		}
+	}
+
+	switch {
+	case a == "" && b == "":
+		return "a0", nil
+	case a == "":
+		prev, ok := decrementInteger(ib)
+		switch {
+		case !ok:
+			return ib + midpoint("", fb), nil
+		case fb != "":
+			return ib, nil
+		}
+		return prev, nil
+	case b == "":
+		if next, ok := incrementInteger(ia); ok {
+			return next, nil
+		}
+		return ia + midpoint(fa, ""), nil
+	case ia == ib:
+		return ia + midpoint(fa, fb), nil
+	}
+	if next, ok := incrementInteger(ia); ok && next < b {
+		return next, nil
+	}
+	return ia + midpoint(fa, ""), nil
+}
+
+// assignPositions gives the todos without a position keys above every
+// existing todo of their list, in slice order, so that new todos top the
+// manual order as they top the newest-first one. The top of each list is
+// read FOR UPDATE, so that concurrent creates wait for each other rather than
+// take the same key. A list without todos has no row to lock, so the keys
+// also end in a suffix of the connection's ID, which no concurrent
+// transaction shares, and cannot tie. Todos restored by an undo keep theirs.
+func assignPositions(ctx context.Context, tx *sqlx.Tx, todos []*Todo) error {
+	// Todos outside lists are grouped under 0, which no list has as ID.
+	unpositioned := make(map[int64][]*Todo)
+	for _, todo := range todos {
+		if todo.Position == "" {
+			var list int64
+			if todo.ListID != nil {
+				list = *todo.ListID
+			}
+			unpositioned[list] = append(unpositioned[list], todo)
+		}
+	}
+	if len(unpositioned) == 0 {
+		return nil
+	}
+
+	var conn uint64
+	if err := tx.GetContext(ctx, &conn, "SELECT CONNECTION_ID()"); err != nil {
+		return err
+	}
+	suffix := positionSuffix(conn)
+
+	// Lock the lists in ID order so that concurrent creates in several lists
+	// do not deadlock.
+	for _, list := range slices.Sorted(maps.Keys(unpositioned)) {
+		var listID *int64
+		if list != 0 {
+			listID = &list
+		}
+		var first []string
+		err := tx.SelectContext(ctx, &first,
+			"SELECT position FROM todos WHERE list_id <=> ? ORDER BY position, id LIMIT 1 FOR UPDATE", listID)
+		if err != nil {
+			return err
+		}
+		next := ""
+		if len(first) > 0 {
+			next = first[0]
+		}
+		group := unpositioned[list]
+		for i := len(group) - 1; i >= 0; i-- {
+			key, err := positionBelow(next)
+			if err != nil {
+				return err
+			}
+			group[i].Position = key + suffix
+			next = key
+		}
+	}
+	return nil
+}
+
+// positionBelow returns a key before b, or the first key if b is empty, that
+// is no prefix of b, so that it stays before b whatever is appended to it.
+func positionBelow(b string) (string, error) {
+	key, err := positionBetween("", b)
+	for err == nil && strings.HasPrefix(b, key) {
+		key, err = positionBetween("", key)
+	}
+	return key, err
+}
+
+// positionSuffixLength is the number of base-62 digits that hold any
+// uint64.
+const positionSuffixLength = 11
+
+// positionSuffix returns n as fixed-width base-62 digits without trailing
+// zeros, which keys may not end in. Dropping them keeps the suffixes of
+// different numbers apart, as their width is fixed.
+func positionSuffix(n uint64) string {
+	digits := make([]byte, positionSuffixLength)
+	for i := len(digits) - 1; i >= 0; i-- {
+		digits[i] = positionDigits[n%uint64(len(positionDigits))]
+		n /= uint64(len(positionDigits))
+	}
+	return strings.TrimRight(string(digits), positionDigits[:1])
+}
+
+// sameList reports whether two list IDs, nil outside lists, are the same.
+func sameList(a, b *int64) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+// Move places the todo id immediately before or after the anchor todo in
+// their list's manual order by giving it a key between the anchor and the
+// anchor's neighbour. Only the moved row changes. It fails with
+// ErrPositionTie if the anchor and its neighbour share a key.
+func (r *Repository) Move(ctx context.Context, op *Operation, id, anchorID int64, before bool) (*Todo, error) {
+	var moved *Todo
+	err := r.withRetryTx(ctx, "move", func(tx *sqlx.Tx) error {
+		if err := insertOperation(ctx, tx, op); err != nil {
+			return err
+		}
+		locked, err := getManyForUpdate(ctx, tx, []int64{min(id, anchorID), max(id, anchorID)})
+		if err != nil {
+			return err
+		}
+		todo, anchor := locked[id], locked[anchorID]
+		if todo == nil || anchor == nil {
+			return ErrNotFound
+		}
+		if !sameList(todo.ListID, anchor.ListID) {
+			return ErrInvalidMove
+		}
+
+		query := `SELECT position FROM todos WHERE list_id <=> ? AND (position, id) > (?, ?) AND id <> ?
+			ORDER BY position, id LIMIT 1 FOR UPDATE`
+		if before {
+			query = `SELECT position FROM todos WHERE list_id <=> ? AND (position, id) < (?, ?) AND id <> ?
+				ORDER BY position DESC, id DESC LIMIT 1 FOR UPDATE`
+		}
+		var neighbours []string
+		if err := tx.SelectContext(ctx, &neighbours, query, anchor.ListID, anchor.Position, anchor.ID, id); err != nil {
+			return err
+		}
+		lo, hi := anchor.Position, ""
+		if len(neighbours) > 0 {
+			hi = neighbours[0]
+		}
+		if before {
+			lo, hi = hi, anchor.Position
+		}
+		key, err := positionBetween(lo, hi)
+		if err != nil {
+			return err
+		}
+
+		after := *todo
+		after.Position = key
+		after.UpdatedAt = op.CreatedAt
+		if err := updateTodo(ctx, tx, todo, &after); err != nil {
+			return err
+		}
+		moved = &after
+		return insertEvents(ctx, tx, []TodoEvent{newTodoEvent(ctx, op, EventUpdated, todo, &after)})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+// PositionLists returns the lists, nil for todos outside lists, that have
+// todos or, with unbalanced, only those with a key longer than
+// positionRebalanceLength or two todos sharing a key.
+func (r *Repository) PositionLists(ctx context.Context, unbalanced bool) ([]*int64, error) {
+	query, args := "SELECT DISTINCT list_id FROM todos", []any{}
+	if unbalanced {
+		query = `SELECT DISTINCT list_id FROM todos WHERE CHAR_LENGTH(position) > ?
+			UNION SELECT list_id FROM todos GROUP BY list_id, position HAVING COUNT(*) > 1`
+		args = append(args, positionRebalanceLength)
+	}
+	var rows []sql.NullInt64
+	if err := r.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	lists := make([]*int64, len(rows))
+	for i, row := range rows {
+		if row.Valid {
+			lists[i] = &row.Int64
+		}
+	}
+	return lists, nil
+}
+
+// RebalancePositions rewrites the position keys of a list, nil for the todos
+// outside lists, with the shortest keys that keep its order, breaking ties
+// by ID. It is not an edit, so neither updated_at nor the audit log change.
+// It returns how many todos it rewrote.
+func (r *Repository) RebalancePositions(ctx context.Context, listID *int64) (int, error) {
+	var count int
+	err := r.withRetryTx(ctx, "rebalance_positions", func(tx *sqlx.Tx) error {
+		var ids []int64
+		err := tx.SelectContext(ctx, &ids, "SELECT id FROM todos WHERE list_id <=> ? ORDER BY position, id FOR UPDATE", listID)
+		if err != nil {
+			return err
+		}
+		count = len(ids)
+
+		key := ""
+		for start := 0; start < len(ids); start += bulkChunkSize {
+			chunk := ids[start:min(start+bulkChunkSize, len(ids))]
+			var (
+				query strings.Builder
+				args  []any
+			)
+			query.WriteString("UPDATE todos SET position = CASE id")
+			for _, id := range chunk {
+				var err error
+				if key, err = positionBetween(key, ""); err != nil {
+					return err
+				}
+				query.WriteString(" WHEN ? THEN ?")
+				args = append(args, id, key)
+			}
+			query.WriteString(" END, updated_at = updated_at WHERE id IN (?" + strings.Repeat(", ?", len(chunk)-1) + ")")
+			for _, id := range chunk {
+				args = append(args, id)
+			}
+			if _, err := tx.ExecContext(ctx, query.String(), args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// MoveInput names the todo a moved todo should end up directly before or
+// after. Exactly one must be set.
+type MoveInput struct {
+	Before *int64 `json:"before"`
+	After  *int64 `json:"after"`
+}
+
+// Move reorders a todo in its list's manual order. Keys that grow past
+// positionRebalanceLength, and neighbours sharing a key, are left to the
+// rebalancer.
+func (s *Service) Move(ctx context.Context, id int64, input MoveInput) (*Todo, *Operation, error) {
+	if id <= 0 {
+		return nil, nil, ErrInvalidID
+	}
+	if (input.Before == nil) == (input.After == nil) {
+		return nil, nil, ErrInvalidMove
+	}
+	anchor := input.After
+	if input.Before != nil {
+		anchor = input.Before
+	}
+	if *anchor <= 0 || *anchor == id {
+		return nil, nil, ErrInvalidMove
+	}
+	if err := s.authorizeTodos(ctx, []int64{id, *anchor}, RoleEditor); err != nil {
+		return nil, nil, err
+	}
+
+	op := s.newOperation(ctx, OperationMove)
+	todo, err := s.repo.Move(ctx, op, id, *anchor, input.Before != nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return todo, op, nil
+}
+
+// RebalancePositions shortens the position keys of every list, or with
+// unbalanced only of those that need it, one list per transaction, keeping
+// each list's manual order. It returns how many todos it rewrote.
+func (s *Service) RebalancePositions(ctx context.Context, unbalanced bool) (int, error) {
+	lists, err := s.repo.PositionLists(ctx, unbalanced)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, list := range lists {
+		count, err := s.repo.RebalancePositions(ctx, list)
+		if err != nil {
+			return total, err
+		}
+		total += count
+	}
+	if len(lists) > 0 {
+		slog.Info("Rebalanced todo positions", "lists", len(lists), "todos", total)
+	}
+	return total, nil
+}
+
+// StartPositionRebalancer rebalances the lists whose keys grew too long or
+// tie every POSITION_REBALANCE_INTERVAL for the lifetime of the application.
+func StartPositionRebalancer(lc fx.Lifecycle, service *Service) {
+	runEvery(lc, GetEnvDuration("POSITION_REBALANCE_INTERVAL", 10*time.Minute), func(ctx context.Context) {
+		if _, err := service.RebalancePositions(ctx, true); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to rebalance positions", "error", err)
+		}
+	})
+}
+
+// MoveTodo serves POST /v1/todos/:id/move with a body of {"before": id} or
+// {"after": id}.
+func (h *Handler) MoveTodo(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	var input MoveInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	todo, op, err := h.service.Move(c.Request.Context(), id, input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": todo, "meta": operationMeta(op)})
+}
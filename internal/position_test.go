@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPositionBetween(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{a: "", b: "", want: "a0"},
+		{a: "a0", b: "", want: "a1"},
+		{a: "az", b: "", want: "b00"},
+		{a: "", b: "a0", want: "Zz"},
+		{a: "", b: "Z0", want: "Yzz"},
+		{a: "a0", b: "a1", want: "a0V"},
+		{a: "a0V", b: "a1", want: "a0l"},
+		{a: "a0", b: "a0V", want: "a0G"},
+		{a: "a1", b: "a5", want: "a2"},
+		{a: "", b: "a0V", want: "a0"},
+		// Keys written by migration 000014.
+		{a: "", b: "e00001", want: "e00000"},
+		{a: "e00001", b: "e00002", want: "e00001V"},
+	}
+	for _, tt := range tests {
+		got, err := positionBetween(tt.a, tt.b)
+		require.NoError(t, err, "between %q and %q", tt.a, tt.b)
+		assert.Equal(t, tt.want, got, "between %q and %q", tt.a, tt.b)
+	}
+
+	for _, bad := range [][2]string{{"a1", "a0"}, {"a1", "a1"}} {
+		_, err := positionBetween(bad[0], bad[1])
+		assert.ErrorIs(t, err, ErrPositionTie)
+	}
+	for _, bad := range []string{"!", "a", "a00", "b1"} {
+		_, err := positionBetween(bad, "")
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestPositionBetween_Sequences(t *testing.T) {
+	t.Run("appending and prepending grow logarithmically", func(t *testing.T) {
+		last, first := "", ""
+		for i := 0; i < 10000; i++ {
+			next, err := positionBetween(last, "")
+			require.NoError(t, err)
+			assert.Greater(t, next, last)
+			last = next
+
+			prev, err := positionBetween("", first)
+			require.NoError(t, err)
+			if first != "" {
+				assert.Less(t, prev, first)
+			}
+			first = prev
+		}
+		assert.LessOrEqual(t, len(last), 4)
+		assert.LessOrEqual(t, len(first), 4)
+	})
+
+	t.Run("moving into the same gap stays ordered", func(t *testing.T) {
+		lo, hi := "a0", "a1"
+		for i := 0; i < 200; i++ {
+			mid, err := positionBetween(lo, hi)
+			require.NoError(t, err)
+			assert.Greater(t, mid, lo)
+			assert.Less(t, mid, hi)
+			if i%2 == 0 {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		assert.Greater(t, len(lo), positionRebalanceLength/2, "repeated moves are what rebalancing is for")
+	})
+}
+
+func TestPositionBelow(t *testing.T) {
+	for _, b := range []string{"", "a0", "a5", "a0V", "Zz0001", "b01V"} {
+		key, err := positionBelow(b)
+		require.NoError(t, err, b)
+		if b != "" {
+			assert.Less(t, key, b, b)
+			assert.False(t, strings.HasPrefix(b, key), "%q is a prefix of %q", key, b)
+			assert.Less(t, key+"zzzz", b, "suffixes keep %q before %q", key, b)
+		}
+	}
+}
+
+func TestPositionSuffix(t *testing.T) {
+	assert.Equal(t, "00000000001", positionSuffix(1))
+	assert.Equal(t, "0000000001", positionSuffix(62))
+	assert.Len(t, positionSuffix(math.MaxUint64), positionSuffixLength)
+
+	seen := make(map[string]uint64)
+	for _, n := range []uint64{1, 2, 61, 62, 63, 62 * 62, 62*62 + 1, 12345, math.MaxUint32, math.MaxUint64} {
+		suffix := positionSuffix(n)
+		assert.False(t, strings.HasSuffix(suffix, "0"), suffix)
+		if other, ok := seen[suffix]; ok {
+			t.Errorf("%d and %d share the suffix %q", n, other, suffix)
+		}
+		seen[suffix] = n
+
+		key := "a0" + suffix
+		_, _, err := splitPosition(key)
+		assert.NoError(t, err, key)
+	}
+}
+
+func TestSameList(t *testing.T) {
+	one, other := int64(1), int64(1)
+	two := int64(2)
+
+	assert.True(t, sameList(nil, nil))
+	assert.True(t, sameList(&one, &other))
+	assert.False(t, sameList(&one, &two))
+	assert.False(t, sameList(&one, nil))
+	assert.False(t, sameList(nil, &two))
+}
+
+func TestService_Move_Validation(t *testing.T) {
+	service := &Service{repo: nil}
+	one, two, zero := int64(1), int64(2), int64(0)
+
+	tests := []struct {
+		input   MoveInput
+		wantErr error
+		name    string
+		id      int64
+	}{
+		{name: "invalid id", id: 0, input: MoveInput{Before: &two}, wantErr: ErrInvalidID},
+		{name: "no anchor", id: 1, input: MoveInput{}, wantErr: ErrInvalidMove},
+		{name: "both anchors", id: 1, input: MoveInput{Before: &two, After: &two}, wantErr: ErrInvalidMove},
+		{name: "itself", id: 1, input: MoveInput{After: &one}, wantErr: ErrInvalidMove},
+		{name: "invalid anchor", id: 1, input: MoveInput{Before: &zero}, wantErr: ErrInvalidMove},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := service.Move(context.Background(), tt.id, tt.input)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestRepository_Undo_KeepsRebalancedPosition(t *testing.T) {
+	repo := benchRepository(t)
+	ctx := WithActor(context.Background(), benchActor)
+	todos := benchTodos(0, 3)
+	require.NoError(t, repo.BulkCreate(ctx, benchOperation(OperationCreate), todos))
+
+	title := "bench renamed"
+	update := benchOperation(OperationUpdate)
+	_, err := repo.BulkUpdate(ctx, update, []UpdateTodoInput{{ID: todos[1].ID, Title: &title}})
+	require.NoError(t, err)
+	_, err = repo.RebalancePositions(ctx, nil)
+	require.NoError(t, err)
+	rebalanced, err := repo.GetByID(ctx, todos[1].ID)
+	require.NoError(t, err)
+
+	_, err = repo.Undo(ctx, update.ID, benchOperation(OperationUndo))
+	require.NoError(t, err)
+
+	undone, err := repo.GetByID(ctx, todos[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, todos[1].Title, undone.Title)
+	assert.Equal(t, rebalanced.Position, undone.Position)
+}
@@ -0,0 +1,390 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TodoQuery is a parsed filter expression such as
+//
+//	is:open due:<2026-11-01 tag:ops priority:>=P1 "deploy"
+//
+// Terms are separated by spaces and must all match. A term is either text,
+// a bare word or a "quoted phrase" matched as a substring of the title or
+// description, or a qualifier:
+//
+//	is:open, is:done, is:overdue
+//	due:, created:, updated:,  a date (2026-11-01) or RFC3339 time, with an
+//	completed:                 optional <, <=, > or >=; due:none
+//	status:review              the todo is in the workflow state
+//	tag:ops                    the todo has the tag
+//	priority:P1                P0 is the most urgent, so priority:>=P1
+//	                           matches P0 and P1; priority:none
+//	source:jira                the todo was imported from the source
+//
+// A leading - negates a term. Qualifier values may be quoted.
+type TodoQuery struct {
+	source string
+	terms  []queryTerm
+}
+
+// queryTerm is one parsed term of a TodoQuery. field is empty for text.
+type queryTerm struct {
+	value  any
+	field  string
+	op     string
+	negate bool
+}
+
+// QueryError reports where a filter expression failed to parse. Position is
+// the 1-based character offset of the offending token.
+type QueryError struct {
+	Message  string
+	Position int
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid query at position %d: %s", e.Position, e.Message)
+}
+
+// queryFields are the qualifiers a term may start with.
+var queryFields = map[string]bool{
+	"is": true, "due": true, "created": true, "updated": true, "completed": true,
+	"status": true, "tag": true, "priority": true, "source": true,
+}
+
+// queryDateColumns are the columns compared by the date qualifiers.
+var queryDateColumns = map[string]string{
+	"due": "due_date", "created": "created_at", "updated": "updated_at", "completed": "completed_at",
+}
+
+// queryComparisons are the operators allowed before dates and priorities,
+// longest first.
+var queryComparisons = []string{"<=", ">=", "<", ">", "="}
+
+// ParseTodoQuery parses a filter expression. An empty expression matches
+// every todo.
+func ParseTodoQuery(source string) (*TodoQuery, error) {
+	q := &TodoQuery{source: source}
+	s := queryScanner{src: source}
+	for {
+		s.skipSpace()
+		if s.done() {
+			return q, nil
+		}
+
+		start := s.pos
+		var term queryTerm
+		if s.peek() == '-' {
+			term.negate = true
+			s.pos++
+		}
+
+		if s.peek() == '"' {
+			text, err := s.quoted()
+			if err != nil {
+				return nil, err
+			}
+			term.value = text
+			q.terms = append(q.terms, term)
+			continue
+		}
+
+		word := s.word(':')
+		if s.done() || s.peek() != ':' {
+			if word == "" {
+				return nil, s.errorAt(start, "expected a word, phrase or qualifier")
+			}
+			term.value = word
+			q.terms = append(q.terms, term)
+			continue
+		}
+		s.pos++ // the colon
+
+		term.field = strings.ToLower(word)
+		if term.field == "" {
+			return nil, s.errorAt(start, "expected a qualifier before ':'")
+		}
+		if !queryFields[term.field] {
+			return nil, s.errorAt(start, fmt.Sprintf("unknown qualifier %q", word+":"))
+		}
+		valueStart := s.pos
+		for _, op := range queryComparisons {
+			if strings.HasPrefix(source[s.pos:], op) {
+				term.op = op
+				s.pos += len(op)
+				break
+			}
+		}
+		var value string
+		if s.peek() == '"' {
+			var err error
+			if value, err = s.quoted(); err != nil {
+				return nil, err
+			}
+		} else {
+			value = s.word(0)
+		}
+		if value == "" {
+			return nil, s.errorAt(valueStart, fmt.Sprintf("missing value for %q", word+":"))
+		}
+		if err := term.parseValue(value); err != nil {
+			return nil, s.errorAt(valueStart, err.Error())
+		}
+		q.terms = append(q.terms, term)
+	}
+}
+
+// parseValue checks the operator and value of a qualifier term and converts
+// the value to what its SQL condition compares against.
+func (t *queryTerm) parseValue(value string) error {
+	lower := strings.ToLower(value)
+	switch t.field {
+	case "is":
+		if t.op != "" {
+			return fmt.Errorf("is: does not take %q", t.op)
+		}
+		switch lower {
+		case "open", "done", "overdue":
+		case "completed":
+			lower = "done"
+		default:
+			return fmt.Errorf("unknown state %q, expected open, done or overdue", value)
+		}
+		t.value = lower
+
+	case "due", "created", "updated", "completed":
+		if lower == "none" && t.field == "due" && t.op == "" {
+			t.value = nil
+			return nil
+		}
+		if day, err := time.Parse(time.DateOnly, value); err == nil {
+			t.value = queryDay(day)
+			return nil
+		}
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC3339", value)
+		}
+		t.value = at
+
+	case "tag":
+		if t.op != "" {
+			return fmt.Errorf("tag: does not take %q", t.op)
+		}
+		tags, err := normalizeTags(Tags{value})
+		if err != nil {
+			return err
+		}
+		t.value = tags[0]
+
+	case "priority":
+		if lower == "none" && t.op == "" {
+			t.value = nil
+			return nil
+		}
+		p, err := strconv.Atoi(strings.TrimPrefix(lower, "p"))
+		if err != nil || validatePriority(&p) != nil {
+			return fmt.Errorf("invalid priority %q, expected P0 to P%d", value, MaxPriority)
+		}
+		t.value = p
+
+	case "status", "source":
+		if t.op != "" {
+			return fmt.Errorf("%s: does not take %q", t.field, t.op)
+		}
+		t.value = value
+	}
+	return nil
+}
+
+// queryDay is a date without a time. Comparisons against it cover the whole
+// UTC day.
+type queryDay time.Time
+
+// conds compiles the query to SQL conditions, to be joined with AND, and
+// their arguments.
+func (q *TodoQuery) conds() ([]string, []any) {
+	if q == nil {
+		return nil, nil
+	}
+	var (
+		conds []string
+		args  []any
+	)
+	for _, term := range q.terms {
+		cond, termArgs := term.cond()
+		if term.negate {
+			cond = "(" + cond + ") IS NOT TRUE"
+		}
+		conds = append(conds, cond)
+		args = append(args, termArgs...)
+	}
+	return conds, args
+}
+
+func (t queryTerm) cond() (string, []any) {
+	switch t.field {
+	case "is":
+		switch t.value {
+		case "open":
+			return "completed = FALSE", nil
+		case "done":
+			return "completed = TRUE", nil
+		default:
+			return "(completed = FALSE AND due_date < CURRENT_TIMESTAMP)", nil
+		}
+
+	case "due", "created", "updated", "completed":
+		column := queryDateColumns[t.field]
+		if t.value == nil {
+			return column + " IS NULL", nil
+		}
+		if day, ok := t.value.(queryDay); ok {
+			start := time.Time(day)
+			end := start.AddDate(0, 0, 1)
+			switch t.op {
+			case "<":
+				return column + " < ?", []any{start}
+			case "<=":
+				return column + " < ?", []any{end}
+			case ">":
+				return column + " >= ?", []any{end}
+			case ">=":
+				return column + " >= ?", []any{start}
+			default:
+				return "(" + column + " >= ? AND " + column + " < ?)", []any{start, end}
+			}
+		}
+		op := t.op
+		if op == "" {
+			op = "="
+		}
+		return column + " " + op + " ?", []any{t.value}
+
+	case "tag":
+		return "? MEMBER OF(tags)", []any{t.value}
+
+	case "priority":
+		if t.value == nil {
+			return "priority IS NULL", nil
+		}
+		// Lower numbers are more urgent, so the comparison flips.
+		op := map[string]string{"": "=", "=": "=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}[t.op]
+		return "priority " + op + " ?", []any{t.value}
+
+	case "status":
+		return "status = ?", []any{t.value}
+
+	case "source":
+		return "source = ?", []any{t.value}
+
+	default:
+		pattern := "%" + escapeLike(t.value.(string)) + "%"
+		return "(title LIKE ? OR COALESCE(description, '') LIKE ?)", []any{pattern, pattern}
+	}
+}
+
+// and returns a query matching the todos both q and other match. Either may
+// be nil.
+func (q *TodoQuery) and(other *TodoQuery) *TodoQuery {
+	switch {
+	case q == nil:
+		return other
+	case other == nil:
+		return q
+	}
+	return &TodoQuery{
+		source: strings.TrimSpace(q.source + " " + other.source),
+		terms:  append(append([]queryTerm{}, q.terms...), other.terms...),
+	}
+}
+
+func (q *TodoQuery) String() string {
+	if q == nil {
+		return ""
+	}
+	return q.source
+}
+
+func (q *TodoQuery) MarshalJSON() ([]byte, error) {
+	return json.Marshal(q.String())
+}
+
+func (q *TodoQuery) UnmarshalJSON(data []byte) error {
+	var source string
+	if err := json.Unmarshal(data, &source); err != nil {
+		return err
+	}
+	parsed, err := ParseTodoQuery(source)
+	if err != nil {
+		return err
+	}
+	*q = *parsed
+	return nil
+}
+
+// queryScanner walks a filter expression, tracking the byte offset of the
+// next character.
+type queryScanner struct {
+	src string
+	pos int
+}
+
+func (s *queryScanner) done() bool { return s.pos >= len(s.src) }
+
+func (s *queryScanner) peek() byte {
+	if s.done() {
+		return 0
+	}
+	return s.src[s.pos]
+}
+
+func (s *queryScanner) skipSpace() {
+	for !s.done() {
+		r, size := utf8.DecodeRuneInString(s.src[s.pos:])
+		if !unicode.IsSpace(r) {
+			return
+		}
+		s.pos += size
+	}
+}
+
+// word reads up to the next space or stop character.
+func (s *queryScanner) word(stop byte) string {
+	start := s.pos
+	for !s.done() {
+		r, size := utf8.DecodeRuneInString(s.src[s.pos:])
+		if unicode.IsSpace(r) || (stop != 0 && s.src[s.pos] == stop) {
+			break
+		}
+		s.pos += size
+	}
+	return s.src[start:s.pos]
+}
+
+// quoted reads a double-quoted string starting at the current position.
+func (s *queryScanner) quoted() (string, error) {
+	start := s.pos
+	end := strings.IndexByte(s.src[start+1:], '"')
+	if end < 0 {
+		return "", s.errorAt(start, "unterminated quoted string")
+	}
+	s.pos = start + 1 + end + 1
+	text := s.src[start+1 : start+1+end]
+	if strings.TrimSpace(text) == "" {
+		return "", s.errorAt(start, "empty quoted string")
+	}
+	return text, nil
+}
+
+// errorAt returns a QueryError at the byte offset pos, reported as a 1-based
+// character position.
+func (s *queryScanner) errorAt(pos int, message string) *QueryError {
+	return &QueryError{Message: message, Position: utf8.RuneCountInString(s.src[:pos]) + 1}
+}
@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTodoQuery(t *testing.T) {
+	nov1 := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	nov2 := nov1.AddDate(0, 0, 1)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantConds []string
+		wantArgs  []any
+	}{
+		{
+			name:  "empty",
+			query: "  ",
+		},
+		{
+			name:      "example",
+			query:     `is:open due:<2026-11-01 tag:ops priority:>=P1 "deploy"`,
+			wantConds: []string{"completed = FALSE", "due_date < ?", "? MEMBER OF(tags)", "priority <= ?", "(title LIKE ? OR COALESCE(description, '') LIKE ?)"},
+			wantArgs:  []any{nov1, "ops", 1, "%deploy%", "%deploy%"},
+		},
+		{
+			name:      "day comparisons",
+			query:     "due:2026-11-01 due:<=2026-11-01 created:>2026-11-01 updated:>=2026-11-01 completed:<2026-11-01",
+			wantConds: []string{"(due_date >= ? AND due_date < ?)", "due_date < ?", "created_at >= ?", "updated_at >= ?", "completed_at < ?"},
+			wantArgs:  []any{nov1, nov2, nov2, nov2, nov1, nov1},
+		},
+		{
+			name:      "timestamp",
+			query:     "due:>2026-11-01T09:30:00Z",
+			wantConds: []string{"due_date > ?"},
+			wantArgs:  []any{nov1.Add(9*time.Hour + 30*time.Minute)},
+		},
+		{
+			name:      "none values",
+			query:     "due:none priority:none",
+			wantConds: []string{"due_date IS NULL", "priority IS NULL"},
+		},
+		{
+			name:      "priority comparisons",
+			query:     "priority:2 priority:<p3 PRIORITY:>1",
+			wantConds: []string{"priority = ?", "priority > ?", "priority < ?"},
+			wantArgs:  []any{2, 3, 1},
+		},
+		{
+			name:      "status",
+			query:     "status:in_progress -status:review",
+			wantConds: []string{"status = ?", "(status = ?) IS NOT TRUE"},
+			wantArgs:  []any{"in_progress", "review"},
+		},
+		{
+			name:      "negation",
+			query:     `-is:done -tag:"ops" -100%`,
+			wantConds: []string{"(completed = TRUE) IS NOT TRUE", "(? MEMBER OF(tags)) IS NOT TRUE", "((title LIKE ? OR COALESCE(description, '') LIKE ?)) IS NOT TRUE"},
+			wantArgs:  []any{"ops", `%100\%%`, `%100\%%`},
+		},
+		{
+			name:      "states",
+			query:     "is:completed is:overdue source:jira",
+			wantConds: []string{"completed = TRUE", "(completed = FALSE AND due_date < CURRENT_TIMESTAMP)", "source = ?"},
+			wantArgs:  []any{"jira"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseTodoQuery(tt.query)
+			assert.NoError(t, err)
+
+			conds, args := q.conds()
+			assert.Equal(t, tt.wantConds, conds)
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
+
+func TestParseTodoQuery_Errors(t *testing.T) {
+	tests := []struct {
+		query    string
+		position int
+	}{
+		{query: "is:open colour:red", position: 9},
+		{query: "is:maybe", position: 4},
+		{query: "is:<open", position: 4},
+		{query: "due:<tomorrow", position: 5},
+		{query: "due:<none", position: 5},
+		{query: "priority:>=P99", position: 10},
+		{query: "tag:", position: 5},
+		{query: `tag:"a b"`, position: 5},
+		{query: `ops "deploy`, position: 5},
+		{query: `""`, position: 1},
+		{query: "ops :x", position: 5},
+		{query: "ops -", position: 5},
+		{query: "ünïcödé bad:x", position: 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := ParseTodoQuery(tt.query)
+			var queryErr *QueryError
+			if assert.ErrorAs(t, err, &queryErr) {
+				assert.Equal(t, tt.position, queryErr.Position)
+			}
+		})
+	}
+}
+
+func TestTodoQuery_JSON(t *testing.T) {
+	var filter TodoFilter
+	assert.NoError(t, json.Unmarshal([]byte(`{"query": "is:open tag:ops"}`), &filter))
+	assert.Equal(t, "is:open tag:ops", filter.Expression.String())
+
+	where, args := filter.where()
+	assert.Equal(t, " WHERE completed = FALSE AND ? MEMBER OF(tags)", where)
+	assert.Equal(t, []any{"ops"}, args)
+
+	data, err := json.Marshal(filter)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"completed": null, "due_after": null, "due_before": null, "query": "is:open tag:ops", "q": ""}`, string(data))
+
+	var queryErr *QueryError
+	assert.ErrorAs(t, json.Unmarshal([]byte(`{"query": "is:maybe"}`), &filter), &queryErr)
+}
+
+func TestHandler_ListTodos_InvalidQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handler := &Handler{service: &Service{repo: nil}}
+	handler.RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/todos?query="+url.QueryEscape("is:open due:soon"), nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"error": "invalid query at position 13: invalid date \"soon\", expected YYYY-MM-DD or RFC3339", "position": 13}`, rec.Body.String())
+}
+
+func TestService_CreateView_Validation(t *testing.T) {
+	svc := &Service{repo: nil}
+	name, blank, query := "Ops", "  ", "tag:ops is:bogus"
+
+	_, err := svc.CreateView(context.Background(), SavedViewInput{})
+	assert.ErrorIs(t, err, ErrInvalidViewName)
+
+	_, err = svc.CreateView(context.Background(), SavedViewInput{Name: &blank})
+	assert.ErrorIs(t, err, ErrInvalidViewName)
+
+	_, err = svc.CreateView(context.Background(), SavedViewInput{Name: &name, Query: &query})
+	var queryErr *QueryError
+	assert.ErrorAs(t, err, &queryErr)
+
+	_, err = svc.UpdateView(context.Background(), 1, SavedViewInput{Name: &blank})
+	assert.ErrorIs(t, err, ErrInvalidViewName)
+}
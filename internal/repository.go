@@ -3,20 +3,89 @@ package internal
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand/v2"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 )
 
 type Repository struct {
-	db *sqlx.DB
+	db       *sqlx.DB
+	searcher Searcher
 }
 
 func NewRepository(db *sqlx.DB) *Repository {
-	return &Repository{db: db}
+	return &Repository{db: db, searcher: newSearcher(db, GetEnv("SEARCH_BACKEND", SearchFullText))}
+}
+
+// withTx runs fn inside a transaction, committing if fn returns nil and
+// rolling back otherwise.
+func (r *Repository) withTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rerr := tx.Rollback(); rerr != nil && rerr != sql.ErrTxDone {
+			log.Printf("Rollback failed: %v", rerr)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Transactions that lose a deadlock or time out waiting for a row lock are
+// retried up to txMaxAttempts times, after a jittered delay that doubles
+// from txRetryBaseDelay.
+const (
+	txMaxAttempts    = 4
+	txRetryBaseDelay = 20 * time.Millisecond
+)
+
+// withRetryTx runs fn like withTx, retrying the whole transaction when MySQL
+// aborts it with a deadlock or lock wait timeout. fn must not keep state from
+// an aborted attempt. name labels the retries in the tx_retries_total metric.
+func (r *Repository) withRetryTx(ctx context.Context, name string, fn func(tx *sqlx.Tx) error) error {
+	return retryTx(ctx, name, func() error { return r.withTx(ctx, fn) })
+}
+
+// retryTx calls run, which runs one attempt of a transaction, until it
+// succeeds, fails with an error that is not retryable, or txMaxAttempts is
+// reached.
+func retryTx(ctx context.Context, name string, run func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := run()
+		if err == nil || !isRetryableError(err) || attempt == txMaxAttempts {
+			return err
+		}
+
+		var mysqlErr *mysql.MySQLError
+		errors.As(err, &mysqlErr)
+		txRetriesTotal.WithLabelValues(name, strconv.Itoa(int(mysqlErr.Number))).Inc()
+		select {
+		case <-time.After(retryDelay(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// retryDelay returns a random delay in [d/2, d), where d is txRetryBaseDelay
+// doubled for each attempt after the first, so that the transactions that
+// deadlocked do not collide again.
+func retryDelay(attempt int) time.Duration {
+	d := txRetryBaseDelay << (attempt - 1)
+	return d/2 + rand.N(d/2)
 }
 
 func (r *Repository) GetByID(ctx context.Context, id int64) (*Todo, error) {
@@ -28,12 +97,120 @@ func (r *Repository) GetByID(ctx context.Context, id int64) (*Todo, error) {
 	return &todo, err
 }
 
-func (r *Repository) List(ctx context.Context, page, limit int) ([]Todo, int64, error) {
+// TodoFilter narrows the todos returned by List and Stream. Zero values do
+// not filter.
+type TodoFilter struct {
+	Completed       *bool      `json:"completed"`
+	DueAfter        *time.Time `json:"due_after"`
+	DueBefore       *time.Time `json:"due_before"`
+	CompletedAfter  *time.Time `json:"completed_after,omitempty"`
+	CompletedBefore *time.Time `json:"completed_before,omitempty"`
+	ListID          *int64     `json:"list_id,omitempty"`
+	AssigneeID      *int64     `json:"assignee_id,omitempty"`
+	WatcherID       *int64     `json:"watcher_id,omitempty"`
+	Expression      *TodoQuery `json:"query,omitempty"`
+	// MemberID and MemberRoles narrow the filter to the lists a user has
+	// one of the roles on. They are set by the authorization layer, never
+	// by clients.
+	MemberID    *int64   `json:"-"`
+	MemberRoles []string `json:"-"`
+	// ActionableAt narrows the filter to the todos that have started and
+	// are not snoozed at that time. The list views set it unless asked to
+	// include snoozed todos.
+	ActionableAt *time.Time `json:"-"`
+	Query        string     `json:"q"`
+	Status       string     `json:"status,omitempty"`
+	Unassigned   bool       `json:"unassigned,omitempty"`
+}
+
+// where returns the SQL WHERE clause for the filter, including the leading
+// keyword, and its arguments.
+func (f TodoFilter) where() (string, []any) {
+	conds, args := f.conds()
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// conds returns the filter's SQL conditions, to be joined with AND, and their
+// arguments.
+func (f TodoFilter) conds() ([]string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	if f.Completed != nil {
+		conds = append(conds, "completed = ?")
+		args = append(args, *f.Completed)
+	}
+	if f.DueAfter != nil {
+		conds = append(conds, "due_date >= ?")
+		args = append(args, *f.DueAfter)
+	}
+	if f.DueBefore != nil {
+		conds = append(conds, "due_date < ?")
+		args = append(args, *f.DueBefore)
+	}
+	if f.CompletedAfter != nil {
+		conds = append(conds, "completed_at >= ?")
+		args = append(args, *f.CompletedAfter)
+	}
+	if f.CompletedBefore != nil {
+		conds = append(conds, "completed_at < ?")
+		args = append(args, *f.CompletedBefore)
+	}
+	if f.ListID != nil {
+		conds = append(conds, "list_id = ?")
+		args = append(args, *f.ListID)
+	}
+	if f.Status != "" {
+		conds = append(conds, "status = ?")
+		args = append(args, f.Status)
+	}
+	if f.AssigneeID != nil {
+		conds = append(conds, "EXISTS (SELECT 1 FROM todo_assignees a WHERE a.todo_id = todos.id AND a.user_id = ?)")
+		args = append(args, *f.AssigneeID)
+	}
+	if f.Unassigned {
+		conds = append(conds, "NOT EXISTS (SELECT 1 FROM todo_assignees a WHERE a.todo_id = todos.id)")
+	}
+	if f.WatcherID != nil {
+		conds = append(conds, "EXISTS (SELECT 1 FROM todo_watchers w WHERE w.todo_id = todos.id AND w.user_id = ?)")
+		args = append(args, *f.WatcherID)
+	}
+	if f.MemberID != nil {
+		conds = append(conds, "todos.list_id IN (SELECT m.list_id FROM list_members m WHERE m.user_id = ? AND m.role IN (?"+
+			strings.Repeat(", ?", len(f.MemberRoles)-1)+"))")
+		args = append(args, *f.MemberID)
+		for _, role := range f.MemberRoles {
+			args = append(args, role)
+		}
+	}
+	if f.ActionableAt != nil {
+		conds = append(conds, "(start_date IS NULL OR start_date <= ?) AND (snoozed_until IS NULL OR snoozed_until <= ?)")
+		args = append(args, *f.ActionableAt, *f.ActionableAt)
+	}
+	if f.Query != "" {
+		conds = append(conds, "title LIKE ?")
+		args = append(args, "%"+escapeLike(f.Query)+"%")
+	}
+	exprConds, exprArgs := f.Expression.conds()
+	return append(conds, exprConds...), append(args, exprArgs...)
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (r *Repository) List(ctx context.Context, filter TodoFilter, sort string, page, limit int) ([]Todo, int64, error) {
+	where, args := filter.where()
 	offset := (page - 1) * limit
 
 	var todos []Todo
 	err := r.db.SelectContext(ctx, &todos,
-		"SELECT * FROM todos ORDER BY created_at DESC LIMIT ? OFFSET ?", limit, offset)
+		"SELECT * FROM todos"+where+" ORDER BY "+todoOrders[sort]+" LIMIT ? OFFSET ?",
+		append(args, limit, offset)...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -43,76 +220,367 @@ func (r *Repository) List(ctx context.Context, page, limit int) ([]Todo, int64,
 	}
 
 	var total int64
-	err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM todos")
+	err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM todos"+where, args...)
 	return todos, total, err
 }
 
-func (r *Repository) BulkCreate(ctx context.Context, todos []*Todo) error {
-	tx, err := r.db.BeginTxx(ctx, nil)
+// Stream calls fn for every todo matching filter, newest first, without
+// loading them all into memory. It stops at the first error returned by fn.
+func (r *Repository) Stream(ctx context.Context, filter TodoFilter, fn func(*Todo) error) error {
+	where, args := filter.where()
+
+	rows, err := r.db.QueryxContext(ctx, "SELECT * FROM todos"+where+" ORDER BY created_at DESC", args...)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if rerr := tx.Rollback(); rerr != nil {
-			log.Printf("Rollback failed: %v", rerr)
+	defer rows.Close()
+
+	for rows.Next() {
+		var todo Todo
+		if err := rows.StructScan(&todo); err != nil {
+			return err
 		}
-	}()
+		if err := fn(&todo); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// bulkChunkSize is the most rows a bulk path reads or writes with one
+// statement, which keeps statements well below MySQL's placeholder limit.
+const bulkChunkSize = 500
+
+// BulkCreate inserts todos as part of op. Concurrent creates in a list
+// that is empty can deadlock on its gap lock, so the transaction is retried,
+// each time with the todos as they were passed in, since inserting them sets
+// their IDs and positions.
+func (r *Repository) BulkCreate(ctx context.Context, op *Operation, todos []*Todo) error {
+	originals := make([]Todo, len(todos))
+	for i, todo := range todos {
+		originals[i] = *todo
+	}
+	return r.withRetryTx(ctx, "bulk_create", func(tx *sqlx.Tx) error {
+		for i, todo := range todos {
+			*todo = originals[i]
+		}
+		return createTodos(ctx, tx, op, todos)
+	})
+}
 
-	query := `INSERT INTO todos (title, description, due_date, completed, created_at, updated_at) 
-			  VALUES (?, ?, ?, ?, ?, ?)`
+// createTodos inserts new todos as part of op inside tx and records their
+// creation.
+func createTodos(ctx context.Context, tx *sqlx.Tx, op *Operation, todos []*Todo) error {
+	if err := insertOperation(ctx, tx, op); err != nil {
+		return err
+	}
+	checks, err := enforceWorkflows(ctx, tx, nil, todos)
+	if err != nil {
+		return err
+	}
+	if err := insertTodos(ctx, tx, todos); err != nil {
+		return err
+	}
+	if err := checkWIP(ctx, tx, checks); err != nil {
+		return err
+	}
 
+	events := make([]TodoEvent, 0, len(todos))
 	for _, todo := range todos {
-		result, err := tx.ExecContext(ctx, query,
-			todo.Title, todo.Description, todo.DueDate, todo.Completed, todo.CreatedAt, todo.UpdatedAt)
+		events = append(events, newTodoEvent(ctx, op, EventCreated, nil, todo))
+	}
+	return insertEvents(ctx, tx, events)
+}
+
+// BulkUpdate applies inputs to the todos they name and returns the updated
+// todos in input order. All rows are read and locked up front, then written
+// with set-based UPDATE statements of at most bulkChunkSize rows, so each
+// input is applied to the row as it is when the transaction commits. Status
+// changes must follow the workflows of the todos' lists.
+func (r *Repository) BulkUpdate(ctx context.Context, op *Operation, inputs []UpdateTodoInput) ([]*Todo, error) {
+	// Lock in ID order so that concurrent bulk updates over overlapping
+	// todos wait for each other instead of deadlocking.
+	ids := make([]int64, len(inputs))
+	for i, input := range inputs {
+		ids[i] = input.ID
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var updated []*Todo
+	err := r.withRetryTx(ctx, "bulk_update", func(tx *sqlx.Tx) error {
+		updated = make([]*Todo, 0, len(inputs))
+		if err := insertOperation(ctx, tx, op); err != nil {
+			return err
+		}
+		current, err := getManyForUpdate(ctx, tx, ids)
 		if err != nil {
-			if isDuplicateError(err) {
-				return ErrDuplicateTitle
-			}
 			return err
 		}
-		id, err := result.LastInsertId()
+
+		befores := make([]*Todo, 0, len(inputs))
+		for _, input := range inputs {
+			before, ok := current[input.ID]
+			if !ok {
+				return ErrNotFound
+			}
+			befores = append(befores, before)
+			updated = append(updated, input.apply(before, op.CreatedAt))
+		}
+		checks, err := enforceWorkflows(ctx, tx, befores, updated)
 		if err != nil {
-			return fmt.Errorf("failed to get last insert ID: %w", err)
+			return err
 		}
 
-		todo.ID = id
+		events := make([]TodoEvent, 0, len(inputs))
+		for i, after := range updated {
+			stampCompletion(befores[i], after, op.Actor, op.CreatedAt)
+			events = append(events, newTodoEvent(ctx, op, EventUpdated, befores[i], after))
+		}
+		if err := updateTodos(ctx, tx, updated, op.CreatedAt); err != nil {
+			return err
+		}
+		if err := checkWIP(ctx, tx, checks); err != nil {
+			return err
+		}
+		return insertEvents(ctx, tx, events)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return updated, nil
+}
 
-	return tx.Commit()
+// BulkDelete removes the todos with the given IDs and returns them as they
+// were immediately before deletion.
+func (r *Repository) BulkDelete(ctx context.Context, op *Operation, ids []int64) ([]*Todo, error) {
+	deleted := make([]*Todo, 0, len(ids))
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := insertOperation(ctx, tx, op); err != nil {
+			return err
+		}
+
+		events := make([]TodoEvent, 0, len(ids))
+		for _, id := range ids {
+			before, err := getForUpdate(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+
+			if _, err := tx.ExecContext(ctx, "DELETE FROM todos WHERE id = ?", id); err != nil {
+				return err
+			}
+			deleted = append(deleted, before)
+			events = append(events, newTodoEvent(ctx, op, EventDeleted, before, nil))
+		}
+
+		return insertEvents(ctx, tx, events)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
 }
 
-func (r *Repository) BulkUpdate(ctx context.Context, todos []*Todo) error {
-	tx, err := r.db.BeginTxx(ctx, nil)
+const insertTodoQuery = `INSERT INTO todos (id, parent_id, list_id, uid, title, description, due_date, completed, status,
+	 position, completed_at, completed_by, priority, estimate_minutes, logged_minutes, tags, external_id, source,
+	 start_date, snoozed_until, created_at, updated_at)
+	 VALUES (:id, :parent_id, :list_id, :uid, :title, :description, :due_date, :completed, :status,
+	 :position, :completed_at, :completed_by, :priority, :estimate_minutes, :logged_minutes, :tags, :external_id, :source,
+	 :start_date, :snoozed_until, :created_at, :updated_at)`
+
+// insertTodo inserts todo inside tx and sets its ID. A todo that already has
+// an ID, such as one restored by an undo, keeps it.
+func insertTodo(ctx context.Context, tx *sqlx.Tx, todo *Todo) error {
+	stampCompletion(nil, todo, ActorFromContext(ctx), todo.UpdatedAt)
+	if err := assignPositions(ctx, tx, []*Todo{todo}); err != nil {
+		return err
+	}
+	result, err := tx.NamedExecContext(ctx, insertTodoQuery, todo)
 	if err != nil {
+		if isDuplicateError(err) {
+			return ErrDuplicateTitle
+		}
 		return err
 	}
-	defer func() {
-		if rerr := tx.Rollback(); rerr != nil {
-			log.Printf("Rollback failed: %v", rerr)
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	todo.ID = id
+	return nil
+}
+
+// insertTodos inserts new todos inside tx with multi-row INSERT statements
+// and sets their IDs. A todo whose ParentID points at the ID of a todo
+// earlier in the slice that is not inserted yet starts a new statement, so
+// that the parent's ID is known by the time the todo is written.
+func insertTodos(ctx context.Context, tx *sqlx.Tx, todos []*Todo) error {
+	if err := assignPositions(ctx, tx, todos); err != nil {
+		return err
+	}
+	start := 0
+	for i, todo := range todos {
+		waitsForParent := todo.ParentID != nil && *todo.ParentID == 0
+		if i > start && (i-start == bulkChunkSize || waitsForParent) {
+			if err := insertTodoChunk(ctx, tx, todos[start:i]); err != nil {
+				return err
+			}
+			start = i
 		}
-	}()
+	}
+	if start < len(todos) {
+		return insertTodoChunk(ctx, tx, todos[start:])
+	}
+	return nil
+}
+
+// insertTodoChunk inserts todos with one statement. LAST_INSERT_ID only
+// identifies the first row, and auto-increment values of one statement need
+// not be consecutive, so the IDs are read back by UID.
+func insertTodoChunk(ctx context.Context, tx *sqlx.Tx, todos []*Todo) error {
+	actor := ActorFromContext(ctx)
+	for _, todo := range todos {
+		stampCompletion(nil, todo, actor, todo.UpdatedAt)
+	}
+	if _, err := tx.NamedExecContext(ctx, insertTodoQuery, todos); err != nil {
+		if isDuplicateError(err) {
+			return ErrDuplicateTitle
+		}
+		return err
+	}
 
-	query := `UPDATE todos SET title=?, description=?, due_date=?, completed=?, updated_at=? WHERE id=?`
+	uids := make([]string, len(todos))
+	for i, todo := range todos {
+		uids[i] = todo.UID
+	}
+	query, args, err := sqlx.In("SELECT id, uid FROM todos WHERE uid IN (?)", uids)
+	if err != nil {
+		return err
+	}
+	var rows []struct {
+		UID string `db:"uid"`
+		ID  int64  `db:"id"`
+	}
+	if err := tx.SelectContext(ctx, &rows, tx.Rebind(query), args...); err != nil {
+		return err
+	}
 
+	ids := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		ids[row.UID] = row.ID
+	}
 	for _, todo := range todos {
-		result, err := tx.ExecContext(ctx, query,
-			todo.Title, todo.Description, todo.DueDate, todo.Completed, todo.UpdatedAt, todo.ID)
+		id, ok := ids[todo.UID]
+		if !ok {
+			return fmt.Errorf("inserted todo %q not found", todo.UID)
+		}
+		todo.ID = id
+	}
+	return nil
+}
+
+// updateTodo writes every mutable field of todo, which replaces before,
+// inside tx.
+func updateTodo(ctx context.Context, tx *sqlx.Tx, before, todo *Todo) error {
+	stampCompletion(before, todo, ActorFromContext(ctx), todo.UpdatedAt)
+	_, err := tx.NamedExecContext(ctx,
+		`UPDATE todos SET title = :title, description = :description, due_date = :due_date,
+		 completed = :completed, status = :status, position = :position, completed_at = :completed_at, completed_by = :completed_by,
+		 priority = :priority, estimate_minutes = :estimate_minutes, tags = :tags,
+		 start_date = :start_date, snoozed_until = :snoozed_until, updated_at = :updated_at
+		 WHERE id = :id`, todo)
+	if err != nil && isDuplicateError(err) {
+		return ErrDuplicateTitle
+	}
+	return err
+}
+
+// getForUpdate reads a todo inside tx and locks its row until the
+// transaction ends.
+func getForUpdate(ctx context.Context, tx *sqlx.Tx, id int64) (*Todo, error) {
+	var todo Todo
+	err := tx.GetContext(ctx, &todo, "SELECT * FROM todos WHERE id = ? FOR UPDATE", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// getManyForUpdate reads the todos with the given IDs inside tx, keyed by
+// ID, and locks their rows until the transaction ends. Missing IDs are
+// absent from the result.
+func getManyForUpdate(ctx context.Context, tx *sqlx.Tx, ids []int64) (map[int64]*Todo, error) {
+	todos := make(map[int64]*Todo, len(ids))
+	for start := 0; start < len(ids); start += bulkChunkSize {
+		query, args, err := sqlx.In("SELECT * FROM todos WHERE id IN (?) ORDER BY id FOR UPDATE", ids[start:min(start+bulkChunkSize, len(ids))])
 		if err != nil {
+			return nil, err
+		}
+		var rows []*Todo
+		if err := tx.SelectContext(ctx, &rows, tx.Rebind(query), args...); err != nil {
+			return nil, err
+		}
+		for _, todo := range rows {
+			todos[todo.ID] = todo
+		}
+	}
+	return todos, nil
+}
+
+// updateTodos writes the mutable fields of todos inside tx with one UPDATE
+// per bulkChunkSize rows, selecting each row's values with CASE id.
+func updateTodos(ctx context.Context, tx *sqlx.Tx, todos []*Todo, now time.Time) error {
+	columns := []struct {
+		name  string
+		value func(*Todo) any
+	}{
+		{"title", func(t *Todo) any { return t.Title }},
+		{"description", func(t *Todo) any { return t.Description }},
+		{"due_date", func(t *Todo) any { return t.DueDate }},
+		{"completed", func(t *Todo) any { return t.Completed }},
+		{"status", func(t *Todo) any { return t.Status }},
+		{"completed_at", func(t *Todo) any { return t.CompletedAt }},
+		{"completed_by", func(t *Todo) any { return t.CompletedBy }},
+		{"priority", func(t *Todo) any { return t.Priority }},
+		{"estimate_minutes", func(t *Todo) any { return t.EstimateMinutes }},
+		{"tags", func(t *Todo) any { return t.Tags }},
+		{"start_date", func(t *Todo) any { return t.StartDate }},
+		{"snoozed_until", func(t *Todo) any { return t.SnoozedUntil }},
+	}
+
+	for start := 0; start < len(todos); start += bulkChunkSize {
+		chunk := todos[start:min(start+bulkChunkSize, len(todos))]
+
+		var (
+			query strings.Builder
+			args  []any
+		)
+		query.WriteString("UPDATE todos SET ")
+		for _, column := range columns {
+			query.WriteString(column.name + " = CASE id")
+			for _, todo := range chunk {
+				query.WriteString(" WHEN ? THEN ?")
+				args = append(args, todo.ID, column.value(todo))
+			}
+			query.WriteString(" END, ")
+		}
+		query.WriteString("updated_at = ? WHERE id IN (?" + strings.Repeat(", ?", len(chunk)-1) + ")")
+		args = append(args, now)
+		for _, todo := range chunk {
+			args = append(args, todo.ID)
+		}
+
+		if _, err := tx.ExecContext(ctx, query.String(), args...); err != nil {
 			if isDuplicateError(err) {
 				return ErrDuplicateTitle
 			}
 			return err
 		}
-		rows, err := result.RowsAffected()
-		if err != nil {
-			return fmt.Errorf("failed to get rows affected: %w", err)
-		}
-		if rows == 0 {
-			return ErrNotFound
-		}
 	}
-
-	return tx.Commit()
+	return nil
 }
 
 func isDuplicateError(err error) bool {
@@ -121,3 +589,11 @@ func isDuplicateError(err error) bool {
 	}
 	return strings.Contains(err.Error(), "Duplicate entry")
 }
+
+// isRetryableError reports whether err aborted a transaction that can simply
+// be run again: a deadlock (1213) or a lock wait timeout (1205), however
+// deeply wrapped.
+func isRetryableError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && (mysqlErr.Number == 1213 || mysqlErr.Number == 1205)
+}
@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// The benchmarks in this file, and the tests that need a database, write
+// to, and clean up, the database named by TODOX_BENCH_DB on the server
+// configured by the other DB_* variables, and are skipped without it. So that they never touch real data, its name must
+// end in benchDBSuffix. Run them against a migrated, disposable database:
+//
+//	DB_NAME=todox_bench go run ./cmd/migrate
+//	TODOX_BENCH_DB=todox_bench go test -run '^$' -bench . ./internal
+//	TODOX_BENCH_DB=todox_bench go test ./internal
+
+const benchActor = "bench"
+
+// benchDBSuffix is the suffix a database must have to be benchmarked.
+const benchDBSuffix = "_bench"
+
+func benchRepository(b testing.TB) *Repository {
+	b.Helper()
+	name := os.Getenv("TODOX_BENCH_DB")
+	if name == "" {
+		b.Skip("set TODOX_BENCH_DB to a disposable database to benchmark against it")
+	}
+	if !strings.HasSuffix(name, benchDBSuffix) {
+		b.Fatalf("TODOX_BENCH_DB must name a dedicated database ending in %q, got %q", benchDBSuffix, name)
+	}
+	b.Setenv("DB_NAME", name)
+	db, err := NewDB()
+	if err != nil {
+		b.Fatal(err)
+	}
+	var current string
+	if err := db.Get(&current, "SELECT DATABASE()"); err != nil || current != name {
+		db.Close()
+		b.Fatalf("connected to database %q instead of %q: %v", current, name, err)
+	}
+	repo := NewRepository(db)
+	b.Cleanup(func() {
+		cleanupBench(b, db)
+		db.Close()
+	})
+	return repo
+}
+
+func cleanupBench(b testing.TB, db *sqlx.DB) {
+	b.Helper()
+	for _, query := range []string{
+		"DELETE FROM todos WHERE title LIKE 'bench %'",
+		"DELETE FROM todo_events WHERE actor = '" + benchActor + "'",
+		"DELETE FROM operations WHERE actor = '" + benchActor + "'",
+		"DELETE FROM time_entries WHERE actor = '" + benchActor + "'",
+	} {
+		if _, err := db.Exec(query); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchTodos(run, n int) []*Todo {
+	now := time.Now()
+	todos := make([]*Todo, n)
+	for i := range todos {
+		todos[i] = newTodo(CreateTodoInput{Title: fmt.Sprintf("bench %d-%d", run, i)}, now)
+	}
+	return todos
+}
+
+func benchOperation(kind string) *Operation {
+	now := time.Now()
+	return &Operation{ID: RandomID(), Kind: kind, Actor: benchActor, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+}
+
+// perRowCreate is the previous BulkCreate, one INSERT per todo, kept as the
+// baseline.
+func perRowCreate(ctx context.Context, r *Repository, op *Operation, todos []*Todo) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := insertOperation(ctx, tx, op); err != nil {
+			return err
+		}
+		events := make([]TodoEvent, 0, len(todos))
+		for _, todo := range todos {
+			if err := insertTodo(ctx, tx, todo); err != nil {
+				return err
+			}
+			events = append(events, newTodoEvent(ctx, op, EventCreated, nil, todo))
+		}
+		return insertEvents(ctx, tx, events)
+	})
+}
+
+// perRowUpdate is the previous BulkUpdate, a read outside the transaction,
+// then a locking read and an UPDATE per todo, kept as the baseline.
+func perRowUpdate(ctx context.Context, r *Repository, op *Operation, inputs []UpdateTodoInput) error {
+	todos := make([]*Todo, 0, len(inputs))
+	for _, input := range inputs {
+		todo, err := r.GetByID(ctx, input.ID)
+		if err != nil {
+			return err
+		}
+		todos = append(todos, input.apply(todo, op.CreatedAt))
+	}
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := insertOperation(ctx, tx, op); err != nil {
+			return err
+		}
+		events := make([]TodoEvent, 0, len(todos))
+		for _, todo := range todos {
+			before, err := getForUpdate(ctx, tx, todo.ID)
+			if err != nil {
+				return err
+			}
+			if err := updateTodo(ctx, tx, before, todo); err != nil {
+				return err
+			}
+			events = append(events, newTodoEvent(ctx, op, EventUpdated, before, todo))
+		}
+		return insertEvents(ctx, tx, events)
+	})
+}
+
+func BenchmarkBulkCreate(b *testing.B) {
+	repo := benchRepository(b)
+	ctx := WithActor(context.Background(), benchActor)
+
+	create := map[string]func(context.Context, *Repository, *Operation, []*Todo) error{
+		"per-row": perRowCreate,
+		"multi-row": func(ctx context.Context, r *Repository, op *Operation, todos []*Todo) error {
+			return r.BulkCreate(ctx, op, todos)
+		},
+	}
+	for _, n := range []int{100, 1000} {
+		for _, name := range []string{"per-row", "multi-row"} {
+			b.Run(fmt.Sprintf("%s/%d", name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					todos := benchTodos(i, n)
+					b.StartTimer()
+					if err := create[name](ctx, repo, benchOperation(OperationCreate), todos); err != nil {
+						b.Fatal(err)
+					}
+					b.StopTimer()
+					cleanupBench(b, repo.db)
+					b.StartTimer()
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkBulkUpdate(b *testing.B) {
+	repo := benchRepository(b)
+	ctx := WithActor(context.Background(), benchActor)
+
+	update := map[string]func(context.Context, *Repository, *Operation, []UpdateTodoInput) error{
+		"per-row": perRowUpdate,
+		"set-based": func(ctx context.Context, r *Repository, op *Operation, inputs []UpdateTodoInput) error {
+			_, err := r.BulkUpdate(ctx, op, inputs)
+			return err
+		},
+	}
+	for _, n := range []int{100, 1000} {
+		todos := benchTodos(-1, n)
+		if err := repo.BulkCreate(ctx, benchOperation(OperationCreate), todos); err != nil {
+			b.Fatal(err)
+		}
+
+		for _, name := range []string{"per-row", "set-based"} {
+			b.Run(fmt.Sprintf("%s/%d", name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					completed := i%2 == 0
+					inputs := make([]UpdateTodoInput, n)
+					for j, todo := range todos {
+						inputs[j] = UpdateTodoInput{ID: todo.ID, Completed: &completed}
+					}
+					if err := update[name](ctx, repo, benchOperation(OperationUpdate), inputs); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+		cleanupBench(b, repo.db)
+	}
+}
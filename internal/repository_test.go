@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		err  error
+		name string
+		want bool
+	}{
+		{name: "deadlock", err: &mysql.MySQLError{Number: 1213}, want: true},
+		{name: "lock wait timeout", err: &mysql.MySQLError{Number: 1205}, want: true},
+		{name: "wrapped deadlock", err: fmt.Errorf("failed to lock todo: %w", &mysql.MySQLError{Number: 1213}), want: true},
+		{name: "duplicate entry", err: &mysql.MySQLError{Number: 1062}, want: false},
+		{name: "not found", err: ErrNotFound, want: false},
+		{name: "other error", err: errors.New("Deadlock found when trying to get lock"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isRetryableError(tt.err))
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt := 1; attempt < txMaxAttempts; attempt++ {
+		ceiling := txRetryBaseDelay << (attempt - 1)
+		for range 100 {
+			d := retryDelay(attempt)
+			assert.GreaterOrEqual(t, d, ceiling/2)
+			assert.Less(t, d, ceiling)
+		}
+	}
+}
+
+func TestRetryTx(t *testing.T) {
+	t.Run("retries a wrapped deadlock", func(t *testing.T) {
+		attempts := 0
+		err := retryTx(context.Background(), "test", func() error {
+			attempts++
+			if attempts == 1 {
+				return fmt.Errorf("failed to lock todo: %w", &mysql.MySQLError{Number: 1213})
+			}
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+	})
+	t.Run("gives up after txMaxAttempts", func(t *testing.T) {
+		attempts := 0
+		err := retryTx(context.Background(), "test", func() error {
+			attempts++
+			return fmt.Errorf("wrapped: %w", &mysql.MySQLError{Number: 1205})
+		})
+
+		assert.Error(t, err)
+		assert.Equal(t, txMaxAttempts, attempts)
+	})
+	t.Run("does not retry other errors", func(t *testing.T) {
+		attempts := 0
+		err := retryTx(context.Background(), "test", func() error {
+			attempts++
+			return ErrNotFound
+		})
+
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Equal(t, 1, attempts)
+	})
+}
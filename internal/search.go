@@ -0,0 +1,405 @@
+package internal
+
+import (
+	"context"
+	"html"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Search backends, chosen with SEARCH_BACKEND. The full-text backend needs
+// the FULLTEXT index on title and description; the LIKE backend works on any
+// MySQL-compatible database but scans every row.
+const (
+	SearchFullText = "fulltext"
+	SearchLike     = "like"
+)
+
+// snippetLength is the length in bytes of the description excerpt returned
+// with a search result, before ellipses are added.
+const snippetLength = 160
+
+// searchTerm is one word or quoted phrase of a search query. Required terms
+// were written +word, excluded terms -word and prefix terms word*. Phrases
+// hold their words separated by single spaces.
+type searchTerm struct {
+	Text     string
+	Phrase   bool
+	Prefix   bool
+	Required bool
+	Excluded bool
+}
+
+// parseSearchQuery splits q into terms using MySQL's boolean full-text
+// syntax: +required, -excluded, prefix* and "quoted phrases". Characters that
+// are neither letters nor digits separate words, so a word like e-mail is
+// searched as the phrase "e mail". At least one term must not be excluded.
+func parseSearchQuery(q string) ([]searchTerm, error) {
+	var terms []searchTerm
+	for q = strings.TrimSpace(q); q != ""; q = strings.TrimSpace(q) {
+		var term searchTerm
+		switch q[0] {
+		case '+':
+			term.Required = true
+			q = q[1:]
+		case '-':
+			term.Excluded = true
+			q = q[1:]
+		}
+
+		var raw string
+		if strings.HasPrefix(q, `"`) {
+			// An unterminated phrase runs to the end of the query.
+			end := strings.IndexByte(q[1:], '"')
+			if end < 0 {
+				raw, q = q[1:], ""
+			} else {
+				raw, q = q[1:end+1], q[end+2:]
+			}
+			term.Phrase = true
+		} else {
+			end := strings.IndexFunc(q, unicode.IsSpace)
+			if end < 0 {
+				end = len(q)
+			}
+			raw, q = q[:end], q[end:]
+			term.Prefix = strings.HasSuffix(raw, "*")
+		}
+
+		words := strings.FieldsFunc(raw, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+		})
+		if len(words) == 0 {
+			continue
+		}
+		if len(words) > 1 {
+			term.Phrase = true
+		}
+		if term.Phrase {
+			term.Prefix = false
+		}
+		term.Text = strings.Join(words, " ")
+		terms = append(terms, term)
+	}
+
+	for _, term := range terms {
+		if !term.Excluded {
+			return terms, nil
+		}
+	}
+	return nil, ErrInvalidSearch
+}
+
+// SearchResult is a todo matched by a search, with its relevance score and
+// the matches highlighted. Higher scores rank first; scores are only
+// comparable within one search.
+type SearchResult struct {
+	Todo
+	Highlights SearchHighlights `json:"highlights" db:"-"`
+	Score      float64          `json:"score" db:"score"`
+}
+
+// SearchHighlights holds the title and an excerpt of the description with
+// every match wrapped in <mark> tags. The rest of the text is HTML-escaped.
+// Description is empty unless it matched.
+type SearchHighlights struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+// Searcher runs a parsed search query over the todos matching filter and
+// returns one page of them, most relevant first, with the total number of
+// matches. filter.Query is ignored.
+type Searcher interface {
+	Search(ctx context.Context, terms []searchTerm, filter TodoFilter, page, limit int) ([]*SearchResult, int64, error)
+}
+
+func newSearcher(db *sqlx.DB, backend string) Searcher {
+	switch backend {
+	case SearchLike:
+		return likeSearcher{db: db}
+	case SearchFullText:
+	default:
+		slog.Warn("Unknown search backend, using full-text search", "backend", backend)
+	}
+	return fullTextSearcher{db: db}
+}
+
+func (r *Repository) Search(ctx context.Context, terms []searchTerm, filter TodoFilter, page, limit int) ([]*SearchResult, int64, error) {
+	filter.Query = ""
+	return r.searcher.Search(ctx, terms, filter, page, limit)
+}
+
+// searchPage returns one page of the todos matching conds, which include the
+// filter's, ordered by the score expression. scoreArgs and args are the
+// arguments of score and conds.
+func searchPage(ctx context.Context, db *sqlx.DB, score string, scoreArgs []any, conds []string, args []any, page, limit int) ([]*SearchResult, int64, error) {
+	where := " WHERE " + strings.Join(conds, " AND ")
+
+	var total int64
+	if err := db.GetContext(ctx, &total, "SELECT COUNT(*) FROM todos"+where, args...); err != nil {
+		return nil, 0, err
+	}
+
+	results := []*SearchResult{}
+	query := "SELECT todos.*, " + score + " AS score FROM todos" + where + " ORDER BY score DESC, id DESC LIMIT ? OFFSET ?"
+	queryArgs := append(append(append([]any{}, scoreArgs...), args...), limit, (page-1)*limit)
+	if err := db.SelectContext(ctx, &results, query, queryArgs...); err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
+
+// fullTextSearcher searches with MATCH ... AGAINST in boolean mode, ranked by
+// InnoDB's relevance score. Words shorter than innodb_ft_min_token_size and
+// stopwords are not indexed and never match.
+type fullTextSearcher struct {
+	db *sqlx.DB
+}
+
+const fullTextMatch = "MATCH(title, description) AGAINST (? IN BOOLEAN MODE)"
+
+func (s fullTextSearcher) Search(ctx context.Context, terms []searchTerm, filter TodoFilter, page, limit int) ([]*SearchResult, int64, error) {
+	against := booleanQuery(terms)
+	conds, args := filter.conds()
+	conds = append([]string{fullTextMatch}, conds...)
+	args = append([]any{against}, args...)
+	return searchPage(ctx, s.db, fullTextMatch, []any{against}, conds, args, page, limit)
+}
+
+// booleanQuery rebuilds terms as a MySQL boolean-mode search string. Terms
+// are rebuilt rather than passed through so that stray operators in the
+// user's query cannot make it invalid.
+func booleanQuery(terms []searchTerm) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		var b strings.Builder
+		switch {
+		case term.Required:
+			b.WriteByte('+')
+		case term.Excluded:
+			b.WriteByte('-')
+		}
+		if term.Phrase {
+			b.WriteString(`"` + term.Text + `"`)
+		} else {
+			b.WriteString(term.Text)
+		}
+		if term.Prefix {
+			b.WriteByte('*')
+		}
+		parts[i] = b.String()
+	}
+	return strings.Join(parts, " ")
+}
+
+// likeSearcher is the fallback for databases without full-text indexes. It
+// matches terms as substrings with LIKE and follows boolean mode's rules: all
+// required terms must match, no excluded term may, and without required
+// terms at least one of the others must. Each matching term scores 2 in the
+// title and 1 in the description.
+type likeSearcher struct {
+	db *sqlx.DB
+}
+
+func (s likeSearcher) Search(ctx context.Context, terms []searchTerm, filter TodoFilter, page, limit int) ([]*SearchResult, int64, error) {
+	score, scoreArgs, conds, args := likeQuery(terms)
+	filterConds, filterArgs := filter.conds()
+	return searchPage(ctx, s.db, score, scoreArgs, append(conds, filterConds...), append(args, filterArgs...), page, limit)
+}
+
+// likeQuery returns the score expression and conditions of a LIKE search for
+// terms, each with its arguments.
+func likeQuery(terms []searchTerm) (string, []any, []string, []any) {
+	const match = "(title LIKE ? OR COALESCE(description, '') LIKE ?)"
+	var (
+		scores          []string
+		scoreArgs, args []any
+		conds, optional []string
+		optionalArgs    []any
+		hasRequired     bool
+	)
+	for _, term := range terms {
+		pattern := "%" + escapeLike(term.Text) + "%"
+		switch {
+		case term.Excluded:
+			conds = append(conds, "NOT "+match)
+			args = append(args, pattern, pattern)
+			continue
+		case term.Required:
+			hasRequired = true
+			conds = append(conds, match)
+			args = append(args, pattern, pattern)
+		default:
+			optional = append(optional, match)
+			optionalArgs = append(optionalArgs, pattern, pattern)
+		}
+		scores = append(scores, "(title LIKE ?) * 2 + (COALESCE(description, '') LIKE ?)")
+		scoreArgs = append(scoreArgs, pattern, pattern)
+	}
+	if !hasRequired && len(optional) > 0 {
+		conds = append(conds, "("+strings.Join(optional, " OR ")+")")
+		args = append(args, optionalArgs...)
+	}
+	return strings.Join(scores, " + "), scoreArgs, conds, args
+}
+
+func (s *Service) Search(ctx context.Context, q string, filter TodoFilter, page, limit int) ([]*SearchResult, int64, error) {
+	page, limit, err := normalizePage(page, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	terms, err := parseSearchQuery(q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	results, total, err := s.repo.Search(ctx, terms, visible(ctx, filter, RoleViewer), page, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	re := highlightPattern(terms)
+	for _, result := range results {
+		result.Highlights = SearchHighlights{
+			Title:       highlight(result.Title, re),
+			Description: snippet(result.Description, re, snippetLength),
+		}
+	}
+	return results, total, nil
+}
+
+// Word characters for highlighting. RE2's \b and \w only know ASCII, so
+// they would miss terms with accents or in other scripts, which MySQL does
+// match.
+const (
+	highlightWord    = `[\p{L}\p{N}_]`
+	highlightNonWord = `[^\p{L}\p{N}_]`
+)
+
+// highlightPattern returns a case-insensitive pattern matching the terms that
+// are not excluded, as whole words unless they are prefixes. The first group
+// is the term; the word boundaries around it are matched too.
+func highlightPattern(terms []searchTerm) *regexp.Regexp {
+	var alts []string
+	for _, term := range terms {
+		if term.Excluded {
+			continue
+		}
+		words := strings.Split(term.Text, " ")
+		for i, word := range words {
+			words[i] = regexp.QuoteMeta(word)
+		}
+		alt := strings.Join(words, highlightNonWord+"+")
+		if term.Prefix {
+			alt += highlightWord + "*"
+		}
+		alts = append(alts, alt)
+	}
+	return regexp.MustCompile(`(?i)(?:^|` + highlightNonWord + `)(` + strings.Join(alts, "|") + `)(?:` + highlightNonWord + `|$)`)
+}
+
+// highlightMatches returns the start and end of every term re, a pattern
+// from highlightPattern, matches in text. Each search resumes right after
+// the previous term, since the boundary matched behind it may be the one in
+// front of the next.
+func highlightMatches(text string, re *regexp.Regexp) [][2]int {
+	var matches [][2]int
+	for pos := 0; pos < len(text); {
+		loc := re.FindStringSubmatchIndex(text[pos:])
+		if loc == nil || loc[2] == loc[3] {
+			break
+		}
+		matches = append(matches, [2]int{pos + loc[2], pos + loc[3]})
+		pos += loc[3]
+	}
+	return matches
+}
+
+// highlight HTML-escapes text and wraps every match of re in <mark> tags.
+func highlight(text string, re *regexp.Regexp) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range highlightMatches(text, re) {
+		b.WriteString(html.EscapeString(text[last:loc[0]]))
+		b.WriteString("<mark>" + html.EscapeString(text[loc[0]:loc[1]]) + "</mark>")
+		last = loc[1]
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
+
+// snippet returns an excerpt of about length bytes of text around the first
+// match of re, highlighted, with an ellipsis where text was cut. It returns
+// "" if nothing matches.
+func snippet(text string, re *regexp.Regexp, length int) string {
+	matches := highlightMatches(text, re)
+	if len(matches) == 0 {
+		return ""
+	}
+	loc := matches[0]
+
+	// Start a third of the way before the match and cut at word boundaries
+	// when there is one nearby.
+	start := max(0, loc[0]-length/3)
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	if start > 0 {
+		if i := strings.IndexFunc(text[start:loc[0]], unicode.IsSpace); i >= 0 {
+			start += i + 1
+		}
+	}
+	end := min(len(text), max(start+length, loc[1]))
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	if end < len(text) {
+		if i := strings.LastIndexFunc(text[loc[1]:end], unicode.IsSpace); i >= 0 {
+			end = loc[1] + i
+		}
+	}
+
+	excerpt := highlight(strings.TrimSpace(text[start:end]), re)
+	if start > 0 {
+		excerpt = "…" + excerpt
+	}
+	if end < len(text) {
+		excerpt += "…"
+	}
+	return excerpt
+}
+
+// SearchTodos serves GET /v1/todos/search?q=, taking the same filters and
+// pagination as ListTodos.
+func (h *Handler) SearchTodos(c *gin.Context) {
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	filter, ok := parseTodoFilter(c)
+	if !ok {
+		return
+	}
+
+	results, total, err := h.service.Search(c.Request.Context(), filter.Query, filter, page, limit)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": results,
+		"meta": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    []searchTerm
+		wantErr error
+	}{
+		{
+			name:  "words",
+			query: "buy  milk",
+			want:  []searchTerm{{Text: "buy"}, {Text: "milk"}},
+		},
+		{
+			name:  "operators",
+			query: "+milk -oat choc*",
+			want: []searchTerm{
+				{Text: "milk", Required: true},
+				{Text: "oat", Excluded: true},
+				{Text: "choc", Prefix: true},
+			},
+		},
+		{
+			name:  "phrase",
+			query: `+"quarterly   report" draft`,
+			want:  []searchTerm{{Text: "quarterly report", Phrase: true, Required: true}, {Text: "draft"}},
+		},
+		{
+			name:  "unterminated phrase",
+			query: `"quarterly report`,
+			want:  []searchTerm{{Text: "quarterly report", Phrase: true}},
+		},
+		{
+			name:  "punctuation splits words",
+			query: "e-mail* (urgent)",
+			want:  []searchTerm{{Text: "e mail", Phrase: true}, {Text: "urgent"}},
+		},
+		{
+			name:    "empty",
+			query:   "   ",
+			wantErr: ErrInvalidSearch,
+		},
+		{
+			name:    "only operators",
+			query:   `+ - * ""`,
+			wantErr: ErrInvalidSearch,
+		},
+		{
+			name:    "only excluded",
+			query:   "-milk",
+			wantErr: ErrInvalidSearch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSearchQuery(tt.query)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBooleanQuery(t *testing.T) {
+	terms, err := parseSearchQuery(`+"quarterly report" -draft fin* <>~@x`)
+	assert.NoError(t, err)
+	assert.Equal(t, `+"quarterly report" -draft fin* x`, booleanQuery(terms))
+}
+
+func TestLikeQuery(t *testing.T) {
+	t.Run("required terms", func(t *testing.T) {
+		terms, _ := parseSearchQuery("+milk -oat 100%")
+		score, scoreArgs, conds, args := likeQuery(terms)
+
+		assert.Equal(t, "(title LIKE ?) * 2 + (COALESCE(description, '') LIKE ?) + (title LIKE ?) * 2 + (COALESCE(description, '') LIKE ?)", score)
+		assert.Equal(t, []any{"%milk%", "%milk%", "%100%", "%100%"}, scoreArgs)
+		assert.Equal(t, []string{
+			"(title LIKE ? OR COALESCE(description, '') LIKE ?)",
+			"NOT (title LIKE ? OR COALESCE(description, '') LIKE ?)",
+		}, conds)
+		assert.Equal(t, []any{"%milk%", "%milk%", "%oat%", "%oat%"}, args)
+	})
+
+	t.Run("optional terms", func(t *testing.T) {
+		terms, _ := parseSearchQuery("milk oat")
+		_, _, conds, args := likeQuery(terms)
+
+		assert.Equal(t, []string{
+			"((title LIKE ? OR COALESCE(description, '') LIKE ?) OR (title LIKE ? OR COALESCE(description, '') LIKE ?))",
+		}, conds)
+		assert.Equal(t, []any{"%milk%", "%milk%", "%oat%", "%oat%"}, args)
+	})
+}
+
+func TestHighlight(t *testing.T) {
+	terms, _ := parseSearchQuery(`milk choc* "oat drink" -milkshake`)
+	re := highlightPattern(terms)
+
+	assert.Equal(t, "Buy <mark>Milk</mark> &amp; <mark>chocolate</mark>, not milkshake", highlight("Buy Milk & chocolate, not milkshake", re))
+	assert.Equal(t, "<mark>oat  drink</mark>", highlight("oat  drink", re))
+	assert.Equal(t, "Nothing &lt;here&gt;", highlight("Nothing <here>", re))
+	assert.Equal(t, "<mark>milk</mark> <mark>milk</mark>", highlight("milk milk", re))
+	assert.Equal(t, "milké and <mark>chocolatière</mark>", highlight("milké and chocolatière", re))
+
+	terms, _ = parseSearchQuery(`über café* 東京`)
+	re = highlightPattern(terms)
+	assert.Equal(t, "<mark>Über</mark> <mark>Cafés</mark> in <mark>東京</mark>", highlight("Über Cafés in 東京", re))
+	assert.Equal(t, "überall", highlight("überall", re))
+}
+
+func TestSnippet(t *testing.T) {
+	terms, _ := parseSearchQuery("milk")
+	re := highlightPattern(terms)
+
+	assert.Equal(t, "", snippet("Nothing matches", re, 20))
+	assert.Equal(t, "Buy <mark>milk</mark> today", snippet("Buy milk today", re, 20))
+	assert.Equal(t, "…to buy <mark>milk</mark> and bread for…",
+		snippet("Before the weekend remember to buy milk and bread for everyone", re, 30))
+	assert.Equal(t, "…ünïcödé <mark>milk</mark> ünïcödé…",
+		snippet("ünïcödé ünïcödé ünïcödé ünïcödé milk ünïcödé ünïcödé ünïcödé", re, 40))
+}
+
+func TestService_Search_Validation(t *testing.T) {
+	svc := &Service{repo: nil}
+
+	_, _, err := svc.Search(context.Background(), "-milk", TodoFilter{}, 1, 10)
+	assert.ErrorIs(t, err, ErrInvalidSearch)
+
+	_, _, err = svc.Search(context.Background(), "milk", TodoFilter{}, 1, 101)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+}
@@ -2,20 +2,40 @@ package internal
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 )
 
 type Service struct {
-	repo *Repository
+	repo               *Repository
+	blobs              BlobStore
+	downloadKey        []byte
+	shareKey           []byte
+	undoWindow         time.Duration
+	downloadTTL        time.Duration
+	shareTTL           time.Duration
+	attachmentMaxBytes int64
+	maxAffected        int
+	usersExist         atomic.Bool
 }
 
-func NewService(repo *Repository) *Service {
-	return &Service{repo: repo}
+func NewService(repo *Repository, blobs BlobStore) *Service {
+	return &Service{
+		repo:               repo,
+		blobs:              blobs,
+		downloadKey:        newSigningKey("ATTACHMENT_URL_SECRET", "attachment download links"),
+		shareKey:           newSigningKey("SHARE_LINK_SECRET", "share links"),
+		undoWindow:         GetEnvDuration("UNDO_WINDOW", time.Hour),
+		downloadTTL:        GetEnvDuration("ATTACHMENT_URL_TTL", 15*time.Minute),
+		shareTTL:           GetEnvDuration("SHARE_LINK_TTL", 30*24*time.Hour),
+		attachmentMaxBytes: int64(GetEnvInt("ATTACHMENT_MAX_BYTES", 10<<20)),
+		maxAffected:        GetEnvInt("BATCH_MAX_AFFECTED", 1000),
+	}
 }
 
-func (s *Service) BulkCreate(ctx context.Context, inputs []CreateTodoInput) ([]*Todo, error) {
+func (s *Service) BulkCreate(ctx context.Context, inputs []CreateTodoInput) ([]*Todo, *Operation, error) {
 	if len(inputs) == 0 {
-		return nil, ErrEmptyList
+		return nil, nil, ErrEmptyList
 	}
 
 	seen := make(map[string]bool)
@@ -24,30 +44,65 @@ func (s *Service) BulkCreate(ctx context.Context, inputs []CreateTodoInput) ([]*
 
 	for _, input := range inputs {
 		if err := input.Validate(); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if seen[input.Title] {
-			return nil, ErrDuplicateInRequest
+			return nil, nil, ErrDuplicateInRequest
 		}
 		seen[input.Title] = true
 
-		todos = append(todos, &Todo{
-			Title:       input.Title,
-			Description: input.Description,
-			DueDate:     input.DueDate,
-			Completed:   false,
-			CreatedAt:   now,
-			UpdatedAt:   now,
-		})
+		todos = append(todos, newTodo(input, now))
+	}
+	if err := s.authorizeNewTodos(ctx, todoListIDs(todos)); err != nil {
+		return nil, nil, err
+	}
+
+	op := s.newOperation(ctx, OperationCreate)
+	if err := s.repo.BulkCreate(ctx, op, todos); err != nil {
+		return nil, nil, err
+	}
+	return todos, op, nil
+}
+
+// newTodo builds a new, incomplete todo from validated input. Its status is
+// checked against its list's workflow, or set to the initial state, when it
+// is written.
+func newTodo(input CreateTodoInput, now time.Time) *Todo {
+	return &Todo{
+		UID:             RandomID() + "@todox",
+		ListID:          input.ListID,
+		Status:          input.Status,
+		Title:           input.Title,
+		Description:     input.Description,
+		DueDate:         input.DueDate,
+		StartDate:       input.StartDate,
+		Priority:        input.Priority,
+		EstimateMinutes: input.EstimateMinutes,
+		Tags:            input.Tags,
+		ExternalID:      nullString(input.ExternalID),
+		Source:          nullString(input.Source),
+		Completed:       false,
+		CreatedAt:       now,
+		UpdatedAt:       now,
 	}
+}
 
-	if err := s.repo.BulkCreate(ctx, todos); err != nil {
-		return nil, err
+// List returns a page of the todos matching filter in the given sort order,
+// SortCreated by default.
+func (s *Service) List(ctx context.Context, filter TodoFilter, sort string, page, limit int) ([]Todo, int64, error) {
+	page, limit, err := normalizePage(page, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, ok := todoOrders[sort]; !ok {
+		return nil, 0, ErrInvalidSort
 	}
-	return todos, nil
+	return s.repo.List(ctx, visible(ctx, filter, RoleViewer), sort, page, limit)
 }
 
-func (s *Service) List(ctx context.Context, page, limit int) ([]Todo, int64, error) {
+// normalizePage applies the default page and limit and rejects limits above
+// the maximum page size.
+func normalizePage(page, limit int) (int, int, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -55,55 +110,65 @@ func (s *Service) List(ctx context.Context, page, limit int) ([]Todo, int64, err
 		limit = 10
 	}
 	if limit > 100 {
-		return nil, 0, ErrLimitExceeded
+		return 0, 0, ErrLimitExceeded
 	}
-	return s.repo.List(ctx, page, limit)
+	return page, limit, nil
 }
 
-func (s *Service) BulkUpdate(ctx context.Context, inputs []UpdateTodoInput) ([]*Todo, error) {
+func (s *Service) BulkUpdate(ctx context.Context, inputs []UpdateTodoInput) ([]*Todo, *Operation, error) {
 	if len(inputs) == 0 {
-		return nil, ErrEmptyList
+		return nil, nil, ErrEmptyList
 	}
 
 	seenIDs := make(map[int64]bool)
 	for _, input := range inputs {
 		if err := input.Validate(); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if seenIDs[input.ID] {
-			return nil, ErrDuplicateInRequest
+			return nil, nil, ErrDuplicateInRequest
 		}
 		seenIDs[input.ID] = true
 	}
+	ids := make([]int64, len(inputs))
+	for i, input := range inputs {
+		ids[i] = input.ID
+	}
+	if err := s.authorizeTodos(ctx, ids, RoleEditor); err != nil {
+		return nil, nil, err
+	}
 
-	todos := make([]*Todo, 0, len(inputs))
-	now := time.Now()
+	op := s.newOperation(ctx, OperationUpdate)
+	todos, err := s.repo.BulkUpdate(ctx, op, inputs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return todos, op, nil
+}
 
-	for _, input := range inputs {
-		todo, err := s.repo.GetByID(ctx, input.ID)
-		if err != nil {
-			return nil, err
-		}
+func (s *Service) BulkDelete(ctx context.Context, ids []int64) ([]*Todo, *Operation, error) {
+	if len(ids) == 0 {
+		return nil, nil, ErrEmptyList
+	}
 
-		if input.Title != nil {
-			todo.Title = *input.Title
-		}
-		if input.Description != nil {
-			todo.Description = *input.Description
-		}
-		if input.DueDate != nil {
-			todo.DueDate = input.DueDate
+	seenIDs := make(map[int64]bool)
+	for _, id := range ids {
+		if id <= 0 {
+			return nil, nil, ErrInvalidID
 		}
-		if input.Completed != nil {
-			todo.Completed = *input.Completed
+		if seenIDs[id] {
+			return nil, nil, ErrDuplicateInRequest
 		}
-		todo.UpdatedAt = now
-
-		todos = append(todos, todo)
+		seenIDs[id] = true
+	}
+	if err := s.authorizeTodos(ctx, ids, RoleEditor); err != nil {
+		return nil, nil, err
 	}
 
-	if err := s.repo.BulkUpdate(ctx, todos); err != nil {
-		return nil, err
+	op := s.newOperation(ctx, OperationDelete)
+	todos, err := s.repo.BulkDelete(ctx, op, ids)
+	if err != nil {
+		return nil, nil, err
 	}
-	return todos, nil
+	return todos, op, nil
 }
@@ -33,6 +33,21 @@ func TestCreateTodoInput_Validate(t *testing.T) {
 			input:   CreateTodoInput{Title: string(make([]byte, 300))},
 			wantErr: true,
 		},
+		{
+			name:    "external id with source",
+			input:   CreateTodoInput{Title: "Test Todo", ExternalID: "42", Source: "jira"},
+			wantErr: false,
+		},
+		{
+			name:    "external id without source",
+			input:   CreateTodoInput{Title: "Test Todo", ExternalID: "42"},
+			wantErr: true,
+		},
+		{
+			name:    "negative estimate",
+			input:   CreateTodoInput{Title: "Test Todo", EstimateMinutes: intPtr(-1)},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -73,6 +88,11 @@ func TestUpdateTodoInput_Validate(t *testing.T) {
 			input:   UpdateTodoInput{ID: 1, Title: strPtr("")},
 			wantErr: true,
 		},
+		{
+			name:    "estimate too large",
+			input:   UpdateTodoInput{ID: 1, EstimateMinutes: intPtr(maxEstimateMinutes + 1)},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -90,7 +110,7 @@ func TestUpdateTodoInput_Validate(t *testing.T) {
 func TestService_BulkCreate_EmptyList(t *testing.T) {
 	service := &Service{repo: nil}
 
-	_, err := service.BulkCreate(context.Background(), []CreateTodoInput{})
+	_, _, err := service.BulkCreate(context.Background(), []CreateTodoInput{})
 
 	assert.ErrorIs(t, err, ErrEmptyList)
 }
@@ -103,19 +123,84 @@ func TestService_BulkCreate_DuplicateTitlesInRequest(t *testing.T) {
 		{Title: "Same Title"},
 	}
 
-	_, err := service.BulkCreate(context.Background(), inputs)
+	_, _, err := service.BulkCreate(context.Background(), inputs)
 
 	assert.ErrorIs(t, err, ErrDuplicateInRequest)
 }
 
+func TestService_BulkUpsert_InvalidOnConflict(t *testing.T) {
+	service := &Service{repo: nil}
+
+	_, _, _, err := service.BulkUpsert(context.Background(), []CreateTodoInput{{Title: "a"}}, "replace")
+
+	assert.ErrorIs(t, err, ErrInvalidOnConflict)
+}
+
+func TestService_BulkUpsert_DuplicateKeysInRequest(t *testing.T) {
+	service := &Service{repo: nil}
+
+	tests := []struct {
+		name   string
+		inputs []CreateTodoInput
+	}{
+		{
+			name:   "same title",
+			inputs: []CreateTodoInput{{Title: "Same"}, {Title: "same"}},
+		},
+		{
+			name: "same external id",
+			inputs: []CreateTodoInput{
+				{Title: "One", ExternalID: "1", Source: "jira"},
+				{Title: "Two", ExternalID: "1", Source: "jira"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := service.BulkUpsert(context.Background(), tt.inputs, OnConflictUpdate)
+
+			assert.ErrorIs(t, err, ErrDuplicateInRequest)
+		})
+	}
+}
+
 func TestService_List_LimitTooHigh(t *testing.T) {
 	service := &Service{repo: nil}
 
-	_, _, err := service.List(context.Background(), 1, 200)
+	_, _, err := service.List(context.Background(), TodoFilter{}, "", 1, 200)
 
 	assert.ErrorIs(t, err, ErrLimitExceeded)
 }
 
+func TestService_List_InvalidSort(t *testing.T) {
+	service := &Service{repo: nil}
+
+	_, _, err := service.List(context.Background(), TodoFilter{}, "title", 1, 10)
+
+	assert.ErrorIs(t, err, ErrInvalidSort)
+}
+
+func TestService_Undo_EmptyID(t *testing.T) {
+	service := &Service{repo: nil}
+
+	_, _, err := service.Undo(context.Background(), "")
+
+	assert.ErrorIs(t, err, ErrInvalidID)
+}
+
+func TestService_BulkDelete_DuplicateIDs(t *testing.T) {
+	service := &Service{repo: nil}
+
+	_, _, err := service.BulkDelete(context.Background(), []int64{1, 1})
+
+	assert.ErrorIs(t, err, ErrDuplicateInRequest)
+}
+
 func strPtr(s string) *string {
 	return &s
 }
+
+func intPtr(i int) *int {
+	return &i
+}
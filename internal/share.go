@@ -0,0 +1,533 @@
+package internal
+
+import (
+	"context"
+	"crypto/hmac"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The resources a share link can grant access to.
+const (
+	ShareList = "list"
+	ShareTodo = "todo"
+)
+
+// The permissions of a share link, each including the ones before it.
+const (
+	PermissionView    = "view"
+	PermissionComment = "comment"
+	PermissionEdit    = "edit"
+)
+
+// permissionRanks orders the permissions of a share link.
+var permissionRanks = map[string]int{
+	PermissionView:    1,
+	PermissionComment: 2,
+	PermissionEdit:    3,
+}
+
+// Share grants whoever holds its link access to a list, and all its todos,
+// or to a single todo, until it expires or is revoked. The link carries an
+// HMAC-signed token, so nothing secret is stored; Token and URL are set on
+// shares that are still valid. A share created by a user only works while
+// that user owns what it shares.
+type Share struct {
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt    time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedBy    string     `json:"created_by" db:"created_by"`
+	Permission   string     `json:"permission" db:"permission"`
+	ResourceType string     `json:"resource_type" db:"resource_type"`
+	Token        string     `json:"token,omitempty" db:"-"`
+	URL          string     `json:"url,omitempty" db:"-"`
+	UserID       *int64     `json:"-" db:"user_id"`
+	ID           int64      `json:"id" db:"id"`
+	ResourceID   int64      `json:"resource_id" db:"resource_id"`
+}
+
+// actor is the name changes made through the share are attributed to.
+func (s *Share) actor() string {
+	return "share:" + strconv.FormatInt(s.ID, 10)
+}
+
+// allows reports whether the share grants permission.
+func (s *Share) allows(permission string) bool {
+	return permissionRanks[s.Permission] >= permissionRanks[permission]
+}
+
+// ShareInput creates a share. ExpiresAt defaults to SHARE_LINK_TTL from now.
+type ShareInput struct {
+	ExpiresAt    *time.Time `json:"expires_at"`
+	Permission   string     `json:"permission"`
+	ResourceType string     `json:"resource_type"`
+	ResourceID   int64      `json:"resource_id"`
+}
+
+func (in *ShareInput) Validate(now time.Time) error {
+	if in.ResourceType != ShareList && in.ResourceType != ShareTodo {
+		return ErrInvalidShare
+	}
+	if in.ResourceID <= 0 {
+		return ErrInvalidID
+	}
+	if permissionRanks[in.Permission] == 0 {
+		return ErrInvalidShare
+	}
+	if in.ExpiresAt != nil && !in.ExpiresAt.After(now) {
+		return ErrInvalidShareExpiry
+	}
+	return nil
+}
+
+// WithShare returns a copy of ctx carrying the share a request came through.
+func WithShare(ctx context.Context, share *Share) context.Context {
+	return context.WithValue(ctx, shareKey, share)
+}
+
+// ShareFromContext returns the share stored in ctx, or nil if the request
+// did not come through a share link.
+func ShareFromContext(ctx context.Context) *Share {
+	share, _ := ctx.Value(shareKey).(*Share)
+	return share
+}
+
+func (r *Repository) CreateShare(ctx context.Context, share *Share) error {
+	result, err := r.db.NamedExecContext(ctx,
+		`INSERT INTO share_links (resource_type, resource_id, permission, created_by, user_id, expires_at, created_at)
+		VALUES (:resource_type, :resource_id, :permission, :created_by, :user_id, :expires_at, :created_at)`, share)
+	if err != nil {
+		return err
+	}
+	share.ID, err = result.LastInsertId()
+	return err
+}
+
+// ListShares returns the shares createdBy created and, with an owner, those
+// of the lists that user owns and of the todos in them, newest first.
+func (r *Repository) ListShares(ctx context.Context, createdBy string, owner *int64) ([]Share, error) {
+	query, args := "SELECT * FROM share_links WHERE created_by = ?", []any{createdBy}
+	if owner != nil {
+		query += ` OR (resource_type = 'list' AND resource_id IN
+				(SELECT m.list_id FROM list_members m WHERE m.user_id = ? AND m.role = 'owner'))
+			OR (resource_type = 'todo' AND resource_id IN
+				(SELECT t.id FROM todos t JOIN list_members m ON m.list_id = t.list_id
+				WHERE m.user_id = ? AND m.role = 'owner'))`
+		args = append(args, *owner, *owner)
+	}
+	shares := []Share{}
+	err := r.db.SelectContext(ctx, &shares, query+" ORDER BY id DESC", args...)
+	return shares, err
+}
+
+func (r *Repository) GetShare(ctx context.Context, id int64) (*Share, error) {
+	var share Share
+	err := r.db.GetContext(ctx, &share, "SELECT * FROM share_links WHERE id = ?", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &share, err
+}
+
+func (r *Repository) RevokeShare(ctx context.Context, id int64, now time.Time) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE share_links SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", now, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// shareRole returns a user's role on what a share shares, "" if they have
+// none.
+func (r *Repository) shareRole(ctx context.Context, share *Share, userID int64) (string, error) {
+	if share.ResourceType == ShareList {
+		return r.ListRole(ctx, share.ResourceID, userID)
+	}
+	roles, err := r.TodoRoles(ctx, []int64{share.ResourceID}, userID)
+	return roles[share.ResourceID], err
+}
+
+// shareSignature signs the ID and expiry of a share.
+func (s *Service) shareSignature(id, expires int64) string {
+	return base64.RawURLEncoding.EncodeToString(hmacSHA256(s.shareKey, fmt.Sprintf("share:%d:%d", id, expires)))
+}
+
+// signShare sets the token and link of a share that is still valid.
+func (s *Service) signShare(share *Share, now time.Time) {
+	if share.RevokedAt != nil || !share.ExpiresAt.After(now) {
+		return
+	}
+	expires := share.ExpiresAt.Unix()
+	share.Token = fmt.Sprintf("%d.%d.%s", share.ID, expires, s.shareSignature(share.ID, expires))
+	share.URL = "/v1/shared/" + share.Token
+}
+
+// CreateShare issues a share link to a list or todo that exists.
+func (s *Service) CreateShare(ctx context.Context, input ShareInput) (*Share, error) {
+	now := time.Now()
+	if err := input.Validate(now); err != nil {
+		return nil, err
+	}
+	switch input.ResourceType {
+	case ShareList:
+		if err := s.authorizeList(ctx, input.ResourceID, RoleOwner); err != nil {
+			return nil, err
+		}
+		if _, err := s.repo.GetList(ctx, input.ResourceID); err != nil {
+			return nil, err
+		}
+	case ShareTodo:
+		if err := s.authorizeTodo(ctx, input.ResourceID, RoleOwner); err != nil {
+			return nil, err
+		}
+		if _, err := s.repo.GetByID(ctx, input.ResourceID); err != nil {
+			return nil, err
+		}
+	}
+
+	var creator *int64
+	if user := UserFromContext(ctx); user != nil {
+		creator = &user.ID
+	}
+	expiresAt := now.Add(s.shareTTL)
+	if input.ExpiresAt != nil {
+		expiresAt = *input.ExpiresAt
+	}
+	share := &Share{
+		ResourceType: input.ResourceType,
+		ResourceID:   input.ResourceID,
+		Permission:   input.Permission,
+		CreatedBy:    ActorFromContext(ctx),
+		UserID:       creator,
+		ExpiresAt:    expiresAt.UTC().Truncate(time.Second),
+		CreatedAt:    now,
+	}
+	if err := s.repo.CreateShare(ctx, share); err != nil {
+		return nil, err
+	}
+	s.signShare(share, now)
+	return share, nil
+}
+
+// Shares returns the shares the caller created and, for users, those of the
+// lists they own, newest first.
+func (s *Service) Shares(ctx context.Context) ([]Share, error) {
+	var owner *int64
+	if user := UserFromContext(ctx); user != nil {
+		owner = &user.ID
+	}
+	shares, err := s.repo.ListShares(ctx, ActorFromContext(ctx), owner)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range shares {
+		s.signShare(&shares[i], now)
+	}
+	return shares, nil
+}
+
+// RevokeShare stops a share link from working. Besides its creator, any
+// owner of what it shares may revoke it. Shares the caller may not revoke
+// are not found.
+func (s *Service) RevokeShare(ctx context.Context, id int64) error {
+	if id <= 0 {
+		return ErrInvalidID
+	}
+	share, err := s.repo.GetShare(ctx, id)
+	if err != nil {
+		return err
+	}
+	if share.CreatedBy != ActorFromContext(ctx) {
+		if user := UserFromContext(ctx); user != nil {
+			role, err := s.repo.shareRole(ctx, share, user.ID)
+			if err != nil {
+				return err
+			}
+			if role != RoleOwner {
+				return ErrNotFound
+			}
+		}
+	}
+	return s.repo.RevokeShare(ctx, id, time.Now())
+}
+
+// ResolveShare returns the share a token was issued for, failing with
+// ErrInvalidShareLink if the token is forged, expired or revoked.
+func (s *Service) ResolveShare(ctx context.Context, token string) (*Share, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidShareLink
+	}
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidShareLink
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidShareLink
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(s.shareSignature(id, expires))) || time.Now().Unix() >= expires {
+		return nil, ErrInvalidShareLink
+	}
+
+	share, err := s.repo.GetShare(ctx, id)
+	if err == ErrNotFound {
+		return nil, ErrInvalidShareLink
+	}
+	if err != nil {
+		return nil, err
+	}
+	if share.RevokedAt != nil || share.ExpiresAt.Unix() != expires {
+		return nil, ErrInvalidShareLink
+	}
+	if share.UserID != nil {
+		role, err := s.repo.shareRole(ctx, share, *share.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if role != RoleOwner {
+			return nil, ErrInvalidShareLink
+		}
+	}
+	return share, nil
+}
+
+// SharedTodo returns a todo the share in ctx covers, if it grants
+// permission. Todos it does not cover are not found.
+func (s *Service) SharedTodo(ctx context.Context, id int64, permission string) (*Todo, error) {
+	share := ShareFromContext(ctx)
+	if share == nil {
+		return nil, ErrInvalidShareLink
+	}
+	if id <= 0 {
+		return nil, ErrInvalidID
+	}
+	todo, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case share.ResourceType == ShareTodo && todo.ID == share.ResourceID:
+	case share.ResourceType == ShareList && todo.ListID != nil && *todo.ListID == share.ResourceID:
+	default:
+		return nil, ErrNotFound
+	}
+	if !share.allows(permission) {
+		return nil, ErrSharePermission
+	}
+	return todo, nil
+}
+
+// SharedTodos returns a page of the todos the share in ctx covers that match
+// filter.
+func (s *Service) SharedTodos(ctx context.Context, filter TodoFilter, sort string, page, limit int) ([]Todo, int64, error) {
+	share := ShareFromContext(ctx)
+	if share == nil {
+		return nil, 0, ErrInvalidShareLink
+	}
+	if share.ResourceType == ShareTodo {
+		todo, err := s.SharedTodo(ctx, share.ResourceID, PermissionView)
+		if err != nil {
+			return nil, 0, err
+		}
+		return []Todo{*todo}, 1, nil
+	}
+	filter.ListID = &share.ResourceID
+	return s.List(ctx, filter, sort, page, limit)
+}
+
+// UpdateSharedTodo updates a todo through a share that grants editing.
+func (s *Service) UpdateSharedTodo(ctx context.Context, id int64, input UpdateTodoInput) (*Todo, *Operation, error) {
+	if _, err := s.SharedTodo(ctx, id, PermissionEdit); err != nil {
+		return nil, nil, err
+	}
+	input.ID = id
+	todos, op, err := s.BulkUpdate(ctx, []UpdateTodoInput{input})
+	if err != nil {
+		return nil, nil, err
+	}
+	return todos[0], op, nil
+}
+
+func (h *Handler) CreateShare(c *gin.Context) {
+	var input ShareInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	share, err := h.service.CreateShare(c.Request.Context(), input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": share})
+}
+
+func (h *Handler) ListShares(c *gin.Context) {
+	shares, err := h.service.Shares(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": shares})
+}
+
+func (h *Handler) RevokeShare(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+
+	if err := h.service.RevokeShare(c.Request.Context(), id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// registerShared registers the public endpoints of share links. They are
+// authenticated by ShareMiddleware rather than an API key, and only reach
+// what the share covers.
+func (h *Handler) registerShared(r *gin.Engine) {
+	shared := r.Group("/v1/shared/:token", ShareMiddleware(h.service))
+	{
+		shared.GET("", h.GetShared)
+		shared.GET("/todos", h.ListSharedTodos)
+		shared.GET("/todos/:id", h.GetSharedTodo)
+		shared.PATCH("/todos/:id", h.UpdateSharedTodo)
+		shared.GET("/todos/:id/comments", h.sharedTodo(PermissionView, h.ListComments))
+		shared.POST("/todos/:id/comments", h.sharedTodo(PermissionComment, h.CreateComment))
+	}
+}
+
+// sharedTodo wraps a todo endpoint so that it only serves the todos the
+// share covers, with the given permission.
+func (h *Handler) sharedTodo(permission string, next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+			return
+		}
+		if _, err := h.service.SharedTodo(c.Request.Context(), id, permission); err != nil {
+			handleError(c, err)
+			return
+		}
+		next(c)
+	}
+}
+
+// GetShared serves GET /v1/shared/:token, the shared list or todo.
+func (h *Handler) GetShared(c *gin.Context) {
+	ctx := c.Request.Context()
+	share := ShareFromContext(ctx)
+
+	var resource any
+	var err error
+	if share.ResourceType == ShareList {
+		resource, err = h.service.GetList(ctx, share.ResourceID)
+	} else {
+		resource, err = h.service.SharedTodo(ctx, share.ResourceID, PermissionView)
+	}
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": resource,
+		"meta": gin.H{
+			"resource_type": share.ResourceType,
+			"permission":    share.Permission,
+			"expires_at":    share.ExpiresAt,
+		},
+	})
+}
+
+func (h *Handler) ListSharedTodos(c *gin.Context) {
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	filter, ok := parseListFilter(c)
+	if !ok {
+		return
+	}
+
+	todos, total, err := h.service.SharedTodos(c.Request.Context(), filter, c.Query("sort"), page, limit)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": todos,
+		"meta": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+func (h *Handler) GetSharedTodo(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+
+	todo, err := h.service.SharedTodo(c.Request.Context(), id, PermissionView)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": todo})
+}
+
+// UpdateSharedTodo serves PATCH /v1/shared/:token/todos/:id. The body sets
+// the fields to change, as one entry of PATCH /v1/todos without the id.
+func (h *Handler) UpdateSharedTodo(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	// Decoded without binding, which would require the id.
+	var input UpdateTodoInput
+	if err := json.NewDecoder(c.Request.Body).Decode(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	todo, op, err := h.service.UpdateSharedTodo(c.Request.Context(), id, input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": todo, "meta": operationMeta(op)})
+}
@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShareInput_Validate(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		wantErr error
+		name    string
+		input   ShareInput
+	}{
+		{name: "list", input: ShareInput{ResourceType: ShareList, ResourceID: 1, Permission: PermissionView}},
+		{name: "todo with expiry", input: ShareInput{ResourceType: ShareTodo, ResourceID: 1, Permission: PermissionEdit, ExpiresAt: &future}},
+		{name: "unknown resource", input: ShareInput{ResourceType: "view", ResourceID: 1, Permission: PermissionView}, wantErr: ErrInvalidShare},
+		{name: "missing resource id", input: ShareInput{ResourceType: ShareList, Permission: PermissionView}, wantErr: ErrInvalidID},
+		{name: "unknown permission", input: ShareInput{ResourceType: ShareList, ResourceID: 1, Permission: "admin"}, wantErr: ErrInvalidShare},
+		{name: "expired", input: ShareInput{ResourceType: ShareList, ResourceID: 1, Permission: PermissionView, ExpiresAt: &past}, wantErr: ErrInvalidShareExpiry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.input.Validate(now)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestShare_Allows(t *testing.T) {
+	comment := &Share{Permission: PermissionComment}
+
+	assert.True(t, comment.allows(PermissionView))
+	assert.True(t, comment.allows(PermissionComment))
+	assert.False(t, comment.allows(PermissionEdit))
+}
+
+func TestService_SignShare(t *testing.T) {
+	service := &Service{repo: nil, shareKey: []byte("secret")}
+	now := time.Now()
+
+	share := &Share{ID: 7, ExpiresAt: now.Add(time.Hour).Truncate(time.Second)}
+	service.signShare(share, now)
+	assert.Equal(t, "/v1/shared/"+share.Token, share.URL)
+	parts := strings.Split(share.Token, ".")
+	require.Len(t, parts, 3)
+	assert.Equal(t, "7", parts[0])
+	assert.Equal(t, strconv.FormatInt(share.ExpiresAt.Unix(), 10), parts[1])
+
+	revoked := &Share{ID: 8, ExpiresAt: now.Add(time.Hour), RevokedAt: &now}
+	service.signShare(revoked, now)
+	assert.Empty(t, revoked.Token)
+
+	expired := &Share{ID: 9, ExpiresAt: now.Add(-time.Hour)}
+	service.signShare(expired, now)
+	assert.Empty(t, expired.Token)
+}
+
+func TestService_ResolveShare_Invalid(t *testing.T) {
+	service := &Service{repo: nil, shareKey: []byte("secret")}
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour).Unix()
+	expired := time.Now().Add(-time.Second).Unix()
+	token := func(id, expires int64, signature string) string {
+		return strconv.FormatInt(id, 10) + "." + strconv.FormatInt(expires, 10) + "." + signature
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "malformed", token: "abc"},
+		{name: "other share", token: token(8, expires, service.shareSignature(7, expires))},
+		{name: "extended expiry", token: token(7, expires+3600, service.shareSignature(7, expires))},
+		{name: "other key", token: token(7, expires, (&Service{shareKey: []byte("guess")}).shareSignature(7, expires))},
+		{name: "expired", token: token(7, expired, service.shareSignature(7, expired))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.ResolveShare(ctx, tt.token)
+
+			assert.ErrorIs(t, err, ErrInvalidShareLink)
+		})
+	}
+}
+
+func TestService_SharedTodo_WithoutShare(t *testing.T) {
+	service := &Service{repo: nil}
+
+	_, err := service.SharedTodo(context.Background(), 1, PermissionView)
+
+	assert.ErrorIs(t, err, ErrInvalidShareLink)
+}
+
+func TestHandler_Shared_InvalidToken(t *testing.T) {
+	t.Setenv("API_KEY", "secret")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	service := &Service{repo: nil, shareKey: []byte("secret")}
+	r.Use(AuthMiddleware(service))
+	handler := &Handler{service: service}
+	handler.RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/shared/1.2.forged/todos", nil)
+	rec := httptest.NewRecorder()
+
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
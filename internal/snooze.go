@@ -0,0 +1,227 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/fx"
+)
+
+// Snooze presets, resolved in the caller's timezone.
+const (
+	SnoozeLaterToday = "later_today"
+	SnoozeTomorrow   = "tomorrow"
+	SnoozeNextWeek   = "next_week"
+)
+
+// snoozeMorning is the hour of the day snoozes until tomorrow or next week
+// end at.
+const snoozeMorning = 9
+
+// snoozeLaterToday is how long a snooze until later today lasts, at most
+// until the end of the local day.
+const snoozeLaterToday = 3 * time.Hour
+
+// wakeBatchSize is the number of snoozed todos woken per transaction.
+const wakeBatchSize = 100
+
+// SnoozeInput hides a todo from the list views until a time, given either
+// as until or as a preset. Presets are resolved in tz, defaulting to the
+// caller's timezone.
+type SnoozeInput struct {
+	Until    *time.Time `json:"until"`
+	Preset   string     `json:"preset"`
+	Timezone string     `json:"tz"`
+}
+
+// resolve returns the time the snooze ends at.
+func (in SnoozeInput) resolve(ctx context.Context, now time.Time) (time.Time, error) {
+	if (in.Until == nil) == (in.Preset == "") {
+		return time.Time{}, ErrInvalidSnooze
+	}
+	if in.Until != nil {
+		if !in.Until.After(now) {
+			return time.Time{}, ErrInvalidSnooze
+		}
+		return *in.Until, nil
+	}
+
+	tz := in.Timezone
+	if user := UserFromContext(ctx); tz == "" && user != nil {
+		tz = user.Timezone
+	}
+	if tz == "" {
+		tz = "UTC"
+	}
+	loc, err := loadTimezone(tz)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return snoozePreset(in.Preset, now, loc)
+}
+
+// snoozePreset returns the end of a snooze preset starting at now. Later
+// today ends by midnight in loc; tomorrow and next week, which starts on
+// Monday, begin at snoozeMorning in loc.
+func snoozePreset(preset string, now time.Time, loc *time.Location) (time.Time, error) {
+	local := now.In(loc)
+	switch preset {
+	case SnoozeLaterToday:
+		midnight := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, loc)
+		if later := now.Add(snoozeLaterToday); later.Before(midnight) {
+			return later, nil
+		}
+		return midnight, nil
+	case SnoozeTomorrow:
+		return time.Date(local.Year(), local.Month(), local.Day()+1, snoozeMorning, 0, 0, 0, loc), nil
+	case SnoozeNextWeek:
+		days := (8 - int(local.Weekday())) % 7
+		if days == 0 {
+			days = 7
+		}
+		return time.Date(local.Year(), local.Month(), local.Day()+days, snoozeMorning, 0, 0, 0, loc), nil
+	}
+	return time.Time{}, ErrInvalidSnooze
+}
+
+// WakeSnoozed clears the snooze of up to limit todos whose snooze ended by
+// now and returns them. Todos being woken by another instance are skipped.
+// The change is recorded as an update by the system that belongs to no
+// operation.
+func (r *Repository) WakeSnoozed(ctx context.Context, now time.Time, limit int) ([]*Todo, error) {
+	var woken []*Todo
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		var snoozed []*Todo
+		err := tx.SelectContext(ctx, &snoozed,
+			"SELECT * FROM todos WHERE snoozed_until <= ? ORDER BY snoozed_until, id LIMIT ? FOR UPDATE SKIP LOCKED",
+			now, limit)
+		if err != nil || len(snoozed) == 0 {
+			return err
+		}
+
+		woken = make([]*Todo, len(snoozed))
+		events := make([]TodoEvent, len(snoozed))
+		for i, before := range snoozed {
+			after := *before
+			after.SnoozedUntil = nil
+			after.UpdatedAt = now
+			woken[i] = &after
+			events[i] = TodoEvent{
+				TodoID:    before.ID,
+				Action:    EventUpdated,
+				Actor:     ActorFromContext(ctx),
+				Changes:   diffTodos(before, &after),
+				Snapshot:  TodoSnapshot{Todo: before},
+				CreatedAt: now,
+			}
+		}
+		if err := updateTodos(ctx, tx, woken, now); err != nil {
+			return err
+		}
+		return insertEvents(ctx, tx, events)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return woken, nil
+}
+
+// Snooze hides a todo from the list views until the time input names. Like
+// any update it can be undone.
+func (s *Service) Snooze(ctx context.Context, id int64, input SnoozeInput) (*Todo, *Operation, error) {
+	if id <= 0 {
+		return nil, nil, ErrInvalidID
+	}
+	until, err := input.resolve(ctx, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	todos, op, err := s.BulkUpdate(ctx, []UpdateTodoInput{{ID: id, snoozedUntil: &until}})
+	if err != nil {
+		return nil, nil, err
+	}
+	return todos[0], op, nil
+}
+
+// Wake ends a todo's snooze early.
+func (s *Service) Wake(ctx context.Context, id int64) (*Todo, *Operation, error) {
+	if id <= 0 {
+		return nil, nil, ErrInvalidID
+	}
+	todos, op, err := s.BulkUpdate(ctx, []UpdateTodoInput{{ID: id, wake: true}})
+	if err != nil {
+		return nil, nil, err
+	}
+	return todos[0], op, nil
+}
+
+// WakeSnoozed wakes every todo whose snooze has ended and returns how many
+// it woke.
+func (s *Service) WakeSnoozed(ctx context.Context) (int, error) {
+	woken := 0
+	for {
+		todos, err := s.repo.WakeSnoozed(ctx, time.Now(), wakeBatchSize)
+		woken += len(todos)
+		if err != nil || len(todos) < wakeBatchSize {
+			return woken, err
+		}
+	}
+}
+
+// StartSnoozeWaker runs WakeSnoozed every SNOOZE_WAKE_INTERVAL for the
+// lifetime of the application.
+func StartSnoozeWaker(lc fx.Lifecycle, service *Service) {
+	runEvery(lc, GetEnvDuration("SNOOZE_WAKE_INTERVAL", time.Minute), func(ctx context.Context) {
+		woken, err := service.WakeSnoozed(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Failed to wake snoozed todos", "error", err)
+		}
+		if woken > 0 {
+			slog.Info("Woke snoozed todos", "todos", woken)
+		}
+	})
+}
+
+// SnoozeTodo serves POST /v1/todos/:id/snooze.
+func (h *Handler) SnoozeTodo(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	var input SnoozeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	todo, op, err := h.service.Snooze(c.Request.Context(), id, input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": todo, "meta": operationMeta(op)})
+}
+
+// WakeTodo serves DELETE /v1/todos/:id/snooze.
+func (h *Handler) WakeTodo(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+
+	todo, op, err := h.service.Wake(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": todo, "meta": operationMeta(op)})
+}
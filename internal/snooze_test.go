@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnoozePreset(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	// Wednesday 23:30 in Berlin, already Thursday in UTC.
+	now := time.Date(2026, 10, 21, 23, 30, 0, 0, berlin)
+
+	tests := []struct {
+		now    time.Time
+		want   time.Time
+		name   string
+		preset string
+	}{
+		{name: "later today", now: time.Date(2026, 10, 21, 14, 0, 0, 0, berlin), preset: SnoozeLaterToday, want: time.Date(2026, 10, 21, 17, 0, 0, 0, berlin)},
+		{name: "later today ends at local midnight", now: now, preset: SnoozeLaterToday, want: time.Date(2026, 10, 22, 0, 0, 0, 0, berlin)},
+		{name: "tomorrow in the caller's timezone", now: now, preset: SnoozeTomorrow, want: time.Date(2026, 10, 22, 9, 0, 0, 0, berlin)},
+		{name: "next week from wednesday", now: now, preset: SnoozeNextWeek, want: time.Date(2026, 10, 26, 9, 0, 0, 0, berlin)},
+		{name: "next week from monday", now: time.Date(2026, 10, 19, 8, 0, 0, 0, berlin), preset: SnoozeNextWeek, want: time.Date(2026, 10, 26, 9, 0, 0, 0, berlin)},
+		{name: "next week from sunday", now: time.Date(2026, 10, 25, 20, 0, 0, 0, berlin), preset: SnoozeNextWeek, want: time.Date(2026, 10, 26, 9, 0, 0, 0, berlin)},
+		{name: "tomorrow across DST change", now: time.Date(2026, 10, 24, 12, 0, 0, 0, berlin), preset: SnoozeTomorrow, want: time.Date(2026, 10, 25, 9, 0, 0, 0, berlin)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := snoozePreset(tt.preset, tt.now, berlin)
+
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(got), "got %s, want %s", got, tt.want)
+		})
+	}
+
+	_, err = snoozePreset("someday", now, berlin)
+	assert.ErrorIs(t, err, ErrInvalidSnooze)
+}
+
+func TestSnoozeInput_Resolve(t *testing.T) {
+	now := time.Date(2026, 10, 19, 22, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+	user := WithUser(context.Background(), &User{ID: 1, Name: "alice", Timezone: "Asia/Tokyo"})
+
+	t.Run("until", func(t *testing.T) {
+		got, err := SnoozeInput{Until: &future}.resolve(context.Background(), now)
+
+		require.NoError(t, err)
+		assert.Equal(t, future, got)
+	})
+	t.Run("preset in the user's timezone", func(t *testing.T) {
+		got, err := SnoozeInput{Preset: SnoozeTomorrow}.resolve(user, now)
+
+		require.NoError(t, err)
+		// 22:00 UTC is already 07:00 on the 20th in Tokyo, so tomorrow is
+		// 09:00 on the 21st there.
+		assert.Equal(t, time.Date(2026, 10, 21, 0, 0, 0, 0, time.UTC), got.UTC())
+	})
+	t.Run("tz wins over the user's timezone", func(t *testing.T) {
+		got, err := SnoozeInput{Preset: SnoozeTomorrow, Timezone: "UTC"}.resolve(user, now)
+
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC), got.UTC())
+	})
+
+	tests := []struct {
+		wantErr error
+		name    string
+		input   SnoozeInput
+	}{
+		{name: "neither", input: SnoozeInput{}, wantErr: ErrInvalidSnooze},
+		{name: "both", input: SnoozeInput{Until: &future, Preset: SnoozeTomorrow}, wantErr: ErrInvalidSnooze},
+		{name: "until in the past", input: SnoozeInput{Until: &past}, wantErr: ErrInvalidSnooze},
+		{name: "unknown preset", input: SnoozeInput{Preset: "someday"}, wantErr: ErrInvalidSnooze},
+		{name: "unknown timezone", input: SnoozeInput{Preset: SnoozeTomorrow, Timezone: "Mars/Olympus"}, wantErr: ErrInvalidTimezone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.input.resolve(context.Background(), now)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestTodoFilter_Actionable(t *testing.T) {
+	now := time.Now()
+	where, args := TodoFilter{ActionableAt: &now}.where()
+
+	assert.Equal(t, " WHERE (start_date IS NULL OR start_date <= ?) AND (snoozed_until IS NULL OR snoozed_until <= ?)", where)
+	assert.Equal(t, []any{now, now}, args)
+}
+
+func TestHandler_Snooze_Validation(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{name: "invalid id", method: http.MethodPost, target: "/v1/todos/abc/snooze", body: `{"preset": "tomorrow"}`},
+		{name: "no snooze time", method: http.MethodPost, target: "/v1/todos/1/snooze", body: `{}`},
+		{name: "invalid include", method: http.MethodGet, target: "/v1/todos?include=everything"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			handler := &Handler{service: &Service{repo: nil}}
+			handler.RegisterRoutes(r)
+
+			req := httptest.NewRequest(tt.method, tt.target, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+	// Embed the timezone database: the alpine image has none, and the stats
+	// endpoint buckets by the caller's timezone.
+	_ "time/tzdata"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stats intervals, the width of the buckets created and completed todos are
+// counted in.
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// maxStatsBuckets caps the number of buckets one stats request may span.
+const maxStatsBuckets = 400
+
+// Stats summarises the todos matching a filter. Buckets cover whole days,
+// ISO weeks or months in the caller's timezone, from the one containing From
+// to the one containing To.
+type Stats struct {
+	From                 time.Time     `json:"from"`
+	To                   time.Time     `json:"to"`
+	MedianTimeToComplete *float64      `json:"median_time_to_complete_seconds"`
+	Interval             string        `json:"interval"`
+	Timezone             string        `json:"timezone"`
+	Buckets              []StatsBucket `json:"buckets"`
+	ByTag                []TagStats    `json:"by_tag"`
+	ByList               []ListStats   `json:"by_list"`
+	Total                int64         `json:"total" db:"total"`
+	Open                 int64         `json:"open" db:"open"`
+	Overdue              int64         `json:"overdue" db:"overdue"`
+}
+
+// StatsBucket counts the todos created in a bucket and the completions
+// recorded in it. A todo completed, reopened and completed again counts
+// twice.
+type StatsBucket struct {
+	Start     time.Time `json:"start"`
+	Created   int64     `json:"created"`
+	Completed int64     `json:"completed"`
+}
+
+type TagStats struct {
+	Tag       string `json:"tag" db:"tag"`
+	Total     int64  `json:"total" db:"total"`
+	Open      int64  `json:"open" db:"open"`
+	Completed int64  `json:"completed" db:"completed"`
+}
+
+// ListStats counts the matching todos of a list. ListID and Name are null
+// for the todos outside any list.
+type ListStats struct {
+	ListID    *int64  `json:"list_id" db:"list_id"`
+	Name      *string `json:"name" db:"name"`
+	Total     int64   `json:"total" db:"total"`
+	Open      int64   `json:"open" db:"open"`
+	Completed int64   `json:"completed" db:"completed"`
+}
+
+// StatsQuery selects the todos and range a Stats covers.
+type StatsQuery struct {
+	From     *time.Time
+	To       *time.Time
+	Filter   TodoFilter
+	Interval string
+	Timezone string
+}
+
+// loadTimezone returns the IANA timezone with the given name. Local is
+// refused: it is the server's timezone rather than the caller's.
+func loadTimezone(name string) (*time.Location, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		return nil, ErrInvalidTimezone
+	}
+	return loc, nil
+}
+
+// statsBuckets returns the start of every bucket from the one containing
+// from to the one containing to, followed by the end of the last one.
+func statsBuckets(from, to time.Time, interval string, loc *time.Location) ([]time.Time, error) {
+	from = from.In(loc)
+	var start time.Time
+	switch interval {
+	case IntervalDay:
+		start = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	case IntervalWeek:
+		// ISO weeks start on Monday.
+		offset := (int(from.Weekday()) + 6) % 7
+		start = time.Date(from.Year(), from.Month(), from.Day()-offset, 0, 0, 0, 0, loc)
+	case IntervalMonth:
+		start = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, loc)
+	default:
+		return nil, ErrInvalidInterval
+	}
+
+	// time.Date normalises each bound on its own, so days stay aligned to
+	// midnight across DST changes.
+	bounds := []time.Time{start}
+	for i := 1; !bounds[len(bounds)-1].After(to); i++ {
+		if i > maxStatsBuckets {
+			return nil, ErrTooManyBuckets
+		}
+		switch interval {
+		case IntervalDay:
+			bounds = append(bounds, time.Date(start.Year(), start.Month(), start.Day()+i, 0, 0, 0, 0, loc))
+		case IntervalWeek:
+			bounds = append(bounds, time.Date(start.Year(), start.Month(), start.Day()+7*i, 0, 0, 0, 0, loc))
+		case IntervalMonth:
+			bounds = append(bounds, time.Date(start.Year(), start.Month()+time.Month(i), 1, 0, 0, 0, 0, loc))
+		}
+	}
+	return bounds, nil
+}
+
+// bucketCase returns a SQL expression giving the index of the bucket column
+// falls in, given the bucket bounds from statsBuckets, and its arguments.
+// Rows outside the bounds must be filtered out separately.
+func bucketCase(column string, bounds []time.Time) (string, []any) {
+	last := len(bounds) - 2
+	if last == 0 {
+		return "?", []any{0}
+	}
+	var (
+		b    strings.Builder
+		args []any
+	)
+	b.WriteString("CASE")
+	for i := 0; i < last; i++ {
+		b.WriteString(" WHEN " + column + " < ? THEN ?")
+		args = append(args, bounds[i+1], i)
+	}
+	b.WriteString(" ELSE ? END")
+	return b.String(), append(args, last)
+}
+
+// Stats aggregates the todos matching filter. bounds are the bucket bounds
+// from statsBuckets and now decides which open todos are overdue.
+func (r *Repository) Stats(ctx context.Context, filter TodoFilter, bounds []time.Time, now time.Time) (*Stats, error) {
+	where, args := filter.where()
+	matching := "SELECT * FROM todos" + where
+	stats := &Stats{Buckets: make([]StatsBucket, len(bounds)-1), ByTag: []TagStats{}, ByList: []ListStats{}}
+	for i := range stats.Buckets {
+		stats.Buckets[i].Start = bounds[i]
+	}
+	first, last := bounds[0], bounds[len(bounds)-1]
+
+	err := r.db.GetContext(ctx, stats, `SELECT COUNT(*) AS total,
+		COALESCE(SUM(completed = FALSE), 0) AS open,
+		COALESCE(SUM(completed = FALSE AND due_date < ?), 0) AS overdue
+		FROM (`+matching+`) t`, append([]any{now}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	type bucketCount struct {
+		Bucket int   `db:"bucket"`
+		Count  int64 `db:"count"`
+	}
+	var created, completed []bucketCount
+	bucket, bucketArgs := bucketCase("created_at", bounds)
+	err = r.db.SelectContext(ctx, &created,
+		"SELECT "+bucket+" AS bucket, COUNT(*) AS count FROM ("+matching+") t WHERE created_at >= ? AND created_at < ? GROUP BY bucket",
+		append(append(bucketArgs, args...), first, last)...)
+	if err != nil {
+		return nil, err
+	}
+	err = r.db.SelectContext(ctx, &completed,
+		"SELECT "+bucket+" AS bucket, COUNT(*) AS count FROM completion_history WHERE action = ?"+
+			" AND todo_id IN (SELECT id FROM ("+matching+") t) AND created_at >= ? AND created_at < ? GROUP BY bucket",
+		append(append(append(bucketArgs, CompletionCompleted), args...), first, last)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range created {
+		stats.Buckets[c.Bucket].Created = c.Count
+	}
+	for _, c := range completed {
+		stats.Buckets[c.Bucket].Completed = c.Count
+	}
+
+	err = r.db.GetContext(ctx, &stats.MedianTimeToComplete, `WITH durations AS (
+			SELECT TIMESTAMPDIFF(SECOND, created_at, completed_at) AS seconds
+			FROM (`+matching+`) t WHERE completed_at IS NOT NULL
+		), ranked AS (
+			SELECT seconds, ROW_NUMBER() OVER (ORDER BY seconds) AS n, COUNT(*) OVER () AS total FROM durations
+		)
+		SELECT AVG(seconds) FROM ranked WHERE n IN (FLOOR((total + 1) / 2), CEIL((total + 1) / 2))`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.SelectContext(ctx, &stats.ByTag, `SELECT jt.tag, COUNT(*) AS total,
+		SUM(t.completed = FALSE) AS open, SUM(t.completed = TRUE) AS completed
+		FROM (`+matching+`) t, JSON_TABLE(t.tags, '$[*]' COLUMNS (tag VARCHAR(64) PATH '$')) jt
+		GROUP BY jt.tag ORDER BY total DESC, jt.tag`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.SelectContext(ctx, &stats.ByList, `SELECT t.list_id, l.name, COUNT(*) AS total,
+		SUM(t.completed = FALSE) AS open, SUM(t.completed = TRUE) AS completed
+		FROM (`+matching+`) t LEFT JOIN lists l ON l.id = t.list_id
+		GROUP BY t.list_id, l.name ORDER BY total DESC, t.list_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Stats reports on the todos matching q.Filter. Without a range it covers
+// the last 30 days, 12 weeks or 12 months up to now.
+func (s *Service) Stats(ctx context.Context, q StatsQuery) (*Stats, error) {
+	if q.Interval == "" {
+		q.Interval = IntervalDay
+	}
+	if q.Timezone == "" {
+		q.Timezone = "UTC"
+	}
+	loc, err := loadTimezone(q.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	to := now
+	if q.To != nil {
+		to = *q.To
+	}
+	var from time.Time
+	switch {
+	case q.From != nil:
+		from = *q.From
+	case q.Interval == IntervalWeek:
+		from = to.AddDate(0, 0, -7*11)
+	case q.Interval == IntervalMonth:
+		from = to.AddDate(0, -11, 0)
+	default:
+		from = to.AddDate(0, 0, -29)
+	}
+	if from.After(to) {
+		return nil, ErrInvalidStatsRange
+	}
+
+	bounds, err := statsBuckets(from, to, q.Interval, loc)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.repo.Stats(ctx, visible(ctx, q.Filter, RoleViewer), bounds, now)
+	if err != nil {
+		return nil, err
+	}
+	stats.From, stats.To = from.In(loc), to.In(loc)
+	stats.Interval, stats.Timezone = q.Interval, loc.String()
+	return stats, nil
+}
+
+// GetStats serves GET /v1/stats. It takes the list filters, an interval of
+// day, week or month, an IANA timezone the buckets are aligned to, and an
+// optional RFC3339 from and to.
+func (h *Handler) GetStats(c *gin.Context) {
+	filter, ok := parseTodoFilter(c)
+	if !ok {
+		return
+	}
+	q := StatsQuery{Filter: filter, Interval: c.Query("interval"), Timezone: c.Query("tz")}
+	if q.From, ok = parseTimeQuery(c, "from"); !ok {
+		return
+	}
+	if q.To, ok = parseTimeQuery(c, "to"); !ok {
+		return
+	}
+
+	stats, err := h.service.Stats(c.Request.Context(), q)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": stats})
+}
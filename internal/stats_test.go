@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsBuckets(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("timezone database not available")
+	}
+
+	t.Run("days across a DST change", func(t *testing.T) {
+		// Clocks in Berlin go back on 2026-10-25.
+		from := time.Date(2026, 10, 24, 22, 30, 0, 0, time.UTC) // 00:30 on the 25th in Berlin
+		to := time.Date(2026, 10, 26, 12, 0, 0, 0, time.UTC)
+
+		bounds, err := statsBuckets(from, to, IntervalDay, berlin)
+		assert.NoError(t, err)
+		assert.Equal(t, []time.Time{
+			time.Date(2026, 10, 25, 0, 0, 0, 0, berlin),
+			time.Date(2026, 10, 26, 0, 0, 0, 0, berlin),
+			time.Date(2026, 10, 27, 0, 0, 0, 0, berlin),
+		}, bounds)
+		assert.Equal(t, 25*time.Hour, bounds[1].Sub(bounds[0]))
+	})
+
+	t.Run("ISO weeks", func(t *testing.T) {
+		from := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC) // a Sunday
+		to := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+		bounds, err := statsBuckets(from, to, IntervalWeek, time.UTC)
+		assert.NoError(t, err)
+		assert.Equal(t, []time.Time{
+			time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC),
+			time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+			time.Date(2026, 10, 26, 0, 0, 0, 0, time.UTC),
+		}, bounds)
+	})
+
+	t.Run("months", func(t *testing.T) {
+		from := time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+		bounds, err := statsBuckets(from, to, IntervalMonth, time.UTC)
+		assert.NoError(t, err)
+		assert.Equal(t, []time.Time{
+			time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+		}, bounds)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		now := time.Now()
+		_, err := statsBuckets(now, now, "year", time.UTC)
+		assert.ErrorIs(t, err, ErrInvalidInterval)
+
+		_, err = statsBuckets(now.AddDate(-2, 0, 0), now, IntervalDay, time.UTC)
+		assert.ErrorIs(t, err, ErrTooManyBuckets)
+	})
+}
+
+func TestBucketCase(t *testing.T) {
+	d := func(day int) time.Time { return time.Date(2026, 10, day, 0, 0, 0, 0, time.UTC) }
+
+	expr, args := bucketCase("created_at", []time.Time{d(1), d(2)})
+	assert.Equal(t, "?", expr)
+	assert.Equal(t, []any{0}, args)
+
+	expr, args = bucketCase("created_at", []time.Time{d(1), d(2), d(3), d(4)})
+	assert.Equal(t, "CASE WHEN created_at < ? THEN ? WHEN created_at < ? THEN ? ELSE ? END", expr)
+	assert.Equal(t, []any{d(2), 0, d(3), 1, 2}, args)
+}
+
+func TestService_Stats_Validation(t *testing.T) {
+	svc := &Service{repo: nil}
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+
+	tests := []struct {
+		query   StatsQuery
+		name    string
+		wantErr error
+	}{
+		{name: "unknown interval", query: StatsQuery{Interval: "quarter"}, wantErr: ErrInvalidInterval},
+		{name: "unknown timezone", query: StatsQuery{Timezone: "Mars/Olympus"}, wantErr: ErrInvalidTimezone},
+		{name: "server timezone", query: StatsQuery{Timezone: "Local"}, wantErr: ErrInvalidTimezone},
+		{name: "from after to", query: StatsQuery{From: &now, To: &earlier}, wantErr: ErrInvalidStatsRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Stats(context.Background(), tt.query)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,569 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// maxEntryMinutes caps the length of a manual time entry.
+const maxEntryMinutes = 24 * 60
+
+// maxNoteLength caps the length of a time entry's note, in characters.
+const maxNoteLength = 1000
+
+// TimeEntry is time an actor spent on a todo. An entry whose EndedAt is
+// null is a running timer; stopping it rounds its Minutes up to the next
+// whole minute.
+type TimeEntry struct {
+	StartedAt time.Time  `json:"started_at" db:"started_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	EndedAt   *time.Time `json:"ended_at" db:"ended_at"`
+	Actor     string     `json:"actor" db:"actor"`
+	Note      string     `json:"note,omitempty" db:"note"`
+	ID        int64      `json:"id" db:"id"`
+	TodoID    int64      `json:"todo_id" db:"todo_id"`
+	Minutes   int64      `json:"minutes" db:"minutes"`
+}
+
+// TimerInput starts a timer.
+type TimerInput struct {
+	Note string `json:"note"`
+}
+
+func (in *TimerInput) Validate() error {
+	if utf8.RuneCountInString(in.Note) > maxNoteLength {
+		return ErrInvalidTimeEntry
+	}
+	return nil
+}
+
+// TimeEntryInput logs time that was not tracked with a timer. Without
+// started_at the entry ends now.
+type TimeEntryInput struct {
+	StartedAt *time.Time `json:"started_at"`
+	Note      string     `json:"note"`
+	Minutes   int64      `json:"minutes"`
+}
+
+func (in *TimeEntryInput) Validate(now time.Time) error {
+	if in.Minutes < 1 || in.Minutes > maxEntryMinutes || utf8.RuneCountInString(in.Note) > maxNoteLength {
+		return ErrInvalidTimeEntry
+	}
+	if in.StartedAt == nil {
+		started := now.Add(-time.Duration(in.Minutes) * time.Minute)
+		in.StartedAt = &started
+	}
+	if in.StartedAt.Add(time.Duration(in.Minutes) * time.Minute).After(now) {
+		return ErrInvalidTimeEntry
+	}
+	return nil
+}
+
+// TimeReport totals the time logged on the todos matching a filter from
+// From to To, overall and by tag and list. An entry counts towards the
+// range it started in. EstimateMinutes adds up the estimates of the todos
+// with time logged in the range, whenever the rest of their time was
+// logged.
+type TimeReport struct {
+	From            time.Time  `json:"from"`
+	To              time.Time  `json:"to"`
+	ByTag           []TagTime  `json:"by_tag"`
+	ByList          []ListTime `json:"by_list"`
+	Todos           int64      `json:"todos" db:"todos"`
+	LoggedMinutes   int64      `json:"logged_minutes" db:"logged_minutes"`
+	EstimateMinutes int64      `json:"estimate_minutes" db:"estimate_minutes"`
+}
+
+type TagTime struct {
+	Tag             string `json:"tag" db:"tag"`
+	Todos           int64  `json:"todos" db:"todos"`
+	LoggedMinutes   int64  `json:"logged_minutes" db:"logged_minutes"`
+	EstimateMinutes int64  `json:"estimate_minutes" db:"estimate_minutes"`
+}
+
+// ListTime totals the time logged on the todos of a list. ListID and Name
+// are null for the todos outside any list.
+type ListTime struct {
+	ListID          *int64  `json:"list_id" db:"list_id"`
+	Name            *string `json:"name" db:"name"`
+	Todos           int64   `json:"todos" db:"todos"`
+	LoggedMinutes   int64   `json:"logged_minutes" db:"logged_minutes"`
+	EstimateMinutes int64   `json:"estimate_minutes" db:"estimate_minutes"`
+}
+
+// TimeReportQuery selects the todos and range a TimeReport covers.
+type TimeReportQuery struct {
+	From   *time.Time
+	To     *time.Time
+	Filter TodoFilter
+}
+
+// lockTodo locks a todo's row until tx ends, so that its logged time is
+// updated by one time entry at a time.
+func lockTodo(ctx context.Context, tx *sqlx.Tx, id int64) error {
+	var found int64
+	err := tx.GetContext(ctx, &found, "SELECT id FROM todos WHERE id = ? FOR UPDATE", id)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// syncLoggedMinutes sets a todo's logged time to the total of its time
+// entries and returns it. Running timers count for nothing until stopped.
+// Logging time does not change the todo itself, so updated_at, and with it
+// the CalDAV ETag, is kept.
+func syncLoggedMinutes(ctx context.Context, tx *sqlx.Tx, todoID int64) (int64, error) {
+	var logged int64
+	err := tx.GetContext(ctx, &logged, "SELECT COALESCE(SUM(minutes), 0) FROM time_entries WHERE todo_id = ?", todoID)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE todos SET logged_minutes = ?, updated_at = updated_at WHERE id = ?", logged, todoID)
+	return logged, err
+}
+
+func insertTimeEntry(ctx context.Context, tx *sqlx.Tx, entry *TimeEntry) error {
+	result, err := tx.NamedExecContext(ctx,
+		`INSERT INTO time_entries (todo_id, actor, started_at, ended_at, minutes, note, created_at)
+		VALUES (:todo_id, :actor, :started_at, :ended_at, :minutes, :note, :created_at)`, entry)
+	if err != nil {
+		if isDuplicateError(err) {
+			return ErrTimerRunning
+		}
+		return err
+	}
+	if entry.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	return nil
+}
+
+// CreateTimeEntry adds entry to its todo. A running entry fails with
+// ErrTimerRunning if its actor already runs a timer; a finished one adds to
+// the todo's logged time.
+func (r *Repository) CreateTimeEntry(ctx context.Context, entry *TimeEntry) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := lockTodo(ctx, tx, entry.TodoID); err != nil {
+			return err
+		}
+		if err := insertTimeEntry(ctx, tx, entry); err != nil {
+			return err
+		}
+		if entry.EndedAt == nil {
+			return nil
+		}
+		_, err := syncLoggedMinutes(ctx, tx, entry.TodoID)
+		return err
+	})
+}
+
+// StopTimer ends the timer actor runs on a todo at now and returns it. A
+// timer whose todo was deleted is stopped all the same, so that the actor
+// can start another one.
+func (r *Repository) StopTimer(ctx context.Context, todoID int64, actor string, now time.Time) (*TimeEntry, error) {
+	var entry TimeEntry
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		err := lockTodo(ctx, tx, todoID)
+		deleted := err == ErrNotFound
+		if err != nil && !deleted {
+			return err
+		}
+		err = tx.GetContext(ctx, &entry,
+			"SELECT * FROM time_entries WHERE todo_id = ? AND running_actor = ? FOR UPDATE", todoID, actor)
+		if err == sql.ErrNoRows {
+			return ErrNoRunningTimer
+		}
+		if err != nil {
+			return err
+		}
+
+		entry.EndedAt = &now
+		entry.Minutes = int64(math.Ceil(now.Sub(entry.StartedAt).Minutes()))
+		_, err = tx.NamedExecContext(ctx,
+			"UPDATE time_entries SET ended_at = :ended_at, minutes = :minutes WHERE id = :id", &entry)
+		if err != nil || deleted {
+			return err
+		}
+		_, err = syncLoggedMinutes(ctx, tx, todoID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// RunningTimer returns the timer actor runs, or nil if there is none.
+func (r *Repository) RunningTimer(ctx context.Context, actor string) (*TimeEntry, error) {
+	var entry TimeEntry
+	err := r.db.GetContext(ctx, &entry, "SELECT * FROM time_entries WHERE running_actor = ?", actor)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *Repository) GetTimeEntry(ctx context.Context, todoID, id int64) (*TimeEntry, error) {
+	var entry TimeEntry
+	err := r.db.GetContext(ctx, &entry, "SELECT * FROM time_entries WHERE id = ? AND todo_id = ?", id, todoID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &entry, err
+}
+
+// ListTimeEntries returns up to limit time entries of a todo that follow the
+// one with ID after, oldest first.
+func (r *Repository) ListTimeEntries(ctx context.Context, todoID, after int64, limit int) ([]TimeEntry, error) {
+	entries := []TimeEntry{}
+	err := r.db.SelectContext(ctx, &entries,
+		"SELECT * FROM time_entries WHERE todo_id = ? AND id > ? ORDER BY id LIMIT ?", todoID, after, limit)
+	return entries, err
+}
+
+// DeleteTimeEntry removes a time entry and takes its time off its todo.
+func (r *Repository) DeleteTimeEntry(ctx context.Context, entry *TimeEntry) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := lockTodo(ctx, tx, entry.TodoID); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, "DELETE FROM time_entries WHERE id = ?", entry.ID)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+		_, err = syncLoggedMinutes(ctx, tx, entry.TodoID)
+		return err
+	})
+}
+
+// TimeReport totals the finished time entries that started from from to to
+// on the todos matching filter.
+func (r *Repository) TimeReport(ctx context.Context, filter TodoFilter, from, to time.Time) (*TimeReport, error) {
+	where, args := filter.where()
+	// logged holds the time logged in the range on each todo, joined with
+	// the matching todos to total it with their estimates.
+	logged := `WITH logged AS (
+			SELECT todo_id, SUM(minutes) AS minutes FROM time_entries
+			WHERE ended_at IS NOT NULL AND started_at >= ? AND started_at < ? GROUP BY todo_id
+		) `
+	matching := "logged JOIN (SELECT * FROM todos" + where + ") t ON t.id = logged.todo_id"
+	totals := `COUNT(*) AS todos, COALESCE(SUM(logged.minutes), 0) AS logged_minutes,
+		COALESCE(SUM(t.estimate_minutes), 0) AS estimate_minutes`
+	args = append([]any{from, to}, args...)
+
+	report := &TimeReport{From: from, To: to, ByTag: []TagTime{}, ByList: []ListTime{}}
+	err := r.db.GetContext(ctx, report, logged+"SELECT "+totals+" FROM "+matching, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.SelectContext(ctx, &report.ByTag, logged+"SELECT jt.tag, "+totals+" FROM "+matching+
+		", JSON_TABLE(t.tags, '$[*]' COLUMNS (tag VARCHAR(64) PATH '$')) jt"+
+		" GROUP BY jt.tag ORDER BY logged_minutes DESC, jt.tag", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.SelectContext(ctx, &report.ByList, logged+"SELECT t.list_id, l.name, "+totals+" FROM "+matching+
+		" LEFT JOIN lists l ON l.id = t.list_id GROUP BY t.list_id, l.name ORDER BY logged_minutes DESC, t.list_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// StartTimer starts a timer for the caller on a todo. Each actor runs at
+// most one timer at a time.
+func (s *Service) StartTimer(ctx context.Context, todoID int64, input TimerInput) (*TimeEntry, error) {
+	if todoID <= 0 {
+		return nil, ErrInvalidID
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.authorizeTodo(ctx, todoID, RoleEditor); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entry := &TimeEntry{TodoID: todoID, Actor: ActorFromContext(ctx), Note: input.Note, StartedAt: now, CreatedAt: now}
+	if err := s.repo.CreateTimeEntry(ctx, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// StopTimer stops the caller's timer on a todo and logs its time. It takes
+// no role, so that callers who lost access to the todo or saw it deleted
+// can still stop the timer they started.
+func (s *Service) StopTimer(ctx context.Context, todoID int64) (*TimeEntry, error) {
+	if todoID <= 0 {
+		return nil, ErrInvalidID
+	}
+	return s.repo.StopTimer(ctx, todoID, ActorFromContext(ctx), time.Now())
+}
+
+// RunningTimer returns the caller's running timer, or nil.
+func (s *Service) RunningTimer(ctx context.Context) (*TimeEntry, error) {
+	return s.repo.RunningTimer(ctx, ActorFromContext(ctx))
+}
+
+// LogTime adds a finished time entry by the caller to a todo.
+func (s *Service) LogTime(ctx context.Context, todoID int64, input TimeEntryInput) (*TimeEntry, error) {
+	if todoID <= 0 {
+		return nil, ErrInvalidID
+	}
+	now := time.Now()
+	if err := input.Validate(now); err != nil {
+		return nil, err
+	}
+	if err := s.authorizeTodo(ctx, todoID, RoleEditor); err != nil {
+		return nil, err
+	}
+
+	ended := input.StartedAt.Add(time.Duration(input.Minutes) * time.Minute)
+	entry := &TimeEntry{
+		TodoID:    todoID,
+		Actor:     ActorFromContext(ctx),
+		Note:      input.Note,
+		Minutes:   input.Minutes,
+		StartedAt: *input.StartedAt,
+		EndedAt:   &ended,
+		CreatedAt: now,
+	}
+	if err := s.repo.CreateTimeEntry(ctx, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// TimeEntries returns a page of a todo's time entries, oldest first, and the
+// cursor of the next page.
+func (s *Service) TimeEntries(ctx context.Context, todoID int64, cursor string, limit int) ([]TimeEntry, string, error) {
+	if todoID <= 0 {
+		return nil, "", ErrInvalidID
+	}
+	_, limit, err := normalizePage(1, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.authorizeTodo(ctx, todoID, RoleViewer); err != nil {
+		return nil, "", err
+	}
+	if _, err := s.repo.GetByID(ctx, todoID); err != nil {
+		return nil, "", err
+	}
+
+	entries, err := s.repo.ListTimeEntries(ctx, todoID, after, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	entries, next := nextPage(entries, limit, func(e TimeEntry) int64 { return e.ID })
+	return entries, next, nil
+}
+
+// DeleteTimeEntry removes one of the caller's time entries from a todo. A
+// running timer is discarded without logging time.
+func (s *Service) DeleteTimeEntry(ctx context.Context, todoID, id int64) error {
+	if todoID <= 0 || id <= 0 {
+		return ErrInvalidID
+	}
+	if err := s.authorizeTodo(ctx, todoID, RoleEditor); err != nil {
+		return err
+	}
+	entry, err := s.repo.GetTimeEntry(ctx, todoID, id)
+	if err != nil {
+		return err
+	}
+	if entry.Actor != ActorFromContext(ctx) {
+		return ErrNotEntryActor
+	}
+	return s.repo.DeleteTimeEntry(ctx, entry)
+}
+
+// TimeReport reports the time logged on the todos matching q.Filter.
+// Without a range it covers the last 30 days up to now.
+func (s *Service) TimeReport(ctx context.Context, q TimeReportQuery) (*TimeReport, error) {
+	to := time.Now()
+	if q.To != nil {
+		to = *q.To
+	}
+	from := to.AddDate(0, 0, -30)
+	if q.From != nil {
+		from = *q.From
+	}
+	if from.After(to) {
+		return nil, ErrInvalidStatsRange
+	}
+	return s.repo.TimeReport(ctx, visible(ctx, q.Filter, RoleViewer), from, to)
+}
+
+// StartTimer serves POST /v1/todos/:id/timer/start. The body, with an
+// optional note, may be empty.
+func (h *Handler) StartTimer(c *gin.Context) {
+	todoID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	var input TimerInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+			return
+		}
+	}
+
+	entry, err := h.service.StartTimer(c.Request.Context(), todoID, input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": entry})
+}
+
+func (h *Handler) StopTimer(c *gin.Context) {
+	todoID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+
+	entry, err := h.service.StopTimer(c.Request.Context(), todoID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": entry})
+}
+
+// GetTimer serves GET /v1/timer, the caller's running timer or null.
+func (h *Handler) GetTimer(c *gin.Context) {
+	entry, err := h.service.RunningTimer(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": entry})
+}
+
+func (h *Handler) LogTime(c *gin.Context) {
+	todoID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	var input TimeEntryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	entry, err := h.service.LogTime(c.Request.Context(), todoID, input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": entry})
+}
+
+// ListTimeEntries serves GET /v1/todos/:id/time-entries. Pages follow the
+// opaque next_cursor of the previous one.
+func (h *Handler) ListTimeEntries(c *gin.Context) {
+	todoID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	cursor, limit, ok := parseCursorPage(c)
+	if !ok {
+		return
+	}
+
+	entries, next, err := h.service.TimeEntries(c.Request.Context(), todoID, cursor, limit)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": entries,
+		"meta": gin.H{
+			"limit":       limit,
+			"next_cursor": nullString(next),
+		},
+	})
+}
+
+func (h *Handler) DeleteTimeEntry(c *gin.Context) {
+	todoID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("entry_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+
+	if err := h.service.DeleteTimeEntry(c.Request.Context(), todoID, id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetTimeReport serves GET /v1/reports/time. It takes the list filters and
+// an optional RFC3339 from and to.
+func (h *Handler) GetTimeReport(c *gin.Context) {
+	filter, ok := parseTodoFilter(c)
+	if !ok {
+		return
+	}
+	q := TimeReportQuery{Filter: filter}
+	if q.From, ok = parseTimeQuery(c, "from"); !ok {
+		return
+	}
+	if q.To, ok = parseTimeQuery(c, "to"); !ok {
+		return
+	}
+
+	report, err := h.service.TimeReport(c.Request.Context(), q)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": report})
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeEntryInput_Validate(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	hourAgo := now.Add(-time.Hour)
+	future := now.Add(time.Minute)
+
+	tests := []struct {
+		wantErr error
+		name    string
+		input   TimeEntryInput
+	}{
+		{name: "ends now", input: TimeEntryInput{Minutes: 30}},
+		{name: "explicit start", input: TimeEntryInput{Minutes: 60, StartedAt: &hourAgo}},
+		{name: "zero minutes", input: TimeEntryInput{Minutes: 0}, wantErr: ErrInvalidTimeEntry},
+		{name: "longer than a day", input: TimeEntryInput{Minutes: maxEntryMinutes + 1}, wantErr: ErrInvalidTimeEntry},
+		{name: "ends in the future", input: TimeEntryInput{Minutes: 61, StartedAt: &hourAgo}, wantErr: ErrInvalidTimeEntry},
+		{name: "starts in the future", input: TimeEntryInput{Minutes: 1, StartedAt: &future}, wantErr: ErrInvalidTimeEntry},
+		{name: "note too long", input: TimeEntryInput{Minutes: 1, Note: strings.Repeat("ü", maxNoteLength+1)}, wantErr: ErrInvalidTimeEntry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.input.Validate(now)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			ended := tt.input.StartedAt.Add(time.Duration(tt.input.Minutes) * time.Minute)
+			assert.False(t, ended.After(now))
+		})
+	}
+}
+
+func TestService_TimeEntries_Validation(t *testing.T) {
+	service := &Service{repo: nil}
+	ctx := context.Background()
+
+	_, err := service.StartTimer(ctx, 0, TimerInput{})
+	assert.ErrorIs(t, err, ErrInvalidID)
+	_, err = service.StartTimer(ctx, 1, TimerInput{Note: strings.Repeat("x", maxNoteLength+1)})
+	assert.ErrorIs(t, err, ErrInvalidTimeEntry)
+	_, err = service.StopTimer(ctx, 0)
+	assert.ErrorIs(t, err, ErrInvalidID)
+	_, err = service.LogTime(ctx, 1, TimeEntryInput{Minutes: -5})
+	assert.ErrorIs(t, err, ErrInvalidTimeEntry)
+	_, _, err = service.TimeEntries(ctx, 1, "not a cursor", 10)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	assert.ErrorIs(t, service.DeleteTimeEntry(ctx, 1, 0), ErrInvalidID)
+}
+
+func TestService_TimeReport_InvalidRange(t *testing.T) {
+	service := &Service{repo: nil}
+	from := time.Now()
+	to := from.Add(-time.Hour)
+
+	_, err := service.TimeReport(context.Background(), TimeReportQuery{From: &from, To: &to})
+
+	assert.ErrorIs(t, err, ErrInvalidStatsRange)
+}
+
+func TestRepository_CreateTimeEntry_KeepsUpdatedAt(t *testing.T) {
+	repo := benchRepository(t)
+	ctx := WithActor(context.Background(), benchActor)
+	todos := benchTodos(0, 1)
+	require.NoError(t, repo.BulkCreate(ctx, benchOperation(OperationCreate), todos))
+	before, err := repo.GetByID(ctx, todos[0].ID)
+	require.NoError(t, err)
+
+	started := time.Now().Add(-time.Hour)
+	ended := started.Add(30 * time.Minute)
+	entry := &TimeEntry{TodoID: before.ID, Actor: benchActor, StartedAt: started, EndedAt: &ended, Minutes: 30, CreatedAt: time.Now()}
+	require.NoError(t, repo.CreateTimeEntry(ctx, entry))
+
+	after, err := repo.GetByID(ctx, before.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(30), after.LoggedMinutes)
+	assert.Equal(t, before.UpdatedAt, after.UpdatedAt)
+	assert.Equal(t, ETag(before), ETag(after))
+}
@@ -0,0 +1,317 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// todoistImporter reads Todoist backups: the JSON returned by its API, either
+// a bare array of tasks or a sync payload with "items" and "projects", and
+// the CSV files of its project backups. The format is detected from the
+// first character of the file.
+type todoistImporter struct{}
+
+func (todoistImporter) Parse(r io.Reader) ([]*ImportedTodo, error) {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return nil, fmt.Errorf("%w: empty file", ErrInvalidImport)
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = br.ReadByte()
+			continue
+		case '[', '{':
+			return parseTodoistJSON(br)
+		default:
+			return parseTodoistCSV(br)
+		}
+	}
+}
+
+// todoistID accepts Todoist's IDs, which are strings in current APIs and
+// numbers in older ones.
+type todoistID string
+
+func (id *todoistID) UnmarshalJSON(data []byte) error {
+	*id = todoistID(strings.Trim(string(data), `"`))
+	if *id == "null" {
+		*id = ""
+	}
+	return nil
+}
+
+type todoistTask struct {
+	Due *struct {
+		Date        string `json:"date"`
+		String      string `json:"string"`
+		IsRecurring bool   `json:"is_recurring"`
+	} `json:"due"`
+	ID          todoistID `json:"id"`
+	ParentID    todoistID `json:"parent_id"`
+	ProjectID   todoistID `json:"project_id"`
+	Content     string    `json:"content"`
+	Description string    `json:"description"`
+	Labels      []string  `json:"labels"`
+	Priority    int       `json:"priority"`
+	Checked     bool      `json:"checked"`
+	IsCompleted bool      `json:"is_completed"`
+}
+
+// todoistKnownFields are the task fields mapped onto a todo, and bookkeeping
+// fields that mean nothing outside Todoist. Every other scalar field, except
+// IDs, is kept in the description.
+var todoistKnownFields = map[string]bool{
+	"content": true, "description": true, "labels": true, "priority": true, "due": true,
+	"checked": true, "is_completed": true, "is_deleted": true, "collapsed": true,
+	"is_collapsed": true, "child_order": true, "order": true, "day_order": true,
+	"comment_count": true, "note_count": true,
+}
+
+func isTodoistIDField(name string) bool {
+	return name == "id" || strings.HasSuffix(name, "_id") || strings.HasSuffix(name, "_uid")
+}
+
+// todoistPriority maps Todoist's API priority, where 4 is the most urgent
+// (p1) and 1 is the default (p4), onto todox's. Default priority is nil.
+func todoistPriority(p int) *int {
+	if p < 2 || p > 4 {
+		return nil
+	}
+	priority := 4 - p
+	return &priority
+}
+
+func parseTodoistJSON(r io.Reader) ([]*ImportedTodo, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var rawTasks []json.RawMessage
+	projects := map[todoistID]string{}
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &rawTasks); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+	} else {
+		var backup struct {
+			Items    []json.RawMessage `json:"items"`
+			Projects []struct {
+				ID   todoistID `json:"id"`
+				Name string    `json:"name"`
+			} `json:"projects"`
+		}
+		if err := json.Unmarshal(data, &backup); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+		rawTasks = backup.Items
+		for _, p := range backup.Projects {
+			projects[p.ID] = p.Name
+		}
+	}
+
+	var (
+		roots []*ImportedTodo
+		byID  = make(map[todoistID]*ImportedTodo, len(rawTasks))
+		tasks = make([]todoistTask, len(rawTasks))
+		items = make([]*ImportedTodo, len(rawTasks))
+	)
+	for i, raw := range rawTasks {
+		var fields map[string]any
+		if err := json.Unmarshal(raw, &tasks[i]); err != nil {
+			return nil, fmt.Errorf("%w: task %d: %v", ErrInvalidImport, i+1, err)
+		}
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, fmt.Errorf("%w: task %d: %v", ErrInvalidImport, i+1, err)
+		}
+		task := tasks[i]
+
+		var notes importNotes
+		notes.add("Project", projects[task.ProjectID])
+		item := &ImportedTodo{Completed: task.Checked || task.IsCompleted}
+		item.Title = task.Content
+		item.Priority = todoistPriority(task.Priority)
+		for _, label := range task.Labels {
+			item.Tags = append(item.Tags, importTag(label))
+		}
+		if task.Due != nil {
+			if task.Due.IsRecurring {
+				notes.add("Recurrence", task.Due.String)
+			}
+			if due, ok := parseImportDate(task.Due.Date); ok {
+				item.DueDate = due
+			} else {
+				notes.add("Due", task.Due.String)
+			}
+		}
+
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if todoistKnownFields[name] || isTodoistIDField(name) {
+				continue
+			}
+			switch v := fields[name].(type) {
+			case string:
+				notes.add(importFieldLabel(name), v)
+			case float64:
+				notes.add(importFieldLabel(name), strconv.FormatFloat(v, 'f', -1, 64))
+			case bool:
+				if v {
+					notes.add(importFieldLabel(name), "true")
+				}
+			}
+		}
+		item.Description = notes.description(task.Description)
+
+		items[i] = item
+		if task.ID != "" {
+			byID[task.ID] = item
+		}
+	}
+
+	for i, item := range items {
+		if parent, ok := byID[tasks[i].ParentID]; ok && tasks[i].ParentID != "" && parent != item {
+			parent.Subtasks = append(parent.Subtasks, item)
+			continue
+		}
+		roots = append(roots, item)
+	}
+	return roots, nil
+}
+
+// todoistCSVColumns are the CSV columns mapped onto a todo. The others, such
+// as AUTHOR and RESPONSIBLE, are kept in the description.
+var todoistCSVColumns = map[string]bool{
+	"TYPE": true, "CONTENT": true, "DESCRIPTION": true, "PRIORITY": true,
+	"INDENT": true, "DATE": true, "DATE_LANG": true, "TIMEZONE": true,
+}
+
+// parseTodoistCSV reads a Todoist project backup. Tasks are nested by their
+// INDENT, notes are added to the description of the task above them, and
+// section names are recorded on the tasks that follow. Labels are written
+// inline in the content as @label.
+func parseTodoistCSV(r io.Reader) ([]*ImportedTodo, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing CSV header", ErrInvalidImport)
+	}
+	for i := range header {
+		header[i] = strings.ToUpper(strings.TrimSpace(trimBOM(header[i])))
+	}
+	if !slices.Contains(header, "CONTENT") {
+		return nil, fmt.Errorf("%w: missing \"CONTENT\" column", ErrInvalidImport)
+	}
+
+	var (
+		roots   []*ImportedTodo
+		stack   []*ImportedTodo // the last task at each indent level
+		notes   = map[*ImportedTodo]*importNotes{}
+		section string
+		last    *ImportedTodo
+	)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+		field := func(name string) string {
+			for i, h := range header {
+				if h == name && i < len(record) {
+					return strings.TrimSpace(record[i])
+				}
+			}
+			return ""
+		}
+
+		switch strings.ToLower(field("TYPE")) {
+		case "section":
+			section = field("CONTENT")
+			continue
+		case "note":
+			if last != nil {
+				notes[last].add("Comment", field("CONTENT"))
+			}
+			continue
+		case "task", "":
+			// Files without a TYPE column hold only tasks; blank rows
+			// separate sections.
+			if field("CONTENT") == "" {
+				continue
+			}
+		default:
+			continue
+		}
+
+		item := &ImportedTodo{}
+		n := &importNotes{}
+		n.add("Section", section)
+		var title []string
+		for _, word := range strings.Fields(field("CONTENT")) {
+			if len(word) > 1 && word[0] == '@' {
+				item.Tags = append(item.Tags, importTag(word[1:]))
+				continue
+			}
+			title = append(title, word)
+		}
+		item.Title = strings.Join(title, " ")
+		item.Description = field("DESCRIPTION")
+		// In CSV backups PRIORITY 1 is p1, the most urgent, and 4 the default.
+		if p, err := strconv.Atoi(field("PRIORITY")); err == nil {
+			item.Priority = todoistPriority(5 - p)
+		}
+		if date := field("DATE"); date != "" {
+			if due, ok := parseImportDate(date); ok {
+				item.DueDate = due
+			} else {
+				n.add("Due", date)
+			}
+		}
+		for i, h := range header {
+			if !todoistCSVColumns[h] && i < len(record) {
+				n.add(importFieldLabel(h), record[i])
+			}
+		}
+		notes[item] = n
+
+		indent, err := strconv.Atoi(field("INDENT"))
+		if err != nil || indent < 1 {
+			indent = 1
+		}
+		if indent > len(stack)+1 {
+			indent = len(stack) + 1
+		}
+		stack = append(stack[:indent-1], item)
+		if indent == 1 {
+			roots = append(roots, item)
+		} else {
+			parent := stack[indent-2]
+			parent.Subtasks = append(parent.Subtasks, item)
+		}
+		last = item
+	}
+
+	for item, n := range notes {
+		item.Description = n.description(item.Description)
+	}
+	return roots, nil
+}
@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// FormatTodoTxt is the todo.txt format (http://todotxt.org): one todo per
+// line with an optional "x" completion marker, "(A)" priority, dates,
+// +project and @context tags and key:value extensions.
+const FormatTodoTxt = "todotxt"
+
+// todoTxtPriority returns the todo.txt letter for a priority, "A" being 0.
+func todoTxtPriority(p int) string {
+	return string(rune('A' + p))
+}
+
+// parseTodoTxtPriority parses a single uppercase priority letter.
+func parseTodoTxtPriority(s string) (int, bool) {
+	if len(s) != 1 || s[0] < 'A' || s[0] > 'A'+MaxPriority {
+		return 0, false
+	}
+	return int(s[0] - 'A'), true
+}
+
+// todoTxtEncoder writes each todo as a todo.txt line. Projects are written
+// for tags without a leading "@", contexts for tags that have one. A
+// completed todo keeps its priority in a pri: extension, as the spec
+// suggests, and is dated by its completion time, or by its last update if
+// it was completed before that was tracked. Descriptions have no place in
+// todo.txt and are dropped.
+type todoTxtEncoder struct {
+	w io.Writer
+}
+
+func (e *todoTxtEncoder) Encode(todo *Todo) error {
+	var parts []string
+	if todo.Completed {
+		completed := todo.UpdatedAt
+		if todo.CompletedAt != nil {
+			completed = *todo.CompletedAt
+		}
+		parts = append(parts, "x", completed.UTC().Format(time.DateOnly))
+	} else if todo.Priority != nil {
+		parts = append(parts, "("+todoTxtPriority(*todo.Priority)+")")
+	}
+	if !todo.CreatedAt.IsZero() {
+		parts = append(parts, todo.CreatedAt.UTC().Format(time.DateOnly))
+	}
+	parts = append(parts, strings.Join(strings.Fields(todo.Title), " "))
+	for _, tag := range todo.Tags {
+		if !strings.HasPrefix(tag, "@") {
+			tag = "+" + tag
+		}
+		parts = append(parts, tag)
+	}
+	if todo.DueDate != nil {
+		parts = append(parts, "due:"+todo.DueDate.UTC().Format(time.DateOnly))
+	}
+	if todo.Completed && todo.Priority != nil {
+		parts = append(parts, "pri:"+todoTxtPriority(*todo.Priority))
+	}
+
+	_, err := io.WriteString(e.w, strings.Join(parts, " ")+"\n")
+	return err
+}
+
+func (e *todoTxtEncoder) Close() error {
+	return nil
+}
+
+func parseTodoTxt(r io.Reader) ([]ChecklistTodo, []RowError, error) {
+	var (
+		items []ChecklistTodo
+		rows  []RowError
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		item, err := parseTodoTxtLine(line)
+		if err != nil {
+			rows = append(rows, RowError{Row: len(items) + 1, Error: err.Error()})
+		}
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	return items, rows, nil
+}
+
+// parseTodoTxtLine parses one non-blank todo.txt line. The completion date
+// is skipped; the todo's update time records when it was imported.
+func parseTodoTxtLine(line string) (ChecklistTodo, error) {
+	var item ChecklistTodo
+	words := strings.Fields(line)
+
+	if words[0] == "x" {
+		item.Completed = true
+		words = words[1:]
+		if len(words) > 0 && isDateOnly(words[0]) {
+			words = words[1:]
+		}
+	} else if w := words[0]; len(w) == 3 && w[0] == '(' && w[2] == ')' {
+		if p, ok := parseTodoTxtPriority(w[1:2]); ok {
+			item.Priority = &p
+			words = words[1:]
+		}
+	}
+	if len(words) > 0 && isDateOnly(words[0]) {
+		created, _ := time.Parse(time.DateOnly, words[0])
+		item.CreatedAt = &created
+		words = words[1:]
+	}
+
+	var title []string
+	for _, word := range words {
+		switch {
+		case len(word) > 1 && word[0] == '+':
+			item.Tags = append(item.Tags, word[1:])
+		case len(word) > 1 && word[0] == '@':
+			item.Tags = append(item.Tags, word)
+		case strings.HasPrefix(word, "due:"):
+			due, err := parseDate(strings.TrimPrefix(word, "due:"))
+			if err != nil {
+				return item, errors.New("invalid due date")
+			}
+			item.DueDate = due
+		case strings.HasPrefix(word, "pri:"):
+			p, ok := parseTodoTxtPriority(strings.TrimPrefix(word, "pri:"))
+			if !ok {
+				return item, ErrInvalidPriority
+			}
+			item.Priority = &p
+		default:
+			title = append(title, word)
+		}
+	}
+	item.Title = strings.Join(title, " ")
+	return item, nil
+}
+
+func isDateOnly(s string) bool {
+	_, err := time.Parse(time.DateOnly, s)
+	return err == nil
+}
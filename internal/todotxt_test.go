@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTodoTxtEncoder(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	done := time.Date(2026, 1, 9, 0, 0, 0, 0, time.UTC)
+	edited := time.Date(2026, 1, 20, 0, 0, 0, 0, time.UTC)
+	due := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	a, c := 0, 2
+	todos := []*Todo{
+		{Title: "Call mom", Priority: &a, Tags: Tags{"family", "@phone"}, DueDate: &due, CreatedAt: created, UpdatedAt: created},
+		{Title: "File taxes", Description: "dropped", Priority: &c, Completed: true, CompletedAt: &done, CreatedAt: created, UpdatedAt: edited},
+		{Title: "Water plants", CreatedAt: created, UpdatedAt: created},
+		{Title: "Old chore", Completed: true, CreatedAt: created, UpdatedAt: done},
+	}
+
+	var buf bytes.Buffer
+	enc, err := NewTodoEncoder(&buf, FormatTodoTxt)
+	require.NoError(t, err)
+	for _, todo := range todos {
+		require.NoError(t, enc.Encode(todo))
+	}
+	require.NoError(t, enc.Close())
+
+	want := "(A) 2026-01-02 Call mom +family @phone due:2026-02-01\n" +
+		"x 2026-01-09 2026-01-02 File taxes pri:C\n" +
+		"2026-01-02 Water plants\n" +
+		"x 2026-01-09 2026-01-02 Old chore\n"
+	assert.Equal(t, want, buf.String())
+}
+
+func TestTodoTxt_RoundTrip(t *testing.T) {
+	body := "(B) 2026-01-02 Call mom +family @phone due:2026-02-01\n" +
+		"\n" +
+		"x 2026-01-09 2026-01-02 File taxes pri:C\n" +
+		"Water plants url:example.com\n"
+
+	items, err := ParseChecklist(strings.NewReader(body), FormatTodoTxt)
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+
+	created := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "Call mom", items[0].Title)
+	assert.Equal(t, 1, *items[0].Priority)
+	assert.Equal(t, Tags{"family", "@phone"}, items[0].Tags)
+	assert.Equal(t, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), *items[0].DueDate)
+	assert.Equal(t, created, *items[0].CreatedAt)
+	assert.True(t, items[1].Completed)
+	assert.Equal(t, 2, *items[1].Priority)
+	assert.Equal(t, "Water plants url:example.com", items[2].Title)
+	assert.Nil(t, items[2].CreatedAt)
+
+	var buf bytes.Buffer
+	enc := &todoTxtEncoder{w: &buf}
+	for _, item := range items {
+		todo := newTodo(item.CreateTodoInput, created)
+		todo.Completed = item.Completed
+		if item.Completed {
+			done := time.Date(2026, 1, 9, 0, 0, 0, 0, time.UTC)
+			todo.CompletedAt = &done
+		}
+		require.NoError(t, enc.Encode(todo))
+	}
+	assert.Equal(t, "(B) 2026-01-02 Call mom +family @phone due:2026-02-01\n"+
+		"x 2026-01-09 2026-01-02 File taxes pri:C\n"+
+		"2026-01-02 Water plants url:example.com\n", buf.String())
+}
+
+func TestParseChecklist_TodoTxtInvalidRows(t *testing.T) {
+	body := "ok\n+onlytags @here\nbad due:soon\nx 2026-01-02 pri:9 done\n"
+
+	_, err := ParseChecklist(strings.NewReader(body), FormatTodoTxt)
+
+	var importErr *ImportError
+	require.True(t, errors.As(err, &importErr))
+	assert.Equal(t, []RowError{
+		{Row: 2, Error: ErrTitleRequired.Error()},
+		{Row: 3, Error: "invalid due date"},
+		{Row: 4, Error: ErrInvalidPriority.Error()},
+	}, importErr.Rows)
+}
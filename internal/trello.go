@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// trelloImporter reads the JSON export of a Trello board. Open cards become
+// todos, the items of their checklists become subtasks and their labels
+// become tags. Archived cards and cards on archived lists are left out.
+type trelloImporter struct{}
+
+type trelloBoard struct {
+	Name  string `json:"name"`
+	Lists []struct {
+		ID     string  `json:"id"`
+		Name   string  `json:"name"`
+		Pos    float64 `json:"pos"`
+		Closed bool    `json:"closed"`
+	} `json:"lists"`
+	Cards      []trelloCard `json:"cards"`
+	Checklists []struct {
+		ID         string `json:"id"`
+		IDCard     string `json:"idCard"`
+		Name       string `json:"name"`
+		CheckItems []struct {
+			Name  string  `json:"name"`
+			State string  `json:"state"`
+			Pos   float64 `json:"pos"`
+		} `json:"checkItems"`
+		Pos float64 `json:"pos"`
+	} `json:"checklists"`
+}
+
+type trelloCard struct {
+	Due    *string `json:"due"`
+	Start  *string `json:"start"`
+	Labels []struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	} `json:"labels"`
+	ID          string  `json:"id"`
+	IDList      string  `json:"idList"`
+	Name        string  `json:"name"`
+	Desc        string  `json:"desc"`
+	ShortURL    string  `json:"shortUrl"`
+	Pos         float64 `json:"pos"`
+	Closed      bool    `json:"closed"`
+	DueComplete bool    `json:"dueComplete"`
+}
+
+func (trelloImporter) Parse(r io.Reader) ([]*ImportedTodo, error) {
+	var board trelloBoard
+	if err := json.NewDecoder(r).Decode(&board); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+
+	type list struct {
+		name   string
+		pos    float64
+		closed bool
+	}
+	lists := make(map[string]list, len(board.Lists))
+	for _, l := range board.Lists {
+		lists[l.ID] = list{name: l.Name, pos: l.Pos, closed: l.Closed}
+	}
+
+	// Order cards as they appear on the board: by list, then within it.
+	cards := make([]trelloCard, 0, len(board.Cards))
+	for _, card := range board.Cards {
+		if !card.Closed && !lists[card.IDList].closed {
+			cards = append(cards, card)
+		}
+	}
+	sort.SliceStable(cards, func(i, j int) bool {
+		li, lj := lists[cards[i].IDList], lists[cards[j].IDList]
+		if li.pos != lj.pos {
+			return li.pos < lj.pos
+		}
+		return cards[i].Pos < cards[j].Pos
+	})
+
+	checklists := board.Checklists
+	sort.SliceStable(checklists, func(i, j int) bool { return checklists[i].Pos < checklists[j].Pos })
+	subtasks := make(map[string][]*ImportedTodo)
+	for _, checklist := range checklists {
+		items := checklist.CheckItems
+		sort.SliceStable(items, func(i, j int) bool { return items[i].Pos < items[j].Pos })
+		for _, checkItem := range items {
+			subtask := &ImportedTodo{Completed: checkItem.State == "complete"}
+			subtask.Title = checkItem.Name
+			var notes importNotes
+			notes.add("Checklist", checklist.Name)
+			subtask.Description = notes.description("")
+			subtasks[checklist.IDCard] = append(subtasks[checklist.IDCard], subtask)
+		}
+	}
+
+	todos := make([]*ImportedTodo, 0, len(cards))
+	for _, card := range cards {
+		item := &ImportedTodo{Completed: card.DueComplete, Subtasks: subtasks[card.ID]}
+		item.Title = card.Name
+
+		var notes importNotes
+		notes.add("Board", board.Name)
+		notes.add("List", lists[card.IDList].name)
+		if card.Due != nil {
+			if due, ok := parseImportDate(*card.Due); ok {
+				item.DueDate = due
+			} else {
+				notes.add("Due", *card.Due)
+			}
+		}
+		if card.Start != nil {
+			notes.add("Start", *card.Start)
+		}
+		notes.add("Trello", card.ShortURL)
+		item.Description = notes.description(card.Desc)
+
+		for _, label := range card.Labels {
+			name := label.Name
+			if name == "" {
+				name = label.Color
+			}
+			if tag := importTag(name); tag != "" {
+				item.Tags = append(item.Tags, tag)
+			}
+		}
+		todos = append(todos, item)
+	}
+	return todos, nil
+}
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// What BulkUpsert does with a todo that already exists.
+const (
+	OnConflictError  = "error"
+	OnConflictUpdate = "update"
+	OnConflictSkip   = "skip"
+)
+
+// conflictKey is the key a todo is matched on when upserting: its source and
+// external ID if it has them, its title otherwise.
+func conflictKey(todo *Todo) string {
+	if todo.ExternalID != nil && todo.Source != nil {
+		return "external:" + *todo.Source + "\x00" + *todo.ExternalID
+	}
+	return "title:" + titleKey(todo.Title)
+}
+
+// getByConflictKeyForUpdate reads and locks the todo matching todo's conflict
+// key. It returns nil if there is none.
+func getByConflictKeyForUpdate(ctx context.Context, tx *sqlx.Tx, todo *Todo) (*Todo, error) {
+	var (
+		existing Todo
+		err      error
+	)
+	if todo.ExternalID != nil && todo.Source != nil {
+		err = tx.GetContext(ctx, &existing,
+			"SELECT * FROM todos WHERE source = ? AND external_id = ? FOR UPDATE", *todo.Source, *todo.ExternalID)
+	} else {
+		err = tx.GetContext(ctx, &existing, "SELECT * FROM todos WHERE title = ? FOR UPDATE", todo.Title)
+	}
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// BulkUpsert inserts todos, resolving conflicts on their conflict key with
+// INSERT ... ON DUPLICATE KEY UPDATE. With OnConflictUpdate an existing todo
+// takes the new title, description, due and start dates, priority, estimate
+// and tags; with OnConflictSkip it is left alone. It returns the resulting todos and, for
+// each, whether it was created, updated or skipped. A todo that collides on
+// a different unique key than its conflict key, such as an external ID whose
+// title belongs to another todo, fails with ErrDuplicateTitle.
+func (r *Repository) BulkUpsert(ctx context.Context, op *Operation, todos []*Todo, onConflict string) ([]*Todo, []string, error) {
+	onDuplicate := "id = LAST_INSERT_ID(id)"
+	if onConflict == OnConflictUpdate {
+		onDuplicate += `, title = new.title, description = new.description, due_date = new.due_date,
+		 priority = new.priority, estimate_minutes = new.estimate_minutes, tags = new.tags,
+		 start_date = new.start_date, updated_at = new.updated_at`
+	}
+	query := `INSERT INTO todos (parent_id, list_id, uid, title, description, due_date, completed, status, position,
+		 completed_at, completed_by, priority, estimate_minutes, tags, external_id, source, start_date,
+		 created_at, updated_at)
+		 VALUES (:parent_id, :list_id, :uid, :title, :description, :due_date, :completed, :status, :position,
+		 :completed_at, :completed_by, :priority, :estimate_minutes, :tags, :external_id, :source, :start_date,
+		 :created_at, :updated_at) AS new
+		 ON DUPLICATE KEY UPDATE ` + onDuplicate
+
+	upserted := make([]*Todo, 0, len(todos))
+	results := make([]string, 0, len(todos))
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := insertOperation(ctx, tx, op); err != nil {
+			return err
+		}
+
+		var checks []wipCheck
+		events := make([]TodoEvent, 0, len(todos))
+		for _, todo := range todos {
+			before, err := getByConflictKeyForUpdate(ctx, tx, todo)
+			if err != nil {
+				return err
+			}
+			// An existing todo keeps its list and status, so only a created
+			// one counts towards a WIP limit.
+			todoChecks, err := enforceWorkflows(ctx, tx, nil, []*Todo{todo})
+			if err != nil {
+				return err
+			}
+			if err := assignPositions(ctx, tx, []*Todo{todo}); err != nil {
+				return err
+			}
+			stampCompletion(nil, todo, ActorFromContext(ctx), todo.UpdatedAt)
+
+			result, err := tx.NamedExecContext(ctx, query, todo)
+			if err != nil {
+				if isDuplicateError(err) {
+					return ErrDuplicateTitle
+				}
+				return err
+			}
+			id, err := result.LastInsertId()
+			if err != nil {
+				return err
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+
+			// MySQL reports 1 affected row for an insert, 2 for an update and
+			// 0 for a duplicate left unchanged.
+			if affected == 1 {
+				checks = append(checks, todoChecks...)
+				todo.ID = id
+				upserted = append(upserted, todo)
+				results = append(results, ResultCreated)
+				events = append(events, newTodoEvent(ctx, op, EventCreated, nil, todo))
+				continue
+			}
+			if before == nil || before.ID != id {
+				return ErrDuplicateTitle
+			}
+			if affected == 0 {
+				upserted = append(upserted, before)
+				results = append(results, ResultSkipped)
+				continue
+			}
+
+			after, err := getForUpdate(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			upserted = append(upserted, after)
+			results = append(results, ResultUpdated)
+			events = append(events, newTodoEvent(ctx, op, EventUpdated, before, after))
+		}
+
+		if err := checkWIP(ctx, tx, checks); err != nil {
+			return err
+		}
+		return insertEvents(ctx, tx, events)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return upserted, results, nil
+}
+
+// BulkUpsert creates todos like BulkCreate, except that a todo whose source
+// and external ID, or title if it has none, already exist is handled as
+// onConflict says instead of failing. OnConflictError behaves exactly like
+// BulkCreate. It returns, for each input, the resulting todo and whether it
+// was created, updated or skipped.
+func (s *Service) BulkUpsert(ctx context.Context, inputs []CreateTodoInput, onConflict string) ([]*Todo, []string, *Operation, error) {
+	switch onConflict {
+	case "", OnConflictError:
+		todos, op, err := s.BulkCreate(ctx, inputs)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		results := make([]string, len(todos))
+		for i := range results {
+			results[i] = ResultCreated
+		}
+		return todos, results, op, nil
+	case OnConflictUpdate, OnConflictSkip:
+	default:
+		return nil, nil, nil, ErrInvalidOnConflict
+	}
+	// Conflicts are found among all todos, whatever their list.
+	if err := authorizeAdmin(ctx); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(inputs) == 0 {
+		return nil, nil, nil, ErrEmptyList
+	}
+
+	seen := make(map[string]bool)
+	now := time.Now()
+	todos := make([]*Todo, 0, len(inputs))
+	for _, input := range inputs {
+		if err := input.Validate(); err != nil {
+			return nil, nil, nil, err
+		}
+		todo := newTodo(input, now)
+		key := conflictKey(todo)
+		if seen[key] {
+			return nil, nil, nil, ErrDuplicateInRequest
+		}
+		seen[key] = true
+		todos = append(todos, todo)
+	}
+
+	op := s.newOperation(ctx, OperationCreate)
+	upserted, results, err := s.repo.BulkUpsert(ctx, op, todos, onConflict)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return upserted, results, op, nil
+}
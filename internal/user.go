@@ -0,0 +1,343 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultTenant is the tenant of users created without one, of lists created
+// by callers that are not users, and of todos outside any list.
+const DefaultTenant = "default"
+
+// tenantPattern is what a tenant name must look like.
+var tenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// userNamePattern is what a user name must look like: a name that an
+// @mention in a comment picks up whole.
+var userNamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]{0,62}[A-Za-z0-9])?$`)
+
+// reservedActors are the actor names of callers that are not users.
+var reservedActors = []string{ActorAPIKey, ActorAnonymous, ActorSystem, "cli"}
+
+// User is a person working on the instance. Users authenticate with their
+// own API key and act under their name. A user only works on the todos of
+// their tenant. Timezone is where relative times such as snooze presets
+// are resolved. APIKey is only set in the response that creates the user.
+type User struct {
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	APIKey     string    `json:"api_key,omitempty" db:"-"`
+	APIKeyHash string    `json:"-" db:"api_key_hash"`
+	Name       string    `json:"name" db:"name"`
+	Tenant     string    `json:"tenant" db:"tenant"`
+	Timezone   string    `json:"timezone" db:"timezone"`
+	ID         int64     `json:"id" db:"id"`
+}
+
+// UserInput creates a user. Tenant defaults to DefaultTenant and Timezone
+// to UTC.
+type UserInput struct {
+	Name     string `json:"name"`
+	Tenant   string `json:"tenant"`
+	Timezone string `json:"timezone"`
+}
+
+func (in *UserInput) Validate() error {
+	if !userNamePattern.MatchString(in.Name) || slices.Contains(reservedActors, in.Name) {
+		return ErrInvalidUserName
+	}
+	if in.Tenant == "" {
+		in.Tenant = DefaultTenant
+	}
+	if !tenantPattern.MatchString(in.Tenant) {
+		return ErrInvalidTenant
+	}
+	if in.Timezone == "" {
+		in.Timezone = "UTC"
+	}
+	return validateUserTimezone(in.Timezone)
+}
+
+// UserSettingsInput changes the caller's settings.
+type UserSettingsInput struct {
+	Timezone string `json:"timezone"`
+}
+
+func (in *UserSettingsInput) Validate() error {
+	return validateUserTimezone(in.Timezone)
+}
+
+// validateUserTimezone checks a user's timezone, which unlike the tz query
+// parameter is set as the timezone field.
+func validateUserTimezone(name string) error {
+	if _, err := loadTimezone(name); err != nil {
+		return ErrUserTimezone
+	}
+	return nil
+}
+
+// WithUser returns a copy of ctx carrying the user performing the request.
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// UserFromContext returns the user stored in ctx, or nil if the caller is
+// not a user, such as a holder of the instance API key.
+func UserFromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(userKey).(*User)
+	return user
+}
+
+// tenantFromContext returns the tenant of the caller.
+func tenantFromContext(ctx context.Context) string {
+	if user := UserFromContext(ctx); user != nil {
+		return user.Tenant
+	}
+	return DefaultTenant
+}
+
+func (r *Repository) CreateUser(ctx context.Context, user *User) error {
+	result, err := r.db.NamedExecContext(ctx,
+		`INSERT INTO users (name, tenant, timezone, api_key_hash, created_at)
+		VALUES (:name, :tenant, :timezone, :api_key_hash, :created_at)`, user)
+	if err != nil {
+		if isDuplicateError(err) {
+			return ErrDuplicateUser
+		}
+		return err
+	}
+	user.ID, err = result.LastInsertId()
+	return err
+}
+
+// HasUsers reports whether any user exists.
+func (r *Repository) HasUsers(ctx context.Context) (bool, error) {
+	var exists bool
+	err := r.db.GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM users)")
+	return exists, err
+}
+
+// ListUsers returns the users of a tenant, or of every tenant if tenant is
+// empty, by name.
+func (r *Repository) ListUsers(ctx context.Context, tenant string) ([]User, error) {
+	users := []User{}
+	query, args := "SELECT * FROM users", []any{}
+	if tenant != "" {
+		query += " WHERE tenant = ?"
+		args = append(args, tenant)
+	}
+	err := r.db.SelectContext(ctx, &users, query+" ORDER BY name", args...)
+	return users, err
+}
+
+func (r *Repository) GetUser(ctx context.Context, id int64) (*User, error) {
+	var user User
+	err := r.db.GetContext(ctx, &user, "SELECT * FROM users WHERE id = ?", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &user, err
+}
+
+func (r *Repository) GetUserByName(ctx context.Context, name string) (*User, error) {
+	var user User
+	err := r.db.GetContext(ctx, &user, "SELECT * FROM users WHERE name = ?", name)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &user, err
+}
+
+func (r *Repository) SetUserTimezone(ctx context.Context, id int64, timezone string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET timezone = ? WHERE id = ?", timezone, id)
+	return err
+}
+
+func (r *Repository) GetUserByKeyHash(ctx context.Context, hash string) (*User, error) {
+	var user User
+	err := r.db.GetContext(ctx, &user, "SELECT * FROM users WHERE api_key_hash = ?", hash)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &user, err
+}
+
+// CreateUser adds a user and issues their API key, which is only returned
+// here. Only callers that are not users themselves may create users.
+func (s *Service) CreateUser(ctx context.Context, input UserInput) (*User, error) {
+	if UserFromContext(ctx) != nil {
+		return nil, ErrAdminOnly
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	key := RandomID() + RandomID()
+	user := &User{
+		Name:       input.Name,
+		Tenant:     input.Tenant,
+		Timezone:   input.Timezone,
+		APIKeyHash: hashToken(key),
+		CreatedAt:  time.Now(),
+	}
+	if err := s.repo.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	user.APIKey = key
+	return user, nil
+}
+
+// Users returns the users a caller may see: those of their tenant, or all
+// of them for callers that are not users.
+func (s *Service) Users(ctx context.Context) ([]User, error) {
+	var tenant string
+	if user := UserFromContext(ctx); user != nil {
+		tenant = user.Tenant
+	}
+	return s.repo.ListUsers(ctx, tenant)
+}
+
+// GetUser returns a user the caller may see.
+func (s *Service) GetUser(ctx context.Context, id int64) (*User, error) {
+	if id <= 0 {
+		return nil, ErrInvalidID
+	}
+	user, err := s.repo.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if caller := UserFromContext(ctx); caller != nil && caller.Tenant != user.Tenant {
+		return nil, ErrNotFound
+	}
+	return user, nil
+}
+
+// UpdateSettings changes the caller's settings and returns the caller.
+func (s *Service) UpdateSettings(ctx context.Context, input UserSettingsInput) (*User, error) {
+	user, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetUserTimezone(ctx, user.ID, input.Timezone); err != nil {
+		return nil, err
+	}
+	updated := *user
+	updated.Timezone = input.Timezone
+	return &updated, nil
+}
+
+// Authenticate returns the user whose API key is key, or ErrUnauthorized.
+func (s *Service) Authenticate(ctx context.Context, key string) (*User, error) {
+	user, err := s.repo.GetUserByKeyHash(ctx, hashToken(key))
+	if err == ErrNotFound {
+		return nil, ErrUnauthorized
+	}
+	return user, err
+}
+
+// AllowsAnonymous reports whether requests without a key may be admitted
+// when API_KEY is unset. That is only the case until the first user is
+// created, since anonymous callers are not held to list memberships and
+// would otherwise see every user's lists. Users are never deleted, so once
+// one exists the answer is remembered.
+func (s *Service) AllowsAnonymous(ctx context.Context) (bool, error) {
+	if s.usersExist.Load() {
+		return false, nil
+	}
+	exists, err := s.repo.HasUsers(ctx)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		s.usersExist.Store(true)
+	}
+	return !exists, nil
+}
+
+// currentUser returns the caller, failing with ErrNoCurrentUser if the
+// caller is not a user.
+func currentUser(ctx context.Context) (*User, error) {
+	if user := UserFromContext(ctx); user != nil {
+		return user, nil
+	}
+	return nil, ErrNoCurrentUser
+}
+
+func (h *Handler) CreateUser(c *gin.Context) {
+	var input UserInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	user, err := h.service.CreateUser(c.Request.Context(), input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": user})
+}
+
+func (h *Handler) ListUsers(c *gin.Context) {
+	users, err := h.service.Users(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": users})
+}
+
+func (h *Handler) GetUser(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+
+	user, err := h.service.GetUser(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// GetMe serves GET /v1/me, the user the request is authenticated as.
+func (h *Handler) GetMe(c *gin.Context) {
+	user, err := currentUser(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// UpdateMe serves PATCH /v1/me, changing the caller's settings.
+func (h *Handler) UpdateMe(c *gin.Context) {
+	var input UserSettingsInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	user, err := h.service.UpdateSettings(c.Request.Context(), input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserInput_Validate(t *testing.T) {
+	tests := []struct {
+		wantErr    error
+		name       string
+		input      UserInput
+		wantTenant string
+	}{
+		{name: "defaults tenant", input: UserInput{Name: "alice"}, wantTenant: DefaultTenant},
+		{name: "with tenant", input: UserInput{Name: "bob.smith", Tenant: "acme"}, wantTenant: "acme"},
+		{name: "empty name", input: UserInput{}, wantErr: ErrInvalidUserName},
+		{name: "name with space", input: UserInput{Name: "alice smith"}, wantErr: ErrInvalidUserName},
+		{name: "trailing dot", input: UserInput{Name: "alice."}, wantErr: ErrInvalidUserName},
+		{name: "name too long", input: UserInput{Name: strings.Repeat("a", 65)}, wantErr: ErrInvalidUserName},
+		{name: "reserved name", input: UserInput{Name: ActorSystem}, wantErr: ErrInvalidUserName},
+		{name: "uppercase tenant", input: UserInput{Name: "alice", Tenant: "Acme"}, wantErr: ErrInvalidTenant},
+		{name: "unknown timezone", input: UserInput{Name: "alice", Timezone: "Mars/Olympus"}, wantErr: ErrUserTimezone},
+		{name: "server timezone", input: UserInput{Name: "alice", Timezone: "Local"}, wantErr: ErrUserTimezone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.input.Validate()
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantTenant, tt.input.Tenant)
+		})
+	}
+}
+
+func TestService_CreateUser_AdminOnly(t *testing.T) {
+	service := &Service{repo: nil}
+	ctx := WithUser(context.Background(), &User{ID: 1, Name: "alice", Tenant: DefaultTenant})
+
+	_, err := service.CreateUser(ctx, UserInput{Name: "bob"})
+
+	assert.ErrorIs(t, err, ErrAdminOnly)
+}
+
+func TestTenantFromContext(t *testing.T) {
+	assert.Equal(t, DefaultTenant, tenantFromContext(context.Background()))
+
+	ctx := WithUser(context.Background(), &User{ID: 1, Name: "alice", Tenant: "acme"})
+	assert.Equal(t, "acme", tenantFromContext(ctx))
+}
@@ -1,6 +1,8 @@
 package internal
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"os"
 	"strconv"
 	"time"
@@ -30,3 +32,18 @@ func GetEnvDuration(key string, fallback time.Duration) time.Duration {
 	}
 	return fallback
 }
+
+// RandomID returns a random 128-bit identifier encoded as 32 hex characters.
+func RandomID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// nullString returns nil for an empty string, for nullable text columns.
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,307 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SavedView is a named filter expression belonging to the actor that saved
+// it. Its todos are the ones its query matches when the view is executed.
+type SavedView struct {
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	Actor     string    `json:"actor" db:"actor"`
+	Name      string    `json:"name" db:"name"`
+	Query     string    `json:"query" db:"query"`
+	ID        int64     `json:"id" db:"id"`
+}
+
+// SavedViewInput creates a view, or updates the fields it sets. Creating a
+// view requires a name; an empty query matches every todo.
+type SavedViewInput struct {
+	Name  *string `json:"name"`
+	Query *string `json:"query"`
+}
+
+func (in *SavedViewInput) Validate() error {
+	if in.Name != nil {
+		name := strings.TrimSpace(*in.Name)
+		if name == "" || len(name) > 255 {
+			return ErrInvalidViewName
+		}
+		in.Name = &name
+	}
+	if in.Query != nil {
+		if _, err := ParseTodoQuery(*in.Query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Repository) CreateView(ctx context.Context, view *SavedView) error {
+	result, err := r.db.NamedExecContext(ctx,
+		`INSERT INTO saved_views (actor, name, query, created_at, updated_at)
+		VALUES (:actor, :name, :query, :created_at, :updated_at)`, view)
+	if err != nil {
+		if isDuplicateError(err) {
+			return ErrDuplicateView
+		}
+		return err
+	}
+	view.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *Repository) ListViews(ctx context.Context, actor string) ([]SavedView, error) {
+	views := []SavedView{}
+	err := r.db.SelectContext(ctx, &views, "SELECT * FROM saved_views WHERE actor = ? ORDER BY name", actor)
+	return views, err
+}
+
+func (r *Repository) GetView(ctx context.Context, id int64, actor string) (*SavedView, error) {
+	var view SavedView
+	err := r.db.GetContext(ctx, &view, "SELECT * FROM saved_views WHERE id = ? AND actor = ?", id, actor)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &view, err
+}
+
+func (r *Repository) UpdateView(ctx context.Context, view *SavedView) error {
+	result, err := r.db.NamedExecContext(ctx,
+		`UPDATE saved_views SET name = :name, query = :query, updated_at = :updated_at
+		WHERE id = :id AND actor = :actor`, view)
+	if err != nil {
+		if isDuplicateError(err) {
+			return ErrDuplicateView
+		}
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *Repository) DeleteView(ctx context.Context, id int64, actor string) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM saved_views WHERE id = ? AND actor = ?", id, actor)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Service) CreateView(ctx context.Context, input SavedViewInput) (*SavedView, error) {
+	if input.Name == nil {
+		return nil, ErrInvalidViewName
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	view := &SavedView{
+		Actor:     ActorFromContext(ctx),
+		Name:      *input.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if input.Query != nil {
+		view.Query = *input.Query
+	}
+	if err := s.repo.CreateView(ctx, view); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+func (s *Service) ListViews(ctx context.Context) ([]SavedView, error) {
+	return s.repo.ListViews(ctx, ActorFromContext(ctx))
+}
+
+func (s *Service) GetView(ctx context.Context, id int64) (*SavedView, error) {
+	if id <= 0 {
+		return nil, ErrInvalidID
+	}
+	return s.repo.GetView(ctx, id, ActorFromContext(ctx))
+}
+
+func (s *Service) UpdateView(ctx context.Context, id int64, input SavedViewInput) (*SavedView, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	view, err := s.GetView(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Name != nil {
+		view.Name = *input.Name
+	}
+	if input.Query != nil {
+		view.Query = *input.Query
+	}
+	view.UpdatedAt = time.Now()
+	if err := s.repo.UpdateView(ctx, view); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+func (s *Service) DeleteView(ctx context.Context, id int64) error {
+	if id <= 0 {
+		return ErrInvalidID
+	}
+	return s.repo.DeleteView(ctx, id, ActorFromContext(ctx))
+}
+
+// ViewTodos executes a saved view, returning a page of the todos its query
+// matches that also match filter.
+func (s *Service) ViewTodos(ctx context.Context, id int64, filter TodoFilter, sort string, page, limit int) (*SavedView, []Todo, int64, error) {
+	view, err := s.GetView(ctx, id)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	expr, err := ParseTodoQuery(view.Query)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	filter.Expression = expr.and(filter.Expression)
+
+	todos, total, err := s.List(ctx, filter, sort, page, limit)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return view, todos, total, nil
+}
+
+func (h *Handler) CreateView(c *gin.Context) {
+	var input SavedViewInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	view, err := h.service.CreateView(c.Request.Context(), input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": view})
+}
+
+func (h *Handler) ListViews(c *gin.Context) {
+	views, err := h.service.ListViews(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": views})
+}
+
+func (h *Handler) GetView(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+
+	view, err := h.service.GetView(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": view})
+}
+
+func (h *Handler) UpdateView(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	var input SavedViewInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	view, err := h.service.UpdateView(c.Request.Context(), id, input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": view})
+}
+
+func (h *Handler) DeleteView(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+
+	if err := h.service.DeleteView(c.Request.Context(), id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ViewTodos serves GET /v1/views/:id/todos, the todos matching a saved view.
+// The list filters, sort and pagination of ListTodos apply too.
+func (h *Handler) ViewTodos(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidID.Error()})
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	filter, ok := parseListFilter(c)
+	if !ok {
+		return
+	}
+
+	view, todos, total, err := h.service.ViewTodos(c.Request.Context(), id, filter, c.Query("sort"), page, limit)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": todos,
+		"meta": gin.H{
+			"view":  view,
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
@@ -0,0 +1,268 @@
+package internal
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// The states of the default workflow, followed by todos outside a list and
+// by lists created without a workflow of their own.
+const (
+	StatusOpen = "open"
+	StatusDone = "done"
+)
+
+// maxWorkflowStates caps the number of states a workflow may define.
+const maxWorkflowStates = 20
+
+// stateNamePattern is what a state name must look like, such as in_progress.
+var stateNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// Workflow is the set of states the todos of a list move through, such as
+// backlog, in_progress, review and done. A todo is completed while it is in a
+// done state. Transitions lists the states each state may move to; without
+// it any move is allowed, and a state missing from it is final. New todos
+// start in Initial.
+type Workflow struct {
+	Transitions map[string][]string `json:"transitions,omitempty"`
+	Initial     string              `json:"initial"`
+	States      []WorkflowState     `json:"states"`
+}
+
+// WorkflowState is one state of a workflow. A state with a WIP limit accepts
+// no more than that many todos of its list.
+type WorkflowState struct {
+	WIPLimit *int   `json:"wip_limit,omitempty"`
+	Name     string `json:"name"`
+	Done     bool   `json:"done"`
+}
+
+var defaultWorkflow = &Workflow{
+	Initial: StatusOpen,
+	States:  []WorkflowState{{Name: StatusOpen}, {Name: StatusDone, Done: true}},
+}
+
+// DefaultWorkflow returns a copy of the open/done workflow that mirrors the
+// completed flag.
+func DefaultWorkflow() *Workflow {
+	wf := *defaultWorkflow
+	wf.States = slices.Clone(defaultWorkflow.States)
+	return &wf
+}
+
+func (w Workflow) Value() (driver.Value, error) {
+	return json.Marshal(w)
+}
+
+func (w *Workflow) Scan(src any) error {
+	return scanJSON(src, w)
+}
+
+// Validate checks that the workflow is usable and defaults Initial to its
+// first state that is not done.
+func (w *Workflow) Validate() error {
+	if len(w.States) == 0 || len(w.States) > maxWorkflowStates {
+		return fmt.Errorf("%w: between 1 and %d states are required", ErrInvalidWorkflow, maxWorkflowStates)
+	}
+	var open, done bool
+	for i, state := range w.States {
+		if !stateNamePattern.MatchString(state.Name) {
+			return fmt.Errorf("%w: state %q must be lowercase letters, digits and underscores", ErrInvalidWorkflow, state.Name)
+		}
+		if w.state(state.Name) != &w.States[i] {
+			return fmt.Errorf("%w: state %q is defined twice", ErrInvalidWorkflow, state.Name)
+		}
+		if state.WIPLimit != nil && *state.WIPLimit < 1 {
+			return fmt.Errorf("%w: wip_limit of %q must be at least 1", ErrInvalidWorkflow, state.Name)
+		}
+		done = done || state.Done
+		open = open || !state.Done
+	}
+	if !open || !done {
+		return fmt.Errorf("%w: at least one open and one done state are required", ErrInvalidWorkflow)
+	}
+
+	if w.Initial == "" {
+		w.Initial = w.first(false)
+	}
+	if initial := w.state(w.Initial); initial == nil || initial.Done {
+		return fmt.Errorf("%w: initial state %q must be an open state", ErrInvalidWorkflow, w.Initial)
+	}
+	for from, tos := range w.Transitions {
+		if w.state(from) == nil {
+			return fmt.Errorf("%w: transition from unknown state %q", ErrInvalidWorkflow, from)
+		}
+		for _, to := range tos {
+			if w.state(to) == nil {
+				return fmt.Errorf("%w: transition to unknown state %q", ErrInvalidWorkflow, to)
+			}
+		}
+	}
+	return nil
+}
+
+// state returns the state called name, or nil if there is none.
+func (w *Workflow) state(name string) *WorkflowState {
+	for i := range w.States {
+		if w.States[i].Name == name {
+			return &w.States[i]
+		}
+	}
+	return nil
+}
+
+// first returns the name of the first state that is done, or not.
+func (w *Workflow) first(done bool) string {
+	for _, state := range w.States {
+		if state.Done == done {
+			return state.Name
+		}
+	}
+	return ""
+}
+
+// allows reports whether a todo may move from one state to another.
+func (w *Workflow) allows(from, to string) bool {
+	return from == to || w.Transitions == nil || slices.Contains(w.Transitions[from], to)
+}
+
+// target returns the state a v1 client completing (done) or reopening a todo
+// in from moves it to: the first done, or open, state from may move to, or
+// the first such state if it may move to none.
+func (w *Workflow) target(from string, done bool) string {
+	for _, state := range w.States {
+		if state.Done == done && w.allows(from, state.Name) {
+			return state.Name
+		}
+	}
+	return w.first(done)
+}
+
+// reconcile sets after's status and completed flag as it replaces before,
+// which is nil for a new todo. A new todo without a status starts in the
+// initial state, or the first done state if it is created completed. A status
+// change wins over completed, which always follows the state; otherwise
+// toggling completed moves the todo to the matching state. The move must be
+// one the workflow allows.
+func (w *Workflow) reconcile(before, after *Todo) error {
+	switch {
+	case before == nil && after.Status == "":
+		after.Status = w.Initial
+		if after.Completed {
+			after.Status = w.first(true)
+		}
+	case before != nil && after.Status == before.Status && after.Completed != before.Completed:
+		after.Status = w.target(before.Status, after.Completed)
+	}
+
+	state := w.state(after.Status)
+	if state == nil {
+		return fmt.Errorf("%w: %q", ErrInvalidStatus, after.Status)
+	}
+	if before != nil && !w.allows(before.Status, after.Status) {
+		return fmt.Errorf("%w: %q to %q", ErrInvalidTransition, before.Status, after.Status)
+	}
+	after.Completed = state.Done
+	return nil
+}
+
+// wipCheck is a state of a list that a write moved todos into, to be
+// checked against the state's WIP limit once the write is done.
+type wipCheck struct {
+	Status string
+	ListID int64
+	Limit  int
+}
+
+// enforceWorkflows reconciles every todo in after with the workflow of its
+// list as it replaces the todo at the same index of before, which is nil, or
+// has nil entries, for new todos. It locks the lists until tx ends, so that
+// concurrent writes cannot fill a state past its limit, and returns the
+// checks to pass to checkWIP once the todos are written.
+func enforceWorkflows(ctx context.Context, tx *sqlx.Tx, before, after []*Todo) ([]wipCheck, error) {
+	workflows, err := lockWorkflows(ctx, tx, after)
+	if err != nil {
+		return nil, err
+	}
+
+	var checks []wipCheck
+	for i, todo := range after {
+		var prev *Todo
+		if before != nil {
+			prev = before[i]
+		}
+		wf := defaultWorkflow
+		if todo.ListID != nil {
+			var ok bool
+			if wf, ok = workflows[*todo.ListID]; !ok {
+				return nil, ErrInvalidList
+			}
+		}
+		if err := wf.reconcile(prev, todo); err != nil {
+			return nil, err
+		}
+
+		state := wf.state(todo.Status)
+		if todo.ListID == nil || state.WIPLimit == nil || (prev != nil && prev.Status == todo.Status) {
+			continue
+		}
+		check := wipCheck{ListID: *todo.ListID, Status: todo.Status, Limit: *state.WIPLimit}
+		if !slices.Contains(checks, check) {
+			checks = append(checks, check)
+		}
+	}
+	return checks, nil
+}
+
+// lockWorkflows reads and locks the lists of todos inside tx and returns
+// their workflows keyed by list ID.
+func lockWorkflows(ctx context.Context, tx *sqlx.Tx, todos []*Todo) (map[int64]*Workflow, error) {
+	var ids []int64
+	for _, todo := range todos {
+		if todo.ListID != nil && !slices.Contains(ids, *todo.ListID) {
+			ids = append(ids, *todo.ListID)
+		}
+	}
+	workflows := make(map[int64]*Workflow, len(ids))
+	if len(ids) == 0 {
+		return workflows, nil
+	}
+
+	query, args, err := sqlx.In("SELECT id, workflow FROM lists WHERE id IN (?) ORDER BY id FOR UPDATE", ids)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Workflow Workflow `db:"workflow"`
+		ID       int64    `db:"id"`
+	}
+	if err := tx.SelectContext(ctx, &rows, tx.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		workflows[row.ID] = &row.Workflow
+	}
+	return workflows, nil
+}
+
+// checkWIP returns an error naming the first state that holds more todos
+// than its limit allows.
+func checkWIP(ctx context.Context, tx *sqlx.Tx, checks []wipCheck) error {
+	for _, check := range checks {
+		var count int
+		err := tx.GetContext(ctx, &count, "SELECT COUNT(*) FROM todos WHERE list_id = ? AND status = ?", check.ListID, check.Status)
+		if err != nil {
+			return err
+		}
+		if count > check.Limit {
+			return fmt.Errorf("%w: %q of list %d allows at most %d todos", ErrWIPLimitExceeded, check.Status, check.ListID, check.Limit)
+		}
+	}
+	return nil
+}
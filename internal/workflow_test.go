@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// kanban is backlog → in_progress → review → done, where review may send a
+// todo back and done may only be reopened into the backlog.
+func kanban() *Workflow {
+	two := 2
+	return &Workflow{
+		States: []WorkflowState{
+			{Name: "backlog"},
+			{Name: "in_progress", WIPLimit: &two},
+			{Name: "review"},
+			{Name: "done", Done: true},
+		},
+		Transitions: map[string][]string{
+			"backlog":     {"in_progress"},
+			"in_progress": {"review", "backlog"},
+			"review":      {"done", "in_progress"},
+			"done":        {"backlog"},
+		},
+	}
+}
+
+func TestWorkflow_Validate(t *testing.T) {
+	zero := 0
+
+	wf := kanban()
+	assert.NoError(t, wf.Validate())
+	assert.Equal(t, "backlog", wf.Initial, "initial defaults to the first open state")
+	assert.NoError(t, DefaultWorkflow().Validate())
+
+	tests := []struct {
+		workflow *Workflow
+		name     string
+	}{
+		{name: "no states", workflow: &Workflow{}},
+		{name: "bad name", workflow: &Workflow{States: []WorkflowState{{Name: "In Progress"}, {Name: "done", Done: true}}}},
+		{name: "duplicate state", workflow: &Workflow{States: []WorkflowState{{Name: "open"}, {Name: "open", Done: true}}}},
+		{name: "no done state", workflow: &Workflow{States: []WorkflowState{{Name: "open"}}}},
+		{name: "zero wip limit", workflow: &Workflow{States: []WorkflowState{{Name: "open", WIPLimit: &zero}, {Name: "done", Done: true}}}},
+		{name: "done initial", workflow: &Workflow{Initial: "done", States: []WorkflowState{{Name: "open"}, {Name: "done", Done: true}}}},
+		{name: "unknown transition", workflow: &Workflow{
+			States:      []WorkflowState{{Name: "open"}, {Name: "done", Done: true}},
+			Transitions: map[string][]string{"open": {"closed"}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, tt.workflow.Validate(), ErrInvalidWorkflow)
+		})
+	}
+}
+
+func TestWorkflow_Reconcile(t *testing.T) {
+	wf := kanban()
+	assert.NoError(t, wf.Validate())
+
+	t.Run("new todo starts in the initial state", func(t *testing.T) {
+		todo := &Todo{}
+		assert.NoError(t, wf.reconcile(nil, todo))
+		assert.Equal(t, "backlog", todo.Status)
+		assert.False(t, todo.Completed)
+	})
+
+	t.Run("new completed todo starts done", func(t *testing.T) {
+		todo := &Todo{Completed: true}
+		assert.NoError(t, wf.reconcile(nil, todo))
+		assert.Equal(t, "done", todo.Status)
+	})
+
+	t.Run("status change derives completed", func(t *testing.T) {
+		before := &Todo{Status: "review"}
+		after := &Todo{Status: "done"}
+		assert.NoError(t, wf.reconcile(before, after))
+		assert.True(t, after.Completed)
+	})
+
+	t.Run("status wins over completed", func(t *testing.T) {
+		before := &Todo{Status: "backlog"}
+		after := &Todo{Status: "in_progress", Completed: true}
+		assert.NoError(t, wf.reconcile(before, after))
+		assert.False(t, after.Completed)
+	})
+
+	t.Run("completing moves to a done state", func(t *testing.T) {
+		before := &Todo{Status: "review"}
+		after := &Todo{Status: "review", Completed: true}
+		assert.NoError(t, wf.reconcile(before, after))
+		assert.Equal(t, "done", after.Status)
+	})
+
+	t.Run("reopening follows the transitions", func(t *testing.T) {
+		before := &Todo{Status: "done", Completed: true}
+		after := &Todo{Status: "done"}
+		assert.NoError(t, wf.reconcile(before, after))
+		assert.Equal(t, "backlog", after.Status)
+	})
+
+	t.Run("disallowed transition", func(t *testing.T) {
+		before := &Todo{Status: "backlog"}
+		after := &Todo{Status: "done"}
+		assert.ErrorIs(t, wf.reconcile(before, after), ErrInvalidTransition)
+	})
+
+	t.Run("completing where no done state is reachable", func(t *testing.T) {
+		before := &Todo{Status: "backlog"}
+		after := &Todo{Status: "backlog", Completed: true}
+		assert.ErrorIs(t, wf.reconcile(before, after), ErrInvalidTransition)
+	})
+
+	t.Run("unknown status", func(t *testing.T) {
+		after := &Todo{Status: "blocked"}
+		assert.ErrorIs(t, wf.reconcile(nil, after), ErrInvalidStatus)
+	})
+
+	t.Run("default workflow mirrors completed", func(t *testing.T) {
+		before := &Todo{Status: StatusOpen}
+		after := &Todo{Status: StatusOpen, Completed: true}
+		assert.NoError(t, defaultWorkflow.reconcile(before, after))
+		assert.Equal(t, StatusDone, after.Status)
+	})
+}
+
+func TestListInput_Validate(t *testing.T) {
+	blank := "  "
+	name := " Platform "
+
+	assert.ErrorIs(t, (&ListInput{Name: &blank}).Validate(), ErrInvalidListName)
+	assert.ErrorIs(t, (&ListInput{Workflow: &Workflow{}}).Validate(), ErrInvalidWorkflow)
+
+	input := ListInput{Name: &name, Workflow: kanban()}
+	assert.NoError(t, input.Validate())
+	assert.Equal(t, "Platform", *input.Name)
+	assert.Equal(t, "backlog", input.Workflow.Initial)
+}
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS todo_events (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    todo_id BIGINT NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    changes JSON NOT NULL,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    INDEX idx_todo_events_todo_id (todo_id, id),
+    INDEX idx_todo_events_actor (actor, created_at),
+    INDEX idx_todo_events_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
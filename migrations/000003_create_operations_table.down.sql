@@ -0,0 +1,6 @@
+ALTER TABLE todo_events
+    DROP INDEX idx_todo_events_operation_id,
+    DROP COLUMN snapshot,
+    DROP COLUMN operation_id;
+
+DROP TABLE IF EXISTS operations;
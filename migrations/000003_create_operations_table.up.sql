@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS operations (
+    id VARCHAR(32) PRIMARY KEY,
+    kind VARCHAR(32) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    expires_at TIMESTAMP(6) NOT NULL,
+    undone_at TIMESTAMP(6) NULL,
+    INDEX idx_operations_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+ALTER TABLE todo_events
+    ADD COLUMN operation_id VARCHAR(32) NOT NULL DEFAULT '' AFTER request_id,
+    ADD COLUMN snapshot JSON NULL AFTER changes,
+    ADD INDEX idx_todo_events_operation_id (operation_id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS feed_tokens;
+
+ALTER TABLE todos
+    DROP INDEX idx_todos_uid,
+    DROP COLUMN uid;
@@ -0,0 +1,16 @@
+ALTER TABLE todos ADD COLUMN uid VARCHAR(255) NULL AFTER id;
+
+UPDATE todos SET uid = CONCAT('todox-', id) WHERE uid IS NULL;
+
+ALTER TABLE todos
+    MODIFY uid VARCHAR(255) NOT NULL,
+    ADD UNIQUE INDEX idx_todos_uid (uid);
+
+CREATE TABLE IF NOT EXISTS feed_tokens (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    actor VARCHAR(255) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    revoked_at TIMESTAMP(6) NULL,
+    INDEX idx_feed_tokens_actor (actor)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
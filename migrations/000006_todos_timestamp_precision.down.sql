@@ -0,0 +1,3 @@
+ALTER TABLE todos
+    MODIFY created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    MODIFY updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;
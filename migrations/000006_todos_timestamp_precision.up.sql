@@ -0,0 +1,3 @@
+ALTER TABLE todos
+    MODIFY created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    MODIFY updated_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6);
@@ -0,0 +1,4 @@
+ALTER TABLE todos
+    DROP INDEX idx_todos_tags,
+    DROP COLUMN tags,
+    DROP COLUMN priority;
@@ -0,0 +1,4 @@
+ALTER TABLE todos
+    ADD COLUMN priority TINYINT NULL AFTER completed,
+    ADD COLUMN tags JSON NULL AFTER priority,
+    ADD INDEX idx_todos_tags ((CAST(tags AS CHAR(64) ARRAY)));
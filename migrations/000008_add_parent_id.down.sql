@@ -0,0 +1,3 @@
+ALTER TABLE todos
+    DROP INDEX idx_todos_parent_id,
+    DROP COLUMN parent_id;
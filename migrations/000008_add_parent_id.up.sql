@@ -0,0 +1,3 @@
+ALTER TABLE todos
+    ADD COLUMN parent_id BIGINT NULL AFTER id,
+    ADD INDEX idx_todos_parent_id (parent_id);
@@ -0,0 +1,4 @@
+ALTER TABLE todos
+    DROP INDEX uq_todos_source_external_id,
+    DROP COLUMN source,
+    DROP COLUMN external_id;
@@ -0,0 +1,4 @@
+ALTER TABLE todos
+    ADD COLUMN external_id VARCHAR(255) NULL AFTER tags,
+    ADD COLUMN source VARCHAR(64) NULL AFTER external_id,
+    ADD UNIQUE INDEX uq_todos_source_external_id (source, external_id);
@@ -0,0 +1,2 @@
+ALTER TABLE todos
+    DROP INDEX ft_todos_title_description;
@@ -0,0 +1,2 @@
+ALTER TABLE todos
+    ADD FULLTEXT INDEX ft_todos_title_description (title, description);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS saved_views (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    actor VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    query TEXT NOT NULL,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    updated_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+    UNIQUE INDEX uq_saved_views_actor_name (actor, name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS completion_history;
+
+ALTER TABLE todos
+    DROP INDEX idx_todos_completed_at,
+    DROP COLUMN completed_by,
+    DROP COLUMN completed_at;
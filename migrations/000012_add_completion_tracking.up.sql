@@ -0,0 +1,48 @@
+ALTER TABLE todos
+    ADD COLUMN completed_at TIMESTAMP(6) NULL AFTER completed,
+    ADD COLUMN completed_by VARCHAR(255) NULL AFTER completed_at,
+    ADD INDEX idx_todos_completed_at (completed_at);
+
+CREATE TABLE IF NOT EXISTS completion_history (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    todo_id BIGINT NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    operation_id VARCHAR(32) NOT NULL DEFAULT '',
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    INDEX idx_completion_history_todo_id (todo_id, id),
+    INDEX idx_completion_history_action_created_at (action, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Rebuild the history from the audit log: events that set completed to true
+-- completed a todo, and updates that set it back to false reopened it.
+INSERT INTO completion_history (todo_id, action, actor, request_id, operation_id, created_at)
+SELECT todo_id,
+       IF(JSON_EXTRACT(changes, '$.completed.after') = CAST('true' AS JSON), 'completed', 'reopened'),
+       actor, request_id, operation_id, created_at
+FROM todo_events
+WHERE action IN ('created', 'updated')
+  AND (
+      (JSON_EXTRACT(changes, '$.completed.after') = CAST('true' AS JSON)
+       AND COALESCE(JSON_EXTRACT(changes, '$.completed.before') <> CAST('true' AS JSON), TRUE))
+      OR (JSON_EXTRACT(changes, '$.completed.after') = CAST('false' AS JSON)
+       AND JSON_EXTRACT(changes, '$.completed.before') = CAST('true' AS JSON))
+  )
+ORDER BY id;
+
+-- Backfill completed todos from their latest completion, falling back to
+-- their last update for todos completed before the audit log existed. The
+-- backfill is not an edit, so updated_at keeps its value.
+UPDATE todos t
+LEFT JOIN (
+    SELECT h.todo_id, h.actor, h.created_at
+    FROM completion_history h
+    JOIN (
+        SELECT todo_id, MAX(id) AS id FROM completion_history WHERE action = 'completed' GROUP BY todo_id
+    ) latest ON latest.id = h.id
+) c ON c.todo_id = t.id
+SET t.completed_at = COALESCE(c.created_at, t.updated_at),
+    t.completed_by = c.actor,
+    t.updated_at = t.updated_at
+WHERE t.completed = TRUE;
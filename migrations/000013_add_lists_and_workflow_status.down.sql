@@ -0,0 +1,6 @@
+ALTER TABLE todos
+    DROP INDEX idx_todos_list_id_status,
+    DROP COLUMN status,
+    DROP COLUMN list_id;
+
+DROP TABLE IF EXISTS lists;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS lists (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    workflow JSON NOT NULL,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    updated_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+    UNIQUE INDEX uq_lists_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+ALTER TABLE todos
+    ADD COLUMN list_id BIGINT NULL AFTER parent_id,
+    ADD COLUMN status VARCHAR(32) NOT NULL DEFAULT 'open' AFTER completed,
+    ADD INDEX idx_todos_list_id_status (list_id, status);
+
+-- Todos outside a list follow the default open/done workflow. The backfill
+-- is not an edit, so updated_at keeps its value.
+UPDATE todos SET status = 'done', updated_at = updated_at WHERE completed = TRUE;
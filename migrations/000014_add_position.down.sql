@@ -0,0 +1,3 @@
+ALTER TABLE todos
+    DROP INDEX idx_todos_position,
+    DROP COLUMN position;
@@ -0,0 +1,13 @@
+ALTER TABLE todos
+    ADD COLUMN position VARCHAR(255) CHARACTER SET ascii COLLATE ascii_bin NOT NULL DEFAULT '' AFTER status,
+    ADD INDEX idx_todos_position (position, id);
+
+-- Seed the manual order with the newest-first order. e followed by five
+-- base-36 digits is a valid position key and covers 60 million todos. The
+-- backfill is not an edit, so updated_at keeps its value.
+UPDATE todos t
+JOIN (
+    SELECT id, ROW_NUMBER() OVER (ORDER BY created_at DESC, id DESC) AS n FROM todos
+) ordered ON ordered.id = t.id
+SET t.position = CONCAT('e', LPAD(CONV(ordered.n, 10, 36), 5, '0')),
+    t.updated_at = t.updated_at;
@@ -0,0 +1,22 @@
+-- Comments outlive their todo, like its history, so that undoing a delete
+-- brings the discussion back.
+CREATE TABLE IF NOT EXISTS comments (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    todo_id BIGINT NOT NULL,
+    author VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    updated_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    INDEX idx_comments_todo_id (todo_id, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS mentions (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    comment_id BIGINT NOT NULL,
+    todo_id BIGINT NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    read_at TIMESTAMP(6) NULL,
+    UNIQUE INDEX uq_mentions_comment_id_actor (comment_id, actor),
+    INDEX idx_mentions_actor_read_at (actor, read_at, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
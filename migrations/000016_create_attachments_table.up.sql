@@ -0,0 +1,15 @@
+-- Attachments outlive their todo until the undo window has passed, so that
+-- undoing a delete brings them back. The API then removes them and their
+-- blobs.
+CREATE TABLE IF NOT EXISTS attachments (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    todo_id BIGINT NOT NULL,
+    blob_key VARCHAR(255) NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    uploaded_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    UNIQUE INDEX uq_attachments_blob_key (blob_key),
+    INDEX idx_attachments_todo_id (todo_id, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
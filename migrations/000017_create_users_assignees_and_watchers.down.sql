@@ -0,0 +1,4 @@
+ALTER TABLE lists DROP COLUMN tenant;
+DROP TABLE IF EXISTS todo_watchers;
+DROP TABLE IF EXISTS todo_assignees;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,31 @@
+-- Users authenticate with their own API key, of which only a hash is kept.
+CREATE TABLE IF NOT EXISTS users (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(64) NOT NULL,
+    tenant VARCHAR(64) NOT NULL DEFAULT 'default',
+    api_key_hash CHAR(64) NOT NULL,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    UNIQUE INDEX uq_users_name (name),
+    UNIQUE INDEX uq_users_api_key_hash (api_key_hash),
+    INDEX idx_users_tenant (tenant, name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS todo_assignees (
+    todo_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    PRIMARY KEY (todo_id, user_id),
+    INDEX idx_todo_assignees_user_id (user_id, todo_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS todo_watchers (
+    todo_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    PRIMARY KEY (todo_id, user_id),
+    INDEX idx_todo_watchers_user_id (user_id, todo_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- A todo belongs to the tenant of its list; todos outside lists belong to
+-- the default tenant.
+ALTER TABLE lists ADD COLUMN tenant VARCHAR(64) NOT NULL DEFAULT 'default';
@@ -0,0 +1,12 @@
+-- Share links carry an HMAC-signed token, so no secret is stored here.
+CREATE TABLE IF NOT EXISTS share_links (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    resource_type VARCHAR(16) NOT NULL,
+    resource_id BIGINT NOT NULL,
+    permission VARCHAR(16) NOT NULL,
+    created_by VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP(6) NOT NULL,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    revoked_at TIMESTAMP(6) NULL,
+    INDEX idx_share_links_created_by (created_by, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,11 @@
+-- Users reach the lists they have a role on, and the todos in them. Lists
+-- created before roles existed have no members until an owner is added with
+-- the instance API key.
+CREATE TABLE IF NOT EXISTS list_members (
+    list_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    role VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    PRIMARY KEY (list_id, user_id),
+    INDEX idx_list_members_user_id (user_id, role, list_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
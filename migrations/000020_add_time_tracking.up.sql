@@ -0,0 +1,21 @@
+ALTER TABLE todos
+    ADD COLUMN estimate_minutes INT NULL AFTER priority,
+    ADD COLUMN logged_minutes BIGINT NOT NULL DEFAULT 0 AFTER estimate_minutes;
+
+-- Time entries are kept when their todo is deleted, so that undoing the
+-- delete restores the logged time. running_actor is only set while an
+-- entry's timer runs, which lets each actor run at most one timer.
+CREATE TABLE IF NOT EXISTS time_entries (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    todo_id BIGINT NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    started_at TIMESTAMP(6) NOT NULL,
+    ended_at TIMESTAMP(6) NULL,
+    minutes INT NOT NULL DEFAULT 0,
+    note VARCHAR(1000) NOT NULL DEFAULT '',
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    running_actor VARCHAR(255) AS (IF(ended_at IS NULL, actor, NULL)) STORED,
+    UNIQUE INDEX uq_time_entries_running_actor (running_actor),
+    INDEX idx_time_entries_todo_id (todo_id, id),
+    INDEX idx_time_entries_started_at (started_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
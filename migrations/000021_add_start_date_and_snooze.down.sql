@@ -0,0 +1,7 @@
+ALTER TABLE users
+    DROP COLUMN timezone;
+
+ALTER TABLE todos
+    DROP INDEX idx_todos_snoozed_until,
+    DROP COLUMN snoozed_until,
+    DROP COLUMN start_date;
@@ -0,0 +1,9 @@
+-- A todo is hidden from the list views until its start date and while it is
+-- snoozed. The API clears snoozed_until once it has passed.
+ALTER TABLE todos
+    ADD COLUMN start_date TIMESTAMP(6) NULL AFTER due_date,
+    ADD COLUMN snoozed_until TIMESTAMP(6) NULL AFTER start_date,
+    ADD INDEX idx_todos_snoozed_until (snoozed_until);
+
+ALTER TABLE users
+    ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC' AFTER tenant;
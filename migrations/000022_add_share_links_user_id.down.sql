@@ -0,0 +1,3 @@
+ALTER TABLE share_links
+    DROP INDEX idx_share_links_resource,
+    DROP COLUMN user_id;
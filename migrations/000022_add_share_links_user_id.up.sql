@@ -0,0 +1,5 @@
+-- The user who created a share link, if any. The link only works while that
+-- user still owns what it shares.
+ALTER TABLE share_links
+    ADD COLUMN user_id BIGINT NULL AFTER created_by,
+    ADD INDEX idx_share_links_resource (resource_type, resource_id);
@@ -0,0 +1,2 @@
+ALTER TABLE todos
+    DROP INDEX idx_todos_list_id_position;
@@ -0,0 +1,3 @@
+-- The manual order is kept per list.
+ALTER TABLE todos
+    ADD INDEX idx_todos_list_id_position (list_id, position, id);